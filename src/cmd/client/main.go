@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -24,10 +26,50 @@ import (
 const (
 	BearerToken         = "Bearer"
 	EnvGoChatServerHost = "GO_CHAT_SERVER_HOST"
+
+	// EnvGoChatTLS enables https and wss when set to "true".
+	EnvGoChatTLS = "GO_CHAT_TLS"
+	// EnvGoChatCAFile points to a PEM bundle of CAs trusted in addition to the system ones.
+	EnvGoChatCAFile = "GO_CHAT_CA_FILE"
+	// EnvGoChatCertFile and EnvGoChatKeyFile point to the client certificate for mutual TLS.
+	EnvGoChatCertFile = "GO_CHAT_CERT_FILE"
+	EnvGoChatKeyFile  = "GO_CHAT_KEY_FILE"
+	// EnvGoChatModeratorKey is the moderator key, needed to join with a moderator name.
+	EnvGoChatModeratorKey = "GO_CHAT_MODERATOR_KEY"
+)
+
+const (
+	TypeMessage        = "message"
+	TypeAddReaction    = "reaction_add"
+	TypeRemoveReaction = "reaction_remove"
+	TypeRead           = "read"
+	TypeSetTopic       = "topic_set"
+	TypeAddPin         = "pin_add"
+	TypeRemovePin      = "pin_remove"
+	TypeReaction       = "reaction"
+	TypeMention        = "mention"
+	TypeDirect         = "direct"
+	TypeUnread         = "unread"
+	TypeReceipt        = "receipt"
+	TypeTopic          = "topic"
+	TypePin            = "pin"
+	TypeUnpin          = "unpin"
+	TypeDelete         = "delete"
+	TypeShutdown       = "shutdown"
+)
+
+const (
+	CommandReact   = "/react"
+	CommandUnreact = "/unreact"
+	CommandRead    = "/read"
+	CommandPin     = "/pin"
+	CommandUnpin   = "/unpin"
+	CommandTopic   = "/topic"
 )
 
 type User struct {
 	Name string
+	Key  string `json:",omitempty"`
 }
 
 func (t User) JSON() ([]byte, error) {
@@ -43,8 +85,179 @@ type GreetMessage struct {
 }
 
 type Message struct {
-	Author string
-	Value  string
+	ID        ulid.ULID
+	Type      string
+	Author    string
+	Value     string
+	Reactions []Reaction `json:",omitempty"`
+	Count     int        `json:",omitempty"`
+
+	Conversation string `json:",omitempty"`
+	RetryAfter   int    `json:",omitempty"`
+}
+
+type Reaction struct {
+	Value string
+	Count int
+	Users []string
+}
+
+func (m Message) String() string {
+	if m.Type == TypeReaction {
+		reactions := make([]string, 0, len(m.Reactions))
+		for _, r := range m.Reactions {
+			reactions = append(reactions, fmt.Sprintf("%s %d (%s)", r.Value, r.Count, strings.Join(r.Users, ", ")))
+		}
+
+		return fmt.Sprintf("[%s] reactions: %s", m.ID, strings.Join(reactions, " "))
+	}
+
+	if m.Type == TypeMention {
+		return fmt.Sprintf("[%s] %s mentioned you: %s", m.ID, m.Author, m.Value)
+	}
+
+	if m.Type == TypeDirect {
+		return fmt.Sprintf("[%s] %s (direct): %s", m.ID, m.Author, m.Value)
+	}
+
+	if m.Type == TypeUnread {
+		return fmt.Sprintf("[%s] %s read, %d unread", m.ID, m.Conversation, m.Count)
+	}
+
+	if m.Type == TypeReceipt {
+		return fmt.Sprintf("[%s] %s seen by %s", m.ID, m.Conversation, m.Author)
+	}
+
+	if m.Type == TypeTopic {
+		return fmt.Sprintf("Topic: %s", m.Value)
+	}
+
+	if m.Type == TypePin {
+		return fmt.Sprintf("[%s] pinned: %s: %s", m.ID, m.Author, m.Value)
+	}
+
+	if m.Type == TypeUnpin {
+		return fmt.Sprintf("[%s] unpinned", m.ID)
+	}
+
+	if m.Type == TypeDelete {
+		return fmt.Sprintf("[%s] deleted", m.ID)
+	}
+
+	if m.Type == TypeShutdown {
+		return fmt.Sprintf("%s: %s (reconnect in %ds)", m.Author, m.Value, m.RetryAfter)
+	}
+
+	return fmt.Sprintf("[%s] %s: %s", m.ID, m.Author, m.Value)
+}
+
+// parseMessage turns user input into a message, recognising the commands:
+//
+//	/react <message ID> <reaction>
+//	/unreact <message ID> <reaction>
+//	/read <message ID> [@user]
+//	/pin <message ID>
+//	/unpin <message ID>
+//	/topic <topic>
+func parseMessage(author, input string) Message {
+	fields := strings.Fields(input)
+	if len(fields) < 1 {
+		return Message{Type: TypeMessage, Author: author, Value: input}
+	}
+
+	if fields[0] == CommandTopic {
+		return Message{
+			Type:   TypeSetTopic,
+			Author: author,
+			Value:  strings.TrimSpace(strings.TrimPrefix(input, CommandTopic)),
+		}
+	}
+
+	commands := map[string]struct {
+		msgType string
+		args    int
+	}{
+		CommandReact:   {TypeAddReaction, 2},
+		CommandUnreact: {TypeRemoveReaction, 2},
+		CommandRead:    {TypeRead, 1},
+		CommandPin:     {TypeAddPin, 1},
+		CommandUnpin:   {TypeRemovePin, 1},
+	}
+
+	// Direct messages are read in the conversation with their author.
+	if fields[0] == CommandRead && len(fields) == 3 && strings.HasPrefix(fields[2], "@") {
+		if id, err := ulid.Parse(fields[1]); err == nil {
+			return Message{
+				ID:           id,
+				Type:         TypeRead,
+				Author:       author,
+				Conversation: fields[2],
+			}
+		}
+	}
+
+	if command, ok := commands[fields[0]]; ok && len(fields) == command.args+1 {
+		if id, err := ulid.Parse(fields[1]); err == nil {
+			msg := Message{
+				ID:     id,
+				Type:   command.msgType,
+				Author: author,
+			}
+			if command.args > 1 {
+				msg.Value = fields[2]
+			}
+
+			return msg
+		}
+	}
+
+	return Message{
+		Type:   TypeMessage,
+		Author: author,
+		Value:  input,
+	}
+}
+
+// httpClient returns the client for the server along with the HTTP and websocket schemes to use.
+func httpClient() (*http.Client, string, string, error) {
+	if os.Getenv(EnvGoChatTLS) != "true" {
+		return http.DefaultClient, "http", "ws", nil
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile := os.Getenv(EnvGoChatCAFile); len(caFile) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, "", "", err
+		}
+
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, "", "", fmt.Errorf("no certificates found in %s", caFile)
+		}
+
+		tlsCfg.RootCAs = pool
+	}
+
+	if certFile := os.Getenv(EnvGoChatCertFile); len(certFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, os.Getenv(EnvGoChatKeyFile))
+		if err != nil {
+			return nil, "", "", err
+		}
+
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsCfg},
+	}, "https", "wss", nil
 }
 
 func main() {
@@ -53,6 +266,11 @@ func main() {
 		host = "localhost:4001"
 	}
 
+	client, httpScheme, wsScheme, err := httpClient()
+	if err != nil {
+		log.Fatal(err, "error configuring TLS")
+	}
+
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
@@ -66,6 +284,7 @@ func main() {
 
 	user := User{
 		Name: author,
+		Key:  os.Getenv(EnvGoChatModeratorKey),
 	}
 
 	userJson, err := user.JSON()
@@ -75,7 +294,7 @@ func main() {
 
 	log.Println("Joining chat and obtaining token...")
 
-	res, err := http.Post(fmt.Sprintf("http://%s/join", host), "application/json", bytes.NewReader(userJson))
+	res, err := client.Post(fmt.Sprintf("%s://%s/join", httpScheme, host), "application/json", bytes.NewReader(userJson))
 	if err != nil {
 		log.Fatal(err, "error on POST /join")
 	}
@@ -100,7 +319,8 @@ func main() {
 	// Subscribe to messages.
 	var cSubscribe *websocket.Conn
 	go func() {
-		cSubscribe, _, err = websocket.Dial(context.Background(), fmt.Sprintf("ws://%s/subscribe", host), &websocket.DialOptions{
+		cSubscribe, _, err = websocket.Dial(context.Background(), fmt.Sprintf("%s://%s/subscribe", wsScheme, host), &websocket.DialOptions{
+			HTTPClient: client,
 			HTTPHeader: http.Header{BearerToken: []string{token.Value.String()}},
 		})
 		if err != nil {
@@ -114,7 +334,8 @@ func main() {
 			var msg Message
 			err = wsjson.Read(context.Background(), cSubscribe, &msg)
 			if err != nil {
-				if websocket.CloseStatus(err) == websocket.StatusNormalClosure || errors.Is(err, context.Canceled) {
+				status := websocket.CloseStatus(err)
+				if status == websocket.StatusNormalClosure || status == websocket.StatusGoingAway || errors.Is(err, context.Canceled) {
 					// On server closure, termination should happen on clients.
 					interrupt <- syscall.SIGTERM
 
@@ -124,14 +345,15 @@ func main() {
 				log.Fatal(err, "error receiving message")
 			}
 
-			log.Printf("%s: %s", msg.Author, msg.Value)
+			log.Println(msg)
 		}
 	}()
 
 	// Publish messages.
 	var cPublish *websocket.Conn
 	go func() {
-		cPublish, _, err = websocket.Dial(context.Background(), fmt.Sprintf("ws://%s/publish", host), &websocket.DialOptions{
+		cPublish, _, err = websocket.Dial(context.Background(), fmt.Sprintf("%s://%s/publish", wsScheme, host), &websocket.DialOptions{
+			HTTPClient: client,
 			HTTPHeader: http.Header{BearerToken: []string{token.Value.String()}},
 		})
 		if err != nil {
@@ -139,6 +361,9 @@ func main() {
 		}
 		defer cPublish.Close(websocket.StatusInternalError, "the sky is falling")
 
+		// Nothing is read from the publish connection, but pings from the server still need answering.
+		cPublish.CloseRead(context.Background())
+
 		log.Println("Publish: OK")
 
 		for {
@@ -150,10 +375,7 @@ func main() {
 			message = strings.TrimSpace(message)
 
 			ctxMessage, cancelMessage := context.WithTimeout(context.Background(), time.Second*10)
-			err = wsjson.Write(ctxMessage, cPublish, Message{
-				Author: author,
-				Value:  message,
-			})
+			err = wsjson.Write(ctxMessage, cPublish, parseMessage(author, message))
 			cancelMessage()
 			if err != nil {
 				log.Fatal(err, "error sending message")
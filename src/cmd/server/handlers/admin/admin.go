@@ -0,0 +1,655 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"nhooyr.io/websocket"
+
+	chatAPI "gochat/cmd/server/handlers/chat"
+	"gochat/cmd/server/handlers/response"
+	"gochat/cmd/server/models"
+	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/reload"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/ban"
+	"gochat/internal/storage/inmemory/hook"
+	"gochat/internal/storage/inmemory/user"
+	"gochat/internal/webhook"
+	"gochat/internal/websocket/connection"
+)
+
+// MaxBotNameLength limits the names of incoming webhook bots, before the bot marker.
+const MaxBotNameLength = 32
+
+var authFailures = metrics.Default.Counter("gochat_admin_auth_failures_total", "Admin API requests with a missing or wrong credential.")
+
+type AdminHandler interface {
+	Authenticate(next http.HandlerFunc) http.HandlerFunc
+	Users(w http.ResponseWriter, r *http.Request)
+	Sessions(w http.ResponseWriter, r *http.Request)
+	Announcements(w http.ResponseWriter, r *http.Request)
+	Room(w http.ResponseWriter, r *http.Request)
+	Pins(w http.ResponseWriter, r *http.Request)
+	Messages(w http.ResponseWriter, r *http.Request)
+	Bans(w http.ResponseWriter, r *http.Request)
+	Stats(w http.ResponseWriter, r *http.Request)
+	Webhooks(w http.ResponseWriter, r *http.Request)
+	IncomingWebhooks(w http.ResponseWriter, r *http.Request)
+	Reload(w http.ResponseWriter, r *http.Request)
+}
+
+func New(
+	token string,
+	userStorage user.UserStorage,
+	banStorage ban.BanStorage,
+	connService connection.ConnectionService,
+	chatService chat.ChatService,
+	roomService room.RoomService,
+	lifecycleService lifecycle.LifecycleService,
+	reloadService reload.ReloadService,
+	webhookService webhook.WebhookService,
+	hookStorage hook.HookStorage,
+) AdminHandler {
+	return &handler{
+		token:            []byte(token),
+		started:          time.Now(),
+		userStorage:      userStorage,
+		banStorage:       banStorage,
+		connService:      connService,
+		chatService:      chatService,
+		roomService:      roomService,
+		lifecycleService: lifecycleService,
+		reloadService:    reloadService,
+		webhookService:   webhookService,
+		hookStorage:      hookStorage,
+	}
+}
+
+type handler struct {
+	token            []byte
+	started          time.Time
+	userStorage      user.UserStorage
+	banStorage       ban.BanStorage
+	connService      connection.ConnectionService
+	chatService      chat.ChatService
+	roomService      room.RoomService
+	lifecycleService lifecycle.LifecycleService
+	reloadService    reload.ReloadService
+	webhookService   webhook.WebhookService
+	hookStorage      hook.HookStorage
+}
+
+// Authenticate lets requests carrying the admin token through, comparing it in constant time.
+func (h handler) Authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := []byte(r.Header.Get(models.BearerToken))
+		if len(h.token) < 1 || subtle.ConstantTimeCompare(token, h.token) != 1 {
+			authFailures.Inc()
+			logger.FromContext(r.Context()).Warn("admin authentication failed", "remote_addr", r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// Users lists the joined users with their number of sessions.
+func (h handler) Users(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	sessions := map[string]int{}
+	for _, s := range h.connService.List() {
+		sessions[s.User]++
+	}
+
+	users := []models.AdminUser{}
+	for _, name := range h.userStorage.List() {
+		users = append(users, models.AdminUser{
+			Name:     name,
+			Sessions: sessions[name],
+		})
+	}
+
+	response.JSON(w, r, http.StatusOK, users)
+}
+
+// Sessions lists the websocket sessions on GET /admin/sessions and force-disconnects one on
+// DELETE /admin/sessions/{id}.
+func (h handler) Sessions(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/sessions"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && len(id) < 1:
+		sessions := []models.Session{}
+		for _, s := range h.connService.List() {
+			sessions = append(sessions, models.Session{
+				ID:          s.ID,
+				Endpoint:    s.Endpoint,
+				User:        s.User,
+				RemoteAddr:  s.RemoteAddr,
+				ConnectedAt: s.ConnectedAt,
+				Messages:    s.Messages,
+				Bytes:       s.Bytes,
+			})
+		}
+
+		response.JSON(w, r, http.StatusOK, sessions)
+	case r.Method == http.MethodDelete && len(id) > 0:
+		sessionID, err := ulid.Parse(id)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		err = h.connService.Disconnect(sessionID, websocket.StatusPolicyViolation, "disconnected by admin")
+		if errors.Is(err, connection.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if err != nil {
+			logger.FromContext(r.Context()).Warn("error disconnecting session", "session_id", sessionID, "error", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Announcements broadcasts a system announcement to every subscriber.
+func (h handler) Announcements(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	var announcement models.Announcement
+	if !decode(w, r, &announcement) {
+		return
+	}
+
+	if len(strings.TrimSpace(announcement.Value)) < 1 {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	posted := h.chatService.PostMessage(chat.Message{
+		Author:  chat.ChatAPIName,
+		Message: announcement.Value,
+	})
+
+	logger.FromContext(r.Context()).Info("announcement posted", "message_id", posted.ID)
+
+	response.JSON(w, r, http.StatusCreated, chatAPI.Message(posted))
+}
+
+// Room shows the room topic, pins and moderators on GET and sets the topic on PUT.
+func (h handler) Room(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.room(w, r)
+	case http.MethodPut:
+		var topic models.SetTopic
+		if !decode(w, r, &topic) {
+			return
+		}
+
+		if err := h.roomService.SetTopic(chat.ChatAPIName, topic.Topic); err != nil {
+			response.JSON(w, r, http.StatusBadRequest, models.Error{Error: err.Error()})
+
+			return
+		}
+
+		logger.FromContext(r.Context()).Info("topic set", "topic", topic.Topic)
+
+		h.room(w, r)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (h handler) room(w http.ResponseWriter, r *http.Request) {
+	current := h.roomService.Room()
+
+	pins := []models.Pin{}
+	for _, p := range current.Pins {
+		pins = append(pins, models.Pin{
+			MessageID: p.MessageID,
+			Author:    p.Author,
+			Value:     p.Message,
+			PinnedBy:  p.PinnedBy,
+		})
+	}
+
+	response.JSON(w, r, http.StatusOK, models.Room{
+		ID:         room.ID,
+		Topic:      current.Topic,
+		Pins:       pins,
+		Moderators: h.roomService.Moderators(),
+	})
+}
+
+// Pins pins a message on POST /admin/room/pins and unpins it on DELETE /admin/room/pins/{id}.
+func (h handler) Pins(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/room/pins"), "/")
+
+	switch {
+	case r.Method == http.MethodPost && len(id) < 1:
+		var read models.Read
+		if !decode(w, r, &read) {
+			return
+		}
+
+		if err := h.roomService.Pin(chat.ChatAPIName, read.MessageID); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		logger.FromContext(r.Context()).Info("message pinned", "message_id", read.MessageID)
+
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && len(id) > 0:
+		messageID, err := ulid.Parse(id)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		if err := h.roomService.Unpin(chat.ChatAPIName, messageID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		logger.FromContext(r.Context()).Info("message unpinned", "message_id", messageID)
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Messages deletes a message on DELETE /admin/messages/{id}, removing it from history and from the
+// clients.
+func (h handler) Messages(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/messages"), "/")
+	if r.Method != http.MethodDelete || len(id) < 1 {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	messageID, err := ulid.Parse(id)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	if err := h.chatService.Delete(messageID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("message deleted", "message_id", messageID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Bans lists the bans on GET /admin/bans, bans a user on POST /admin/bans and lifts a ban on
+// DELETE /admin/bans/{name}. Banning signs the user out and disconnects all their sessions.
+func (h handler) Bans(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/bans"), "/")
+	log := logger.FromContext(r.Context())
+
+	switch {
+	case r.Method == http.MethodGet && len(name) < 1:
+		bans := []models.Ban{}
+		for _, b := range h.banStorage.List() {
+			bans = append(bans, models.Ban{
+				Name:     b.Username,
+				Reason:   b.Reason,
+				BannedAt: b.BannedAt,
+			})
+		}
+
+		response.JSON(w, r, http.StatusOK, bans)
+	case r.Method == http.MethodPost && len(name) < 1:
+		var b models.Ban
+		if !decode(w, r, &b) {
+			return
+		}
+
+		if len(b.Name) < 1 || b.Name == chat.ChatAPIName {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		h.banStorage.Add(ban.Ban{
+			Username: b.Name,
+			Reason:   b.Reason,
+			BannedAt: time.Now(),
+		})
+
+		if token, err := h.userStorage.FindTokenByUsername(b.Name); err == nil {
+			h.userStorage.Remove(token)
+		}
+
+		for _, s := range h.connService.ByUser(b.Name) {
+			if err := h.connService.Disconnect(s.ID, websocket.StatusPolicyViolation, "banned"); err != nil && !errors.Is(err, connection.ErrNotFound) {
+				log.Warn("error disconnecting banned user", "session_id", s.ID, "error", err)
+			}
+		}
+
+		log.Info("user banned", "user", b.Name, "reason", b.Reason)
+
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && len(name) > 0:
+		if !h.banStorage.Remove(name) {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		log.Info("user unbanned", "user", name)
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Stats shows live counters of the running server.
+func (h handler) Stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	stats := models.Stats{
+		Users:      len(h.userStorage.List()),
+		Sessions:   map[string]int{},
+		History:    len(h.chatService.History()),
+		Bans:       len(h.banStorage.List()),
+		Goroutines: runtime.NumGoroutine(),
+		Uptime:     int64(time.Since(h.started).Seconds()),
+		Draining:   h.lifecycleService.Draining(),
+	}
+
+	for _, s := range h.connService.List() {
+		stats.Sessions[s.Endpoint]++
+	}
+
+	for _, queued := range h.chatService.Queued() {
+		stats.Queued += queued
+	}
+
+	response.JSON(w, r, http.StatusOK, stats)
+}
+
+// Webhooks lists the webhooks on GET /admin/webhooks, registers one on POST /admin/webhooks and
+// removes one on DELETE /admin/webhooks/{id}. The secret is only returned on registration.
+func (h handler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/webhooks"), "/")
+	log := logger.FromContext(r.Context())
+
+	switch {
+	case r.Method == http.MethodGet && len(id) < 1:
+		hooks := []models.Webhook{}
+		for _, hook := range h.webhookService.List() {
+			hook.Secret = ""
+			hooks = append(hooks, webhookModel(hook))
+		}
+
+		response.JSON(w, r, http.StatusOK, hooks)
+	case r.Method == http.MethodPost && len(id) < 1:
+		var m models.Webhook
+		if !decode(w, r, &m) {
+			return
+		}
+
+		hook, err := h.webhookService.Add(m.URL, m.Events, m.Secret)
+		if errors.Is(err, webhook.ErrInvalidURL) || errors.Is(err, webhook.ErrInvalidEvent) {
+			response.JSON(w, r, http.StatusBadRequest, models.Error{Error: err.Error()})
+
+			return
+		}
+
+		if err != nil {
+			log.Error("error adding webhook", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		log.Info("webhook added", "webhook_id", hook.ID, "url", hook.URL, "events", hook.Events)
+
+		response.JSON(w, r, http.StatusCreated, webhookModel(hook))
+	case r.Method == http.MethodDelete && len(id) > 0:
+		hookID, err := ulid.Parse(id)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		err = h.webhookService.Remove(hookID)
+		if errors.Is(err, webhook.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if err != nil {
+			log.Error("error removing webhook", "webhook_id", hookID, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		log.Info("webhook removed", "webhook_id", hookID)
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func webhookModel(hook webhook.Hook) models.Webhook {
+	return models.Webhook{
+		ID:        hook.ID,
+		URL:       hook.URL,
+		Events:    hook.Events,
+		Secret:    hook.Secret,
+		CreatedAt: hook.CreatedAt,
+	}
+}
+
+// IncomingWebhooks lists the incoming webhooks on GET /admin/incoming-webhooks, creates one on
+// POST /admin/incoming-webhooks and deletes one on DELETE /admin/incoming-webhooks/{id}. The token
+// to post with is only returned on creation.
+func (h handler) IncomingWebhooks(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/incoming-webhooks"), "/")
+	log := logger.FromContext(r.Context())
+
+	switch {
+	case r.Method == http.MethodGet && len(id) < 1:
+		hooks := []models.IncomingWebhook{}
+		for _, hk := range h.hookStorage.List() {
+			hk.Token = ""
+			hooks = append(hooks, incomingWebhookModel(hk))
+		}
+
+		response.JSON(w, r, http.StatusOK, hooks)
+	case r.Method == http.MethodPost && len(id) < 1:
+		var m models.IncomingWebhook
+		if !decode(w, r, &m) {
+			return
+		}
+
+		if len(m.Room) < 1 {
+			m.Room = room.ID
+		}
+
+		if m.Room != room.ID {
+			response.JSON(w, r, http.StatusBadRequest, models.Error{Error: "room not found"})
+
+			return
+		}
+
+		if err := validateBotName(m.Name); err != nil {
+			response.JSON(w, r, http.StatusBadRequest, models.Error{Error: err.Error()})
+
+			return
+		}
+
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		hk := hook.Hook{
+			ID:        ulid.Make(),
+			Token:     hex.EncodeToString(b),
+			Room:      m.Room,
+			Name:      m.Name,
+			CreatedAt: time.Now(),
+		}
+		if err := h.hookStorage.Add(hk); err != nil {
+			log.Error("error creating incoming webhook", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		log.Info("incoming webhook created", "hook_id", hk.ID, "room", hk.Room, "name", hk.Name)
+
+		response.JSON(w, r, http.StatusCreated, incomingWebhookModel(hk))
+	case r.Method == http.MethodDelete && len(id) > 0:
+		hookID, err := ulid.Parse(id)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		removed, err := h.hookStorage.Remove(hookID)
+		if err != nil {
+			log.Error("error deleting incoming webhook", "hook_id", hookID, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		if !removed {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		log.Info("incoming webhook deleted", "hook_id", hookID)
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// validateBotName checks the name can be shown as a bot. The bot marker is added to it, and users
+// cannot join with marked names, so bots never take the name of a user.
+func validateBotName(name string) error {
+	switch {
+	case len(strings.TrimSpace(name)) < 1 || len(name) > MaxBotNameLength:
+		return fmt.Errorf("name must be 1 to %d bytes long", MaxBotNameLength)
+	case strings.TrimSpace(name) != name || strings.ContainsAny(name, "\r\n\t"):
+		return errors.New("name must not have leading, trailing or control whitespace")
+	case name == chat.ChatAPIName || chat.IsBotName(name):
+		return errors.New("name is reserved")
+	}
+
+	return nil
+}
+
+func incomingWebhookModel(hk hook.Hook) models.IncomingWebhook {
+	return models.IncomingWebhook{
+		ID:        hk.ID,
+		Room:      hk.Room,
+		Name:      hk.Name,
+		BotName:   chat.BotName(hk.Name),
+		Token:     hk.Token,
+		CreatedAt: hk.CreatedAt,
+	}
+}
+
+// Reload reloads the configuration like SIGHUP does, reporting an invalid one.
+func (h handler) Reload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	log := logger.FromContext(r.Context())
+	log.Info("reloading config")
+
+	if err := h.reloadService.Reload(); err != nil {
+		log.Error("error reloading config, keeping the current one", "error", err)
+		response.JSON(w, r, http.StatusBadRequest, models.Error{Error: err.Error()})
+
+		return
+	}
+
+	log.Info("config reloaded")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decode reads the JSON body into v, answering 400 Bad Request when it is invalid.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return false
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,375 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+	"nhooyr.io/websocket"
+
+	"gochat/cmd/server/models"
+	"gochat/internal/chat"
+	"gochat/internal/config"
+	"gochat/internal/lifecycle"
+	"gochat/internal/reload"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/ban"
+	"gochat/internal/storage/inmemory/hook"
+	inmemoryRoom "gochat/internal/storage/inmemory/room"
+	"gochat/internal/storage/inmemory/user"
+	"gochat/internal/webhook"
+	"gochat/internal/websocket/connection"
+)
+
+const token = "admin-secret"
+
+type conn struct {
+	closed websocket.StatusCode
+}
+
+func (c *conn) Close(code websocket.StatusCode, _ string) error {
+	c.closed = code
+
+	return nil
+}
+
+type fixture struct {
+	handler        AdminHandler
+	userStorage    user.UserStorage
+	banStorage     ban.BanStorage
+	connService    connection.ConnectionService
+	chatService    chat.ChatService
+	webhookService webhook.WebhookService
+	hookStorage    hook.HookStorage
+}
+
+func newFixture(load func() (config.Config, error)) fixture {
+	f := fixture{
+		userStorage: user.New(),
+		banStorage:  ban.New(),
+		connService: connection.New(connection.Limits{}),
+		chatService: chat.New(chat.DefaultHistorySize),
+	}
+	f.hookStorage, _ = hook.New("")
+	f.webhookService, _ = webhook.New(f.chatService, "", "", "")
+
+	f.handler = New(
+		token,
+		f.userStorage,
+		f.banStorage,
+		f.connService,
+		f.chatService,
+		room.New(inmemoryRoom.New(), f.chatService, []string{"moderator"}),
+		lifecycle.New(),
+		reload.New(config.Default(), load),
+		f.webhookService,
+		f.hookStorage,
+	)
+
+	return f
+}
+
+func serve(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	return w
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(nil)
+	next := f.handler.Authenticate(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for header, status := range map[string]int{
+		"":                   http.StatusUnauthorized,
+		"wrong":              http.StatusUnauthorized,
+		token + "x":          http.StatusUnauthorized,
+		token:                http.StatusTeapot,
+		ulid.Make().String(): http.StatusUnauthorized,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+		r.Header.Set(models.BearerToken, header)
+
+		w := httptest.NewRecorder()
+		next(w, r)
+
+		assert.Equal(t, status, w.Code, header)
+	}
+
+	disabled := New("", nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	w := serve(disabled.Authenticate(func(w http.ResponseWriter, r *http.Request) {}), http.MethodGet, "/admin/users", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestUsersAndSessions(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(nil)
+	f.userStorage.Set(ulid.Make(), "user")
+
+	id, err := f.connService.Add(context.Background(), "subscribe", "user", "127.0.0.1:1234")
+	assert.NoError(t, err)
+	c := &conn{}
+	f.connService.Attach(id, c)
+
+	w := serve(f.handler.Users, http.MethodGet, "/admin/users", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"Name":"user","Sessions":1}]`, w.Body.String())
+
+	w = serve(f.handler.Sessions, http.MethodGet, "/admin/sessions", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	sessions := []models.Session{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, id, sessions[0].ID)
+
+	w = serve(f.handler.Sessions, http.MethodDelete, "/admin/sessions/"+id.String(), "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, websocket.StatusPolicyViolation, c.closed)
+
+	w = serve(f.handler.Sessions, http.MethodDelete, "/admin/sessions/"+ulid.Make().String(), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(f.handler.Sessions, http.MethodDelete, "/admin/sessions/invalid", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAnnouncements(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(nil)
+
+	w := serve(f.handler.Announcements, http.MethodPost, "/admin/announcements", `{"Value":"maintenance at noon"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	history := f.chatService.History()
+	assert.Len(t, history, 1)
+	assert.Equal(t, chat.ChatAPIName, history[0].Author)
+	assert.Equal(t, "maintenance at noon", history[0].Message)
+
+	w = serve(f.handler.Announcements, http.MethodPost, "/admin/announcements", `{"Value":" "}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRoom(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(nil)
+	posted := f.chatService.PostMessage(chat.Message{Author: "user", Message: "important"})
+
+	w := serve(f.handler.Room, http.MethodPut, "/admin/room", `{"Topic":"news"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"ID":"general","Topic":"news","Pins":[],"Moderators":["moderator"]}`, w.Body.String())
+
+	w = serve(f.handler.Room, http.MethodPut, "/admin/room", `{"Topic":"`+strings.Repeat("a", room.MaxTopicLength+1)+`"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(f.handler.Pins, http.MethodPost, "/admin/room/pins", `{"MessageID":"`+posted.ID.String()+`"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serve(f.handler.Pins, http.MethodPost, "/admin/room/pins", `{"MessageID":"`+ulid.Make().String()+`"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(f.handler.Room, http.MethodGet, "/admin/room", "")
+	assert.Contains(t, w.Body.String(), `"PinnedBy":"GoChat"`)
+
+	w = serve(f.handler.Pins, http.MethodDelete, "/admin/room/pins/"+posted.ID.String(), "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serve(f.handler.Room, http.MethodGet, "/admin/room", "")
+	assert.Contains(t, w.Body.String(), `"Pins":[]`)
+}
+
+func TestMessages(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(nil)
+	posted := f.chatService.PostMessage(chat.Message{Author: "user", Message: "spam"})
+
+	w := serve(f.handler.Messages, http.MethodDelete, "/admin/messages/"+posted.ID.String(), "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, f.chatService.History())
+
+	w = serve(f.handler.Messages, http.MethodDelete, "/admin/messages/"+posted.ID.String(), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(f.handler.Messages, http.MethodDelete, "/admin/messages/invalid", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWebhooks(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(nil)
+
+	w := serve(f.handler.Webhooks, http.MethodPost, "/admin/webhooks", `{"URL":"https://example.com/hook","Events":["message.posted"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var hook models.Webhook
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	assert.Equal(t, []string{webhook.EventMessagePosted}, hook.Events)
+	assert.NotEmpty(t, hook.Secret)
+
+	w = serve(f.handler.Webhooks, http.MethodPost, "/admin/webhooks", `{"URL":"https://example.com/hook","Events":["message.edited"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"Error":"invalid webhook event"}`, w.Body.String())
+
+	w = serve(f.handler.Webhooks, http.MethodGet, "/admin/webhooks", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"URL":"https://example.com/hook"`)
+	assert.NotContains(t, w.Body.String(), hook.Secret)
+
+	w = serve(f.handler.Webhooks, http.MethodDelete, "/admin/webhooks/"+hook.ID.String(), "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, f.webhookService.List())
+
+	w = serve(f.handler.Webhooks, http.MethodDelete, "/admin/webhooks/"+hook.ID.String(), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestIncomingWebhooks(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(nil)
+
+	w := serve(f.handler.IncomingWebhooks, http.MethodPost, "/admin/incoming-webhooks", `{"Name":"CI"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created models.IncomingWebhook
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "general", created.Room)
+	assert.Equal(t, "CI [bot]", created.BotName)
+	assert.Len(t, created.Token, 64)
+
+	hk, ok := f.hookStorage.Get(created.Token)
+	assert.True(t, ok)
+	assert.Equal(t, "CI", hk.Name)
+
+	for _, body := range []string{
+		`{"Name":"CI","Room":"random"}`,
+		`{"Name":""}`,
+		`{"Name":" CI"}`,
+		`{"Name":"line\nbreak"}`,
+		`{"Name":"` + strings.Repeat("a", MaxBotNameLength+1) + `"}`,
+		`{"Name":"GoChat"}`,
+		`{"Name":"CI [bot]"}`,
+	} {
+		w = serve(f.handler.IncomingWebhooks, http.MethodPost, "/admin/incoming-webhooks", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	w = serve(f.handler.IncomingWebhooks, http.MethodGet, "/admin/incoming-webhooks", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"Name":"CI","BotName":"CI [bot]"`)
+	assert.NotContains(t, w.Body.String(), created.Token)
+
+	w = serve(f.handler.IncomingWebhooks, http.MethodDelete, "/admin/incoming-webhooks/"+created.ID.String(), "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	_, ok = f.hookStorage.Get(created.Token)
+	assert.False(t, ok)
+
+	w = serve(f.handler.IncomingWebhooks, http.MethodDelete, "/admin/incoming-webhooks/"+created.ID.String(), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestIncomingWebhooksNotSaved(t *testing.T) {
+	t.Parallel()
+
+	hookStorage, err := hook.New(filepath.Join(t.TempDir(), "missing", "hooks.json"))
+	assert.NoError(t, err)
+	h := handler{hookStorage: hookStorage}
+
+	w := serve(h.IncomingWebhooks, http.MethodPost, "/admin/incoming-webhooks", `{"Name":"CI"}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, hookStorage.List())
+}
+
+func TestBans(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(nil)
+	userToken := ulid.Make()
+	f.userStorage.Set(userToken, "spammer")
+
+	id, err := f.connService.Add(context.Background(), "publish", "spammer", "127.0.0.1:1234")
+	assert.NoError(t, err)
+	c := &conn{}
+	f.connService.Attach(id, c)
+
+	w := serve(f.handler.Bans, http.MethodPost, "/admin/bans", `{"Name":"spammer","Reason":"spam"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.True(t, f.banStorage.Banned("spammer"))
+	assert.Empty(t, f.userStorage.Get(userToken))
+	assert.Equal(t, websocket.StatusPolicyViolation, c.closed)
+
+	w = serve(f.handler.Bans, http.MethodGet, "/admin/bans", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"Name":"spammer","Reason":"spam"`)
+
+	w = serve(f.handler.Bans, http.MethodPost, "/admin/bans", `{"Name":"GoChat"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(f.handler.Bans, http.MethodDelete, "/admin/bans/spammer", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.False(t, f.banStorage.Banned("spammer"))
+
+	w = serve(f.handler.Bans, http.MethodDelete, "/admin/bans/spammer", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(nil)
+	f.userStorage.Set(ulid.Make(), "user")
+	f.chatService.PostMessage(chat.Message{Author: "user", Message: "hello"})
+
+	_, err := f.connService.Add(context.Background(), "subscribe", "user", "127.0.0.1:1234")
+	assert.NoError(t, err)
+
+	w := serve(f.handler.Stats, http.MethodGet, "/admin/stats", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stats models.Stats
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 1, stats.Users)
+	assert.Equal(t, map[string]int{"subscribe": 1}, stats.Sessions)
+	assert.Equal(t, 1, stats.History)
+	assert.Positive(t, stats.Goroutines)
+	assert.False(t, stats.Draining)
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(func() (config.Config, error) {
+		return config.Default(), nil
+	})
+
+	w := serve(f.handler.Reload, http.MethodPost, "/admin/reload", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serve(f.handler.Reload, http.MethodGet, "/admin/reload", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	f = newFixture(func() (config.Config, error) {
+		return config.Config{}, assert.AnError
+	})
+
+	w = serve(f.handler.Reload, http.MethodPost, "/admin/reload", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), assert.AnError.Error())
+}
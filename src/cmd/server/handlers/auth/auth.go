@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/oklog/ulid/v2"
+
+	"gochat/cmd/server/models"
+	"gochat/internal/metrics"
+	"gochat/internal/storage/inmemory/user"
+)
+
+var authFailures = metrics.Default.Counter("gochat_auth_failures_total", "Requests with a missing or unknown token.", "endpoint")
+
+// Authenticate resolves the bearer token of the request to a joined user, failures being counted
+// for the endpoint.
+func Authenticate(r *http.Request, endpoint string, userStorage user.UserStorage) (ulid.ULID, string, bool) {
+	return AuthenticateToken(r.Header.Get(models.BearerToken), endpoint, userStorage)
+}
+
+// AuthenticateToken resolves a token to a joined user, failures being counted for the endpoint.
+// Endpoints are fixed names rather than request paths, keeping the metric cardinality bounded.
+func AuthenticateToken(value, endpoint string, userStorage user.UserStorage) (ulid.ULID, string, bool) {
+	token, err := ulid.Parse(value)
+	if err != nil {
+		authFailures.Inc(endpoint)
+
+		return ulid.ULID{}, "", false
+	}
+
+	user := userStorage.Get(token)
+	if len(user) < 1 {
+		authFailures.Inc(endpoint)
+
+		return ulid.ULID{}, "", false
+	}
+
+	return token, user, true
+}
@@ -2,71 +2,140 @@ package chat
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/oklog/ulid/v2"
 	"nhooyr.io/websocket"
-	"nhooyr.io/websocket/wsjson"
 
+	"gochat/cmd/server/handlers/auth"
 	"gochat/cmd/server/models"
 	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/origin"
+	"gochat/internal/poll"
+	"gochat/internal/ratelimit"
+	"gochat/internal/receipt"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/mention"
 	"gochat/internal/storage/inmemory/user"
+	"gochat/internal/tracing"
 	"gochat/internal/websocket/connection"
+	"gochat/internal/websocket/heartbeat"
 )
 
+// Endpoints registered with the connection service.
+const (
+	EndpointPublish   = "publish"
+	EndpointSubscribe = "subscribe"
+	EndpointEvents    = "events"
+	EndpointPoll      = "poll"
+)
+
+var closes = metrics.Default.Counter("gochat_websocket_closes_total", "Closed websocket connections by close code.", "endpoint", "code")
+
 type ChatHandler interface {
 	Publish(w http.ResponseWriter, r *http.Request)
 	Subscribe(w http.ResponseWriter, r *http.Request)
+	Events(w http.ResponseWriter, r *http.Request)
+	Poll(w http.ResponseWriter, r *http.Request)
 }
 
 func New(
 	userStorage user.UserStorage,
+	mentionStorage mention.MentionStorage,
 	connService connection.ConnectionService,
 	chatService chat.ChatService,
+	receiptService receipt.ReceiptService,
+	roomService room.RoomService,
+	lifecycleService lifecycle.LifecycleService,
+	originService origin.OriginService,
+	pollService poll.PollService,
+	heartbeat *heartbeat.Settings,
+	rateLimit *ratelimit.Settings,
 ) ChatHandler {
 	return handler{
-		userStorage: userStorage,
-		connService: connService,
-		chatService: chatService,
+		userStorage:      userStorage,
+		mentionStorage:   mentionStorage,
+		connService:      connService,
+		chatService:      chatService,
+		receiptService:   receiptService,
+		roomService:      roomService,
+		lifecycleService: lifecycleService,
+		originService:    originService,
+		pollService:      pollService,
+		heartbeat:        heartbeat,
+		rateLimit:        rateLimit,
 	}
 }
 
 type handler struct {
-	userStorage user.UserStorage
-	connService connection.ConnectionService
-	chatService chat.ChatService
+	userStorage      user.UserStorage
+	mentionStorage   mention.MentionStorage
+	connService      connection.ConnectionService
+	chatService      chat.ChatService
+	receiptService   receipt.ReceiptService
+	roomService      room.RoomService
+	lifecycleService lifecycle.LifecycleService
+	originService    origin.OriginService
+	pollService      poll.PollService
+	heartbeat        *heartbeat.Settings
+	rateLimit        *ratelimit.Settings
 }
 
 func (h handler) Publish(w http.ResponseWriter, r *http.Request) {
-	tokenHeader := r.Header.Get(models.BearerToken)
-	token, err := ulid.Parse(tokenHeader)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+	if !h.originService.Allowed(r) {
+		w.WriteHeader(http.StatusForbidden)
 
 		return
 	}
 
-	user := h.userStorage.Get(token)
-	if len(user) < 1 {
+	token, user, ok := auth.Authenticate(r, EndpointPublish, h.userStorage)
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 
 		return
 	}
 
-	c, err := websocket.Accept(w, r, nil)
+	if h.lifecycleService.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	id, err := h.connService.Add(r.Context(), EndpointPublish, user, r.RemoteAddr)
 	if err != nil {
-		log.Printf("error getting connection: %v\n", err)
+		w.WriteHeader(limitStatus(err))
+
+		return
+	}
+	defer h.connService.Remove(id)
+
+	log := logger.FromContext(r.Context()).With("conn_id", id, "endpoint", EndpointPublish, "user", user)
+
+	c, err := h.accept(w, r)
+	if err != nil {
+		log.Warn("error accepting websocket", "error", err)
 
 		return
 	}
 	defer c.Close(websocket.StatusNormalClosure, "")
 
-	h.connService.Add(c)
+	h.connService.Attach(id, c)
+
+	ctx, cancel := context.WithCancel(logger.NewContext(context.Background(), log))
+	defer cancel()
+
+	go h.keepalive(ctx, c)
+
+	limiter := ratelimit.NewLimiter(h.rateLimit, EndpointPublish)
 
 	// Announce new user.
 	h.chatService.PostMessage(chat.Message{
@@ -75,73 +144,380 @@ func (h handler) Publish(w http.ResponseWriter, r *http.Request) {
 	})
 
 	for {
-		var msg models.Message
-		err := wsjson.Read(context.Background(), c, &msg)
-		if err != nil && !errors.Is(err, io.EOF) {
-			if websocket.CloseStatus(err) == websocket.StatusNormalClosure {
-				h.userStorage.Remove(token)
-
-				// Announce user left.
-				h.chatService.PostMessage(chat.Message{
-					Author:  chat.ChatAPIName,
-					Message: fmt.Sprintf("%s has left the chat!", user),
-				})
-
-				return
+		msgCtx, span, data, err := h.read(ctx, c)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				log.Info("closing idle connection")
+			} else if !closedNormally(err) {
+				log.Warn("error reading message", "error", err)
 			}
 
-			log.Printf("error reading message: %s\n", err)
+			closes.Inc(EndpointPublish, closeCode(err))
+
+			break
+		}
+
+		h.connService.Record(id, len(data))
+
+		if !limiter.Allow() {
+			log.Debug("dropping message over the rate limit")
+			span.End()
+
+			continue
 		}
 
+		_, validateSpan := tracing.Start(msgCtx, "message.validate")
+		var msg models.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Warn("error unmarshalling message", "error", err)
+
+			validateSpan.RecordError(err)
+			validateSpan.End()
+			span.End()
+
+			continue
+		}
+		validateSpan.SetAttributes("message.type", msg.Type)
+		validateSpan.End()
+
+		h.handle(log, user, msg, span.TraceParent())
+		span.End()
+	}
+
+	h.userStorage.Remove(token)
+
+	// Announce user left.
+	h.chatService.PostMessage(chat.Message{
+		Author:  chat.ChatAPIName,
+		Message: fmt.Sprintf("%s has left the chat!", user),
+	})
+}
+
+// read reads the next message. Once the message starts arriving, a publish span is started and the
+// read itself is traced as its child.
+func (h handler) read(ctx context.Context, c *websocket.Conn) (context.Context, *tracing.Span, []byte, error) {
+	readCtx, cancelRead := heartbeat.ReadContext(ctx, h.heartbeat.Load())
+	defer cancelRead()
+
+	_, r, err := c.Reader(readCtx)
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+
+	msgCtx, span := tracing.Start(ctx, "chat.publish")
+	_, readSpan := tracing.Start(msgCtx, "websocket.read")
+	defer readSpan.End()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		readSpan.RecordError(err)
+		span.End()
+
+		return ctx, nil, nil, err
+	}
+	readSpan.SetAttributes("bytes", len(data))
+
+	return msgCtx, span, data, nil
+}
+
+// handle acts on a published message, posting chat messages in the trace of traceParent.
+func (h handler) handle(log *logger.Logger, user string, msg models.Message, traceParent string) {
+	switch msg.Type {
+	case models.TypeAddReaction:
+		if err := h.chatService.AddReaction(msg.ID, msg.Value, user); err != nil {
+			log.Warn("error adding reaction", "message_id", msg.ID, "error", err)
+		}
+	case models.TypeRemoveReaction:
+		if err := h.chatService.RemoveReaction(msg.ID, msg.Value, user); err != nil {
+			log.Warn("error removing reaction", "message_id", msg.ID, "error", err)
+		}
+	case models.TypeRead:
+		if err := h.receiptService.MarkRead(user, msg.Conversation, msg.ID); err != nil {
+			log.Warn("error marking message read", "message_id", msg.ID, "error", err)
+		}
+	case models.TypeSetTopic:
+		if err := h.roomService.SetTopic(user, msg.Value); err != nil {
+			log.Warn("error setting topic", "topic", msg.Value, "error", err)
+		}
+	case models.TypeAddPin:
+		if err := h.roomService.Pin(user, msg.ID); err != nil {
+			log.Warn("error pinning message", "message_id", msg.ID, "error", err)
+		}
+	case models.TypeRemovePin:
+		if err := h.roomService.Unpin(user, msg.ID); err != nil {
+			log.Warn("error unpinning message", "message_id", msg.ID, "error", err)
+		}
+	default:
 		// Announce user message.
-		h.chatService.PostMessage(chat.Message{
-			Author:  msg.Author,
-			Message: msg.Value,
+		posted := h.chatService.PostMessage(chat.Message{
+			Author:      user,
+			Message:     msg.Value,
+			TraceParent: traceParent,
+		})
+
+		NotifyMentions(h.userStorage, h.mentionStorage, h.chatService, posted)
+	}
+}
+
+// NotifyMentions stores the message in the inbox of every mentioned user and notifies them directly.
+func NotifyMentions(userStorage user.UserStorage, mentionStorage mention.MentionStorage, chatService chat.ChatService, msg chat.Message) {
+	for _, username := range chat.Mentions(msg.Message) {
+		if username == msg.Author {
+			continue
+		}
+
+		if _, err := userStorage.FindTokenByUsername(username); err != nil {
+			continue
+		}
+
+		mentionStorage.Add(username, mention.Mention{
+			MessageID: msg.ID,
+			Author:    msg.Author,
+			Message:   msg.Message,
+		})
+
+		chatService.PostMessage(chat.Message{
+			ID:        msg.ID,
+			Type:      chat.TypeMention,
+			Author:    msg.Author,
+			Message:   msg.Message,
+			Recipient: username,
 		})
 	}
 }
 
 func (h handler) Subscribe(w http.ResponseWriter, r *http.Request) {
-	tokenHeader := r.Header.Get(models.BearerToken)
-	token, err := ulid.Parse(tokenHeader)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+	if !h.originService.Allowed(r) {
+		w.WriteHeader(http.StatusForbidden)
 
 		return
 	}
 
-	user := h.userStorage.Get(token)
-	if len(user) < 1 {
+	_, user, ok := auth.Authenticate(r, EndpointSubscribe, h.userStorage)
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 
 		return
 	}
 
-	c, err := websocket.Accept(w, r, nil)
+	if h.lifecycleService.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	id, err := h.connService.Add(r.Context(), EndpointSubscribe, user, r.RemoteAddr)
 	if err != nil {
-		log.Printf("error getting connection: %v\n", err)
+		w.WriteHeader(limitStatus(err))
+
+		return
+	}
+	defer h.connService.Remove(id)
+
+	log := logger.FromContext(r.Context()).With("conn_id", id, "endpoint", EndpointSubscribe, "user", user)
+
+	c, err := h.accept(w, r)
+	if err != nil {
+		log.Warn("error accepting websocket", "error", err)
 
 		return
 	}
 	defer c.Close(websocket.StatusNormalClosure, "")
 
-	h.connService.Add(c)
+	h.connService.Attach(id, c)
 
-	for msg := range h.chatService.Subscribe() {
-		msg := msg
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	// Subscribe connection is write only, reading in background handles pongs and close frames.
+	ctx, cancel := context.WithCancel(c.CloseRead(logger.NewContext(context.Background(), log)))
+	defer cancel()
 
-		err := wsjson.Write(ctx, c, models.Message{
-			Author: msg.Author,
-			Value:  msg.Message,
-		})
-		cancel()
-		if err != nil {
-			if websocket.CloseStatus(err) == websocket.StatusNormalClosure {
-				return
+	go h.keepalive(ctx, c)
+
+	// Subscribing before taking the replay loses no message, the replayed ones being skipped.
+	messages := h.chatService.Subscribe(ctx, user)
+	replay := h.replay(ulid.ULID{})
+	last := chat.LastID(replay)
+
+	for _, msg := range replay {
+		if err := h.write(id, c, msg); err != nil {
+			log.Warn("error sending history", "error", err)
+
+			break
+		}
+	}
+
+	for msg := range messages {
+		if chat.Replayed(msg, last) {
+			continue
+		}
+
+		if err := h.deliver(id, c, msg); err != nil {
+			if !closedNormally(err) {
+				log.Warn("error sending message", "error", err)
 			}
 
-			log.Printf("error sending message: %s\n", err)
+			closes.Inc(EndpointSubscribe, closeCode(err))
+
+			return
+		}
+
+		if msg.Type == chat.TypeShutdown {
+			c.Close(websocket.StatusGoingAway, "server restarting")
+			closes.Inc(EndpointSubscribe, closeCode(websocket.CloseError{Code: websocket.StatusGoingAway}))
+
+			return
+		}
+	}
+
+	// The connection was closed while waiting for messages, writing reports how.
+	pingCtx, cancelPing := context.WithTimeout(context.Background(), time.Second)
+	defer cancelPing()
+
+	closes.Inc(EndpointSubscribe, closeCode(c.Ping(pingCtx)))
+}
+
+// replay returns the history posted after the given message ID, including the current reactions
+// state, followed by the room topic and pins, for new subscribers to catch up.
+func (h handler) replay(after ulid.ULID) []chat.Message {
+	replay := []chat.Message{}
+	for _, msg := range h.chatService.History() {
+		if msg.ID.Compare(after) > 0 {
+			replay = append(replay, msg)
 		}
 	}
+
+	metadata := h.roomService.Room()
+	if len(metadata.Topic) > 0 {
+		replay = append(replay, chat.Message{
+			Type:    chat.TypeTopic,
+			Author:  chat.ChatAPIName,
+			Message: metadata.Topic,
+		})
+	}
+
+	for _, p := range metadata.Pins {
+		replay = append(replay, chat.Message{
+			ID:      p.MessageID,
+			Type:    chat.TypePin,
+			Author:  p.Author,
+			Message: p.Message,
+		})
+	}
+
+	return replay
+}
+
+func (h handler) accept(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	return websocket.Accept(w, r, &websocket.AcceptOptions{
+		OriginPatterns: h.originService.Patterns(),
+	})
+}
+
+// keepalive pings the peer and closes the connection when it stops responding.
+func (h handler) keepalive(ctx context.Context, c *websocket.Conn) {
+	if err := heartbeat.Run(ctx, c, h.heartbeat.Load()); err != nil {
+		logger.FromContext(ctx).Info("closing unresponsive connection", "error", err)
+
+		c.Close(websocket.StatusPolicyViolation, "ping timeout")
+	}
+}
+
+// limitStatus maps connection limit errors to HTTP statuses.
+func limitStatus(err error) int {
+	if errors.Is(err, connection.ErrServerLimit) {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusTooManyRequests
+}
+
+// closeCode labels the close status of the connection error, idle connections being closed as
+// policy violations and connections lost without a close frame as abnormal closures.
+func closeCode(err error) string {
+	status := websocket.CloseStatus(err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = websocket.StatusPolicyViolation
+	} else if status < 0 {
+		status = websocket.StatusAbnormalClosure
+	}
+
+	return strconv.Itoa(int(status))
+}
+
+func closedNormally(err error) bool {
+	status := websocket.CloseStatus(err)
+
+	return status == websocket.StatusNormalClosure || status == websocket.StatusGoingAway
+}
+
+// deliver writes a live message to the websocket.
+func (h handler) deliver(id ulid.ULID, c *websocket.Conn, msg chat.Message) error {
+	return TraceDelivery("websocket.write", id, msg, func() error {
+		return h.write(id, c, msg)
+	})
+}
+
+// TraceDelivery traces writing a live message as part of the trace of the message, so the delivery
+// latency to every subscriber can be attributed.
+func TraceDelivery(name string, id ulid.ULID, msg chat.Message, write func() error) error {
+	parent, err := tracing.ParseTraceParent(msg.TraceParent)
+	if err != nil {
+		return write()
+	}
+
+	_, span := tracing.Start(tracing.ContextWithSpanContext(context.Background(), parent), name,
+		"conn_id", id, "message.type", msg.Type)
+	defer span.End()
+
+	err = write()
+	span.RecordError(err)
+
+	return err
+}
+
+func (h handler) write(id ulid.ULID, c *websocket.Conn, msg chat.Message) error {
+	data, err := encode(msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if err := c.Write(ctx, websocket.MessageText, data); err != nil {
+		return err
+	}
+
+	h.connService.Record(id, len(data))
+
+	return nil
+}
+
+// encode marshals the message as sent to subscribers.
+func encode(msg chat.Message) ([]byte, error) {
+	return json.Marshal(Message(msg))
+}
+
+// Message converts the chat message to the model sent to clients.
+func Message(msg chat.Message) models.Message {
+	reactions := make([]models.Reaction, 0, len(msg.Reactions))
+	for _, r := range msg.Reactions {
+		reactions = append(reactions, models.Reaction{
+			Value: r.Value,
+			Count: r.Count,
+			Users: r.Users,
+		})
+	}
+
+	return models.Message{
+		ID:           msg.ID,
+		Type:         msg.Type,
+		Author:       msg.Author,
+		Value:        msg.Message,
+		Reactions:    reactions,
+		Count:        msg.Count,
+		Conversation: msg.Conversation,
+
+		RetryAfter:  int(msg.RetryAfter.Seconds()),
+		TraceParent: msg.TraceParent,
+	}
 }
@@ -0,0 +1,372 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+	"nhooyr.io/websocket"
+
+	"gochat/cmd/server/models"
+	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/origin"
+	"gochat/internal/poll"
+	"gochat/internal/ratelimit"
+	"gochat/internal/receipt"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/mention"
+	inmemoryReceipt "gochat/internal/storage/inmemory/receipt"
+	inmemoryRoom "gochat/internal/storage/inmemory/room"
+	"gochat/internal/storage/inmemory/user"
+	"gochat/internal/tracing"
+	"gochat/internal/websocket/connection"
+	"gochat/internal/websocket/heartbeat"
+)
+
+// server serves the chat handler for a joined user, returning the server, the user token and the
+// chat service.
+func server(t *testing.T, allowedOrigins []string) (*httptest.Server, ulid.ULID, chat.ChatService) {
+	userStorage := user.New()
+	chatService := chat.New(chat.DefaultHistorySize)
+
+	h := New(
+		userStorage,
+		mention.New(),
+		connection.New(connection.Limits{}),
+		chatService,
+		receipt.New(inmemoryReceipt.New(), chatService),
+		room.New(inmemoryRoom.New(), chatService, []string{}),
+		lifecycle.New(),
+		origin.New(allowedOrigins),
+		poll.New(chatService, poll.Timeouts{Poll: time.Second, Session: time.Minute}),
+		heartbeat.NewSettings(heartbeat.Config{}),
+		ratelimit.NewSettings(ratelimit.Config{}),
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/subscribe", h.Subscribe)
+	mux.HandleFunc("/publish", h.Publish)
+	mux.HandleFunc("/events", h.Events)
+	mux.HandleFunc("/poll", h.Poll)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	token := ulid.Make()
+	userStorage.Set(token, "user")
+
+	return srv, token, chatService
+}
+
+func dial(srv *httptest.Server, token ulid.ULID, endpoint, requestOrigin string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	header := http.Header{models.BearerToken: []string{token.String()}}
+	if len(requestOrigin) > 0 {
+		header.Set("Origin", requestOrigin)
+	}
+
+	c, res, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+endpoint, &websocket.DialOptions{
+		HTTPHeader: header,
+	})
+	if err != nil {
+		if res == nil {
+			return 0, err
+		}
+
+		return res.StatusCode, err
+	}
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	return res.StatusCode, nil
+}
+
+func TestCrossSiteUpgrade(t *testing.T) {
+	t.Parallel()
+
+	for _, endpoint := range []string{"/subscribe", "/publish"} {
+		// Closing a publish connection leaves the chat, so every upgrade joins anew.
+		srv, token, _ := server(t, []string{})
+
+		status, err := dial(srv, token, endpoint, "https://evil.test")
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, status)
+
+		status, err = dial(srv, token, endpoint, srv.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusSwitchingProtocols, status)
+
+		srv, token, _ = server(t, []string{})
+
+		status, err = dial(srv, token, endpoint, "")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusSwitchingProtocols, status)
+	}
+}
+
+func TestAllowedOriginUpgrade(t *testing.T) {
+	t.Parallel()
+
+	srv, token, _ := server(t, []string{"*.example.com"})
+
+	status, err := dial(srv, token, "/subscribe", "https://app.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, status)
+
+	status, err = dial(srv, token, "/subscribe", "https://example.com.evil.test")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+type exporter struct {
+	spans chan tracing.SpanData
+}
+
+func (e exporter) Export(_ context.Context, spans []tracing.SpanData) error {
+	for _, span := range spans {
+		e.spans <- span
+	}
+
+	return nil
+}
+
+func (e exporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// TestTracedMessage sets the exporter of the default tracer, so it does not run in parallel.
+func TestTracedMessage(t *testing.T) {
+	e := exporter{spans: make(chan tracing.SpanData, 100)}
+	tracing.Default.SetExporter(e)
+
+	srv, token, _ := server(t, []string{})
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	options := &websocket.DialOptions{HTTPHeader: http.Header{models.BearerToken: []string{token.String()}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, _, err := websocket.Dial(ctx, url+"/subscribe", options)
+	assert.NoError(t, err)
+	defer sub.Close(websocket.StatusNormalClosure, "")
+
+	pub, _, err := websocket.Dial(ctx, url+"/publish", options)
+	assert.NoError(t, err)
+	defer pub.Close(websocket.StatusNormalClosure, "")
+
+	data, _ := json.Marshal(models.Message{Type: models.TypeMessage, Author: "user", Value: "hello"})
+	assert.NoError(t, pub.Write(ctx, websocket.MessageText, data))
+
+	var received models.Message
+	for received.Value != "hello" {
+		_, data, err = sub.Read(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(data, &received))
+	}
+
+	traceParent, err := tracing.ParseTraceParent(received.TraceParent)
+	assert.NoError(t, err)
+
+	// Spans are exported in batches, every span of the message trace is waited for.
+	names := []string{"chat.publish", "websocket.read", "message.validate", "chat.post", "chat.store", "chat.fanout", "websocket.write"}
+	spans := map[string]tracing.SpanData{}
+	for len(spans) < len(names) {
+		select {
+		case span := <-e.spans:
+			if span.TraceID == traceParent.TraceID {
+				spans[span.Name] = span
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for spans")
+		}
+	}
+
+	assert.NoError(t, tracing.Default.Shutdown(ctx))
+
+	for _, name := range names {
+		assert.Contains(t, spans, name)
+	}
+
+	assert.Equal(t, spans["chat.publish"].SpanID, spans["chat.post"].ParentSpanID)
+	assert.Equal(t, spans["chat.post"].SpanID, spans["websocket.write"].ParentSpanID)
+	assert.Equal(t, traceParent.SpanID, spans["chat.post"].SpanID)
+}
+
+func TestSpoofedAuthor(t *testing.T) {
+	t.Parallel()
+
+	srv, token, chatService := server(t, []string{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pub, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/publish", &websocket.DialOptions{
+		HTTPHeader: http.Header{models.BearerToken: []string{token.String()}},
+	})
+	assert.NoError(t, err)
+	defer pub.Close(websocket.StatusNormalClosure, "")
+
+	// The author sent by the client is ignored, messages are posted as the authenticated user.
+	data, _ := json.Marshal(models.Message{Type: models.TypeMessage, Author: chat.BotName("CI"), Value: "spoofed"})
+	assert.NoError(t, pub.Write(ctx, websocket.MessageText, data))
+
+	assert.Eventually(t, func() bool {
+		for _, msg := range chatService.History() {
+			if msg.Message == "spoofed" {
+				return msg.Author == "user"
+			}
+		}
+
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// events reads the data of the first count events of the stream, resuming after lastEventID.
+func events(t *testing.T, srv *httptest.Server, token ulid.ULID, lastEventID string, count int) ([]models.Message, []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events", nil)
+	assert.NoError(t, err)
+	r.Header.Set(models.BearerToken, token.String())
+	if len(lastEventID) > 0 {
+		r.Header.Set(HeaderLastEventID, lastEventID)
+	}
+
+	res, err := srv.Client().Do(r)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	messages := []models.Message{}
+	ids := []string{}
+	scanner := bufio.NewScanner(res.Body)
+	for len(messages) < count && scanner.Scan() {
+		line := scanner.Text()
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		}
+
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var msg models.Message
+			assert.NoError(t, json.Unmarshal([]byte(data), &msg))
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages, ids
+}
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+
+	srv, token, chatService := server(t, []string{})
+
+	first := chatService.PostMessage(chat.Message{Author: "user", Message: "first"})
+	chatService.PostMessage(chat.Message{Author: "user", Message: "second"})
+
+	messages, ids := events(t, srv, token, "", 2)
+	assert.Equal(t, "first", messages[0].Value)
+	assert.Equal(t, "second", messages[1].Value)
+	assert.Equal(t, []string{first.ID.String(), messages[1].ID.String()}, ids)
+
+	// Resuming replays the messages after the last event ID only.
+	messages, _ = events(t, srv, token, first.ID.String(), 1)
+	assert.Equal(t, "second", messages[0].Value)
+
+	res, err := http.Get(srv.URL + "/events")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestEventsLive(t *testing.T) {
+	t.Parallel()
+
+	srv, token, chatService := server(t, []string{})
+
+	go func() {
+		// Messages are posted once the stream is subscribed, retrying until then.
+		for i := 0; i < 100; i++ {
+			if len(chatService.Queued()) > 0 {
+				chatService.PostMessage(chat.Message{Author: "user", Message: "live"})
+
+				return
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	messages, ids := events(t, srv, token, "", 1)
+	assert.Equal(t, "live", messages[0].Value)
+	assert.Equal(t, []string{messages[0].ID.String()}, ids)
+}
+
+// longPoll polls the server with the cursor, returning the status and the poll result.
+func longPoll(t *testing.T, srv *httptest.Server, token ulid.ULID, query string) (int, models.Poll) {
+	r, err := http.NewRequest(http.MethodGet, srv.URL+"/poll"+query, nil)
+	assert.NoError(t, err)
+	r.Header.Set(models.BearerToken, token.String())
+
+	res, err := srv.Client().Do(r)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	var result models.Poll
+	if res.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+	}
+
+	return res.StatusCode, result
+}
+
+func TestPoll(t *testing.T) {
+	t.Parallel()
+
+	srv, token, chatService := server(t, []string{})
+
+	chatService.PostMessage(chat.Message{Author: "user", Message: "history"})
+
+	status, result := longPoll(t, srv, token, "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, result.Messages, 1)
+	assert.Equal(t, "history", result.Messages[0].Value)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		chatService.PostMessage(chat.Message{Author: "user", Message: "live"})
+	}()
+
+	status, result = longPoll(t, srv, token, "?cursor="+result.Cursor)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, result.Messages, 1)
+	assert.Equal(t, "live", result.Messages[0].Value)
+
+	// Polls time out empty, keeping the cursor.
+	cursor := result.Cursor
+	status, result = longPoll(t, srv, token, "?cursor="+cursor)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, result.Messages)
+	assert.Equal(t, cursor, result.Cursor)
+
+	status, _ = longPoll(t, srv, token, "?cursor=invalid")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = longPoll(t, srv, token, "?cursor="+ulid.Make().String()+"-1")
+	assert.Equal(t, http.StatusGone, status)
+
+	status, _ = longPoll(t, srv, ulid.Make(), "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"nhooyr.io/websocket"
+
+	"gochat/cmd/server/handlers/auth"
+	"gochat/internal/chat"
+	"gochat/internal/logger"
+)
+
+// HeaderLastEventID carries the ID of the last message received by a reconnecting event stream.
+const HeaderLastEventID = "Last-Event-ID"
+
+// request lets the connection service close event streams and waiting polls like websocket
+// connections, by cancelling them.
+type request struct {
+	cancel context.CancelFunc
+}
+
+func (r request) Close(websocket.StatusCode, string) error {
+	r.cancel()
+
+	return nil
+}
+
+// Events streams the same events as Subscribe as Server-Sent Events, for clients behind proxies
+// that do not pass websocket upgrades. Chat messages carry their ID as the event ID, so a client
+// reconnecting with Last-Event-ID only gets the messages it missed from history.
+func (h handler) Events(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	_, user, ok := auth.Authenticate(r, EndpointEvents, h.userStorage)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	var lastEventID ulid.ULID
+	if v := r.Header.Get(HeaderLastEventID); len(v) > 0 {
+		var err error
+		if lastEventID, err = ulid.Parse(v); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	if h.lifecycleService.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	id, err := h.connService.Add(r.Context(), EndpointEvents, user, r.RemoteAddr)
+	if err != nil {
+		w.WriteHeader(limitStatus(err))
+
+		return
+	}
+	defer h.connService.Remove(id)
+
+	log := logger.FromContext(r.Context()).With("conn_id", id, "endpoint", EndpointEvents, "user", user)
+
+	ctx, cancel := context.WithCancel(logger.NewContext(r.Context(), log))
+	defer cancel()
+
+	h.connService.Attach(id, request{cancel: cancel})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keeps reverse proxies such as nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Subscribing before taking the replay loses no message, the replayed ones being skipped.
+	messages := h.chatService.Subscribe(ctx, user)
+	replay := h.replay(lastEventID)
+	last := chat.LastID(replay)
+
+	for _, msg := range replay {
+		if err := h.writeEvent(id, w, flusher, msg); err != nil {
+			log.Warn("error sending history", "error", err)
+
+			return
+		}
+	}
+
+	// Comments keep idle streams from being timed out by proxies.
+	var keepalive <-chan time.Time
+	if interval := h.heartbeat.Load().Interval; interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		keepalive = ticker.C
+	}
+
+	for {
+		select {
+		case <-keepalive:
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			if chat.Replayed(msg, last) {
+				continue
+			}
+
+			err := TraceDelivery("sse.write", id, msg, func() error {
+				return h.writeEvent(id, w, flusher, msg)
+			})
+			if err != nil {
+				log.Info("error sending event", "error", err)
+
+				return
+			}
+
+			if msg.Type == chat.TypeShutdown {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes the message as an event. Only chat messages get an event ID, the IDs carried by
+// other events referring to older messages.
+func (h handler) writeEvent(id ulid.ULID, w http.ResponseWriter, flusher http.Flusher, msg chat.Message) error {
+	data, err := encode(msg)
+	if err != nil {
+		return err
+	}
+
+	var event bytes.Buffer
+	if msg.Type == chat.TypeMessage {
+		fmt.Fprintf(&event, "id: %s\n", msg.ID)
+	}
+
+	if msg.RetryAfter > 0 {
+		fmt.Fprintf(&event, "retry: %d\n", msg.RetryAfter.Milliseconds())
+	}
+
+	fmt.Fprintf(&event, "data: %s\n\n", data)
+
+	if _, err := w.Write(event.Bytes()); err != nil {
+		return err
+	}
+	flusher.Flush()
+
+	h.connService.Record(id, len(data))
+
+	return nil
+}
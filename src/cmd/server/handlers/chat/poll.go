@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/oklog/ulid/v2"
+
+	"gochat/cmd/server/handlers/auth"
+	"gochat/cmd/server/models"
+	"gochat/internal/chat"
+	"gochat/internal/logger"
+	"gochat/internal/poll"
+)
+
+// Poll returns the same events as Subscribe to clients that can only make plain HTTP requests,
+// waiting until events arrive or the poll timeout passes. A poll without cursor opens a session
+// starting with the history, and every poll acknowledges the events up to its cursor. Sessions not
+// polled within the session timeout are closed, so a lost cursor gets 410 Gone.
+func (h handler) Poll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	_, user, ok := auth.Authenticate(r, EndpointPoll, h.userStorage)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	var cursor poll.Cursor
+	resume := r.URL.Query().Has("cursor")
+	if resume {
+		var err error
+		if cursor, err = poll.ParseCursor(r.URL.Query().Get("cursor")); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	// Open sessions are still polled while draining, for their clients to get the shutdown event.
+	if !resume && h.lifecycleService.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	id, err := h.connService.Add(r.Context(), EndpointPoll, user, r.RemoteAddr)
+	if err != nil {
+		w.WriteHeader(limitStatus(err))
+
+		return
+	}
+	defer h.connService.Remove(id)
+
+	log := logger.FromContext(r.Context()).With("conn_id", id, "endpoint", EndpointPoll, "user", user)
+
+	ctx, cancel := context.WithCancel(logger.NewContext(r.Context(), log))
+	defer cancel()
+
+	h.connService.Attach(id, request{cancel: cancel})
+
+	if !resume {
+		cursor = h.pollService.Open(ctx, user, func() []chat.Message {
+			return h.replay(ulid.ULID{})
+		})
+	}
+
+	messages, next, err := h.pollService.Poll(ctx, user, cursor)
+	if errors.Is(err, poll.ErrNotFound) {
+		w.WriteHeader(http.StatusGone)
+
+		return
+	} else if err != nil {
+		log.Info("poll cancelled", "error", err)
+
+		return
+	}
+
+	result := models.Poll{
+		Messages: make([]models.Message, 0, len(messages)),
+		Cursor:   next.String(),
+	}
+
+	for _, msg := range messages {
+		result.Messages = append(result.Messages, Message(msg))
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Error("error marshalling poll", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	write := func() error {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+
+		_, err := w.Write(data)
+
+		return err
+	}
+
+	// The single response write delivers every message, so it is traced as part of all of them.
+	for _, msg := range messages {
+		msg, next := msg, write
+		write = func() error {
+			return TraceDelivery("poll.write", id, msg, next)
+		}
+	}
+
+	if err := write(); err != nil {
+		log.Info("error sending poll", "error", err)
+
+		return
+	}
+
+	h.connService.Record(id, len(data))
+}
@@ -0,0 +1,66 @@
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gochat/cmd/server/models"
+	"gochat/internal/origin"
+)
+
+// MaxAge is how long browsers may cache preflight responses.
+const MaxAge = 600
+
+var (
+	allowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	allowedHeaders = []string{models.BearerToken, "Content-Type"}
+)
+
+type CORSHandler interface {
+	Handle(next http.HandlerFunc) http.HandlerFunc
+}
+
+func New(originService origin.OriginService) CORSHandler {
+	return &handler{
+		originService: originService,
+	}
+}
+
+type handler struct {
+	originService origin.OriginService
+}
+
+// Handle rejects requests from origins that are not allowed, answers preflight requests and adds
+// CORS headers to cross-origin responses.
+func (h handler) Handle(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+
+		requestOrigin := r.Header.Get("Origin")
+		if len(requestOrigin) < 1 {
+			next(w, r)
+
+			return
+		}
+
+		if !h.originService.Allowed(r) {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", requestOrigin)
+
+		if r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(MaxAge))
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		next(w, r)
+	}
+}
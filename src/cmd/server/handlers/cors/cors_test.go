@@ -0,0 +1,66 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/origin"
+)
+
+var originService = origin.New([]string{"app.example.com"})
+
+func serve(requestOrigin, method string, headers map[string]string) *httptest.ResponseRecorder {
+	h := New(originService)
+
+	r := httptest.NewRequest(method, "http://chat.local/join", nil)
+	if len(requestOrigin) > 0 {
+		r.Header.Set("Origin", requestOrigin)
+	}
+
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	h.Handle(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})(w, r)
+
+	return w
+}
+
+func TestHandle(t *testing.T) {
+	t.Parallel()
+
+	w := serve("", http.MethodPost, nil)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = serve("https://app.example.com", http.MethodPost, nil)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = serve("https://evil.test", http.MethodPost, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestPreflight(t *testing.T) {
+	t.Parallel()
+
+	w := serve("https://app.example.com", http.MethodOptions, map[string]string{
+		"Access-Control-Request-Method": http.MethodPost,
+	})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Bearer, Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+
+	w = serve("https://evil.test", http.MethodOptions, map[string]string{
+		"Access-Control-Request-Method": http.MethodPost,
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,56 @@
+package health
+
+import (
+	"net/http"
+
+	"gochat/cmd/server/handlers/response"
+	"gochat/cmd/server/models"
+	"gochat/internal/health"
+)
+
+type HealthHandler interface {
+	Healthz(w http.ResponseWriter, r *http.Request)
+	Readyz(w http.ResponseWriter, r *http.Request)
+}
+
+func New(healthService health.HealthService) HealthHandler {
+	return &handler{
+		healthService: healthService,
+	}
+}
+
+type handler struct {
+	healthService health.HealthService
+}
+
+// Healthz reports the server is alive as long as it serves requests.
+func (h handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, r, http.StatusOK, models.Health{
+		Status: models.StatusOK,
+	})
+}
+
+// Readyz reports whether the server can take traffic, with the result of every readiness check.
+func (h handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.healthService.Ready()
+
+	health := models.Health{
+		Status: models.StatusOK,
+		Checks: map[string]string{},
+	}
+
+	for name, err := range report.Checks {
+		health.Checks[name] = models.StatusOK
+		if err != nil {
+			health.Checks[name] = err.Error()
+		}
+	}
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+		health.Status = models.StatusNotReady
+	}
+
+	response.JSON(w, r, status, health)
+}
@@ -0,0 +1,48 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/health"
+)
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+
+	ready := New(health.New(health.DefaultTimeout, map[string]health.Check{
+		"storage": func() error {
+			return nil
+		},
+	}))
+	notReady := New(health.New(health.DefaultTimeout, map[string]health.Check{
+		"storage": func() error {
+			return nil
+		},
+		"lifecycle": func() error {
+			return assert.AnError
+		},
+	}))
+
+	for _, tc := range []struct {
+		name    string
+		handler func(w http.ResponseWriter, r *http.Request)
+		status  int
+		result  string
+	}{
+		{"healthz", ready.Healthz, http.StatusOK, `{"Status":"ok"}`},
+		{"healthz not ready", notReady.Healthz, http.StatusOK, `{"Status":"ok"}`},
+		{"readyz", ready.Readyz, http.StatusOK, `{"Status":"ok","Checks":{"storage":"ok"}}`},
+		{"readyz not ready", notReady.Readyz, http.StatusServiceUnavailable, `{"Status":"not ready","Checks":{"storage":"ok","lifecycle":"` + assert.AnError.Error() + `"}}`},
+	} {
+		w := httptest.NewRecorder()
+		tc.handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, tc.status, w.Code, tc.name)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"), tc.name)
+		assert.JSONEq(t, tc.result, w.Body.String(), tc.name)
+	}
+}
@@ -0,0 +1,129 @@
+package hook
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	chatAPI "gochat/cmd/server/handlers/chat"
+	"gochat/cmd/server/handlers/response"
+	"gochat/cmd/server/models"
+	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/ratelimit"
+	"gochat/internal/storage/inmemory/hook"
+	"gochat/internal/storage/inmemory/mention"
+	"gochat/internal/storage/inmemory/user"
+	"gochat/internal/tracing"
+)
+
+// Endpoint names incoming webhooks in traces and metrics.
+const Endpoint = "hook"
+
+// MaxBodySize limits the size of posted payloads in bytes.
+const MaxBodySize = 64 << 10
+
+var hookPosts = metrics.Default.Counter("gochat_incoming_webhook_posts_total", "Messages posted through incoming webhooks.")
+
+// HookHandler lets external systems such as CI post to the chat through incoming webhooks, without
+// joining. Messages are posted as the bot name of the hook.
+type HookHandler interface {
+	Post(w http.ResponseWriter, r *http.Request)
+}
+
+func New(
+	hookStorage hook.HookStorage,
+	userStorage user.UserStorage,
+	mentionStorage mention.MentionStorage,
+	chatService chat.ChatService,
+	lifecycleService lifecycle.LifecycleService,
+	rateLimit *ratelimit.Users,
+) HookHandler {
+	return &handler{
+		hookStorage:      hookStorage,
+		userStorage:      userStorage,
+		mentionStorage:   mentionStorage,
+		chatService:      chatService,
+		lifecycleService: lifecycleService,
+		rateLimit:        rateLimit,
+	}
+}
+
+type handler struct {
+	hookStorage      hook.HookStorage
+	userStorage      user.UserStorage
+	mentionStorage   mention.MentionStorage
+	chatService      chat.ChatService
+	lifecycleService lifecycle.LifecycleService
+	rateLimit        *ratelimit.Users
+}
+
+// Post posts the {"Value": "..."} payload on POST /hooks/{token}, within the message rate limit of
+// the bot name.
+func (h handler) Post(w http.ResponseWriter, r *http.Request) {
+	token := strings.Trim(strings.TrimPrefix(r.URL.Path, "/hooks"), "/")
+	if r.Method != http.MethodPost || len(token) < 1 {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	hk, ok := h.hookStorage.Get(token)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if h.lifecycleService.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	name := chat.BotName(hk.Name)
+	ctx, span := tracing.Start(r.Context(), "chat.publish", "user", name, "endpoint", Endpoint)
+	defer span.End()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodySize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	var p models.Post
+	if err := json.Unmarshal(body, &p); err != nil || len(strings.TrimSpace(p.Value)) < 1 {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	if !h.rateLimit.Allow(name, Endpoint) {
+		w.WriteHeader(http.StatusTooManyRequests)
+
+		return
+	}
+
+	posted := h.chatService.PostMessage(chat.Message{
+		Author:      name,
+		Message:     p.Value,
+		TraceParent: span.TraceParent(),
+	})
+	hookPosts.Inc()
+
+	chatAPI.NotifyMentions(h.userStorage, h.mentionStorage, h.chatService, posted)
+
+	logger.FromContext(ctx).Debug("incoming webhook posted", "hook_id", hk.ID, "message_id", posted.ID)
+
+	response.JSON(w, r, http.StatusCreated, chatAPI.Message(posted))
+}
@@ -0,0 +1,116 @@
+package hook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/ratelimit"
+	"gochat/internal/storage/inmemory/hook"
+	"gochat/internal/storage/inmemory/mention"
+	"gochat/internal/storage/inmemory/user"
+)
+
+type fixture struct {
+	handler          HookHandler
+	chatService      chat.ChatService
+	mentionStorage   mention.MentionStorage
+	lifecycleService lifecycle.LifecycleService
+}
+
+// newFixture serves a hook of the CI bot with the "ci-token" token and a joined user, the bot
+// being allowed a burst of two messages.
+func newFixture() fixture {
+	hookStorage, _ := hook.New("")
+	hookStorage.Add(hook.Hook{ID: ulid.Make(), Token: "ci-token", Room: "general", Name: "CI"})
+
+	userStorage := user.New()
+	userStorage.Set(ulid.Make(), "user")
+
+	f := fixture{
+		chatService:      chat.New(chat.DefaultHistorySize),
+		mentionStorage:   mention.New(),
+		lifecycleService: lifecycle.New(),
+	}
+	rateLimit := ratelimit.NewUsers(ratelimit.NewSettings(ratelimit.Config{Rate: 0.001, Burst: 2}))
+	f.handler = New(hookStorage, userStorage, f.mentionStorage, f.chatService, f.lifecycleService, rateLimit)
+
+	return f
+}
+
+func (f fixture) serve(method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	f.handler.Post(w, r)
+
+	return w
+}
+
+func TestPost(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := f.chatService.Subscribe(ctx, "user")
+
+	w := f.serve(http.MethodPost, "/hooks/ci-token", `{"Value":"build passed, @user"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"Author":"CI [bot]","Value":"build passed, @user"`)
+
+	msg := <-messages
+	assert.Equal(t, "CI [bot]", msg.Author)
+	assert.Equal(t, "build passed, @user", msg.Message)
+	assert.Equal(t, chat.TypeMention, (<-messages).Type)
+
+	history := f.chatService.History()
+	assert.Len(t, history, 1)
+	assert.Equal(t, "CI [bot]", history[0].Author)
+	assert.Len(t, f.mentionStorage.List("user", false), 1)
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture()
+
+	for _, status := range []int{http.StatusCreated, http.StatusCreated, http.StatusTooManyRequests} {
+		w := f.serve(http.MethodPost, "/hooks/ci-token", `{"Value":"build passed"}`)
+		assert.Equal(t, status, w.Code)
+	}
+
+	assert.Len(t, f.chatService.History(), 2)
+}
+
+func TestPostErrors(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture()
+
+	w := f.serve(http.MethodPost, "/hooks/unknown", `{"Value":"hello"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = f.serve(http.MethodGet, "/hooks/ci-token", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = f.serve(http.MethodPost, "/hooks/ci-token", `{"Value":" "}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = f.serve(http.MethodPost, "/hooks/ci-token", `{"Value":"`+strings.Repeat("a", MaxBodySize)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	f.lifecycleService.Drain()
+
+	w = f.serve(http.MethodPost, "/hooks/ci-token", `{"Value":"hello"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	assert.Empty(t, f.chatService.History())
+}
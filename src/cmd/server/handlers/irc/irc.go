@@ -0,0 +1,906 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/oklog/ulid/v2"
+	"nhooyr.io/websocket"
+
+	chatAPI "gochat/cmd/server/handlers/chat"
+	joinAPI "gochat/cmd/server/handlers/join"
+	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/logger"
+	"gochat/internal/ratelimit"
+	"gochat/internal/receipt"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/ban"
+	"gochat/internal/storage/inmemory/mention"
+	"gochat/internal/storage/inmemory/user"
+	"gochat/internal/tracing"
+	"gochat/internal/websocket/connection"
+	"gochat/internal/websocket/heartbeat"
+)
+
+// EndpointIRC is the endpoint of IRC connections in the connection service.
+const EndpointIRC = "irc"
+
+const (
+	// ServerName is the name of the server in IRC replies, and the host of every user.
+	ServerName = "gochat"
+
+	// Channel is the IRC channel of the chat room.
+	Channel = "#" + room.ID
+
+	// RegistrationTimeout is how long a new connection has to register.
+	RegistrationTimeout = 30 * time.Second
+
+	WriteTimeout = 10 * time.Second
+
+	// MaxLineLength is the length of the longest line accepted, clients sending longer lines than
+	// the 512 bytes of the protocol being tolerated up to it.
+	MaxLineLength = 4096
+
+	MaxNickLength = 32
+
+	// maxLine is the length of the lines sent without CRLF, longer messages being split.
+	maxLine = 510
+
+	// minText is the text sent per line at least, for prefixes of long names.
+	minText = 64
+
+	acceptRetryDelay = 100 * time.Millisecond
+)
+
+// Numeric replies of RFC 2812.
+const (
+	rplWelcome           = "001"
+	rplYourHost          = "002"
+	rplMyInfo            = "004"
+	rplISupport          = "005"
+	rplUModeIs           = "221"
+	rplTryAgain          = "263"
+	rplWhoisUser         = "311"
+	rplEndOfWho          = "315"
+	rplEndOfWhois        = "318"
+	rplList              = "322"
+	rplListEnd           = "323"
+	rplChannelModeIs     = "324"
+	rplNoTopic           = "331"
+	rplTopic             = "332"
+	rplWhoReply          = "352"
+	rplNameReply         = "353"
+	rplEndOfNames        = "366"
+	errNoSuchNick        = "401"
+	errNoSuchChannel     = "403"
+	errCannotSendToChan  = "404"
+	errNoRecipient       = "411"
+	errNoTextToSend      = "412"
+	errUnknownCommand    = "421"
+	errNoMotd            = "422"
+	errNoNicknameGiven   = "431"
+	errErroneousNickname = "432"
+	errNicknameInUse     = "433"
+	errNotOnChannel      = "442"
+	errNotRegistered     = "451"
+	errNeedMoreParams    = "461"
+	errAlreadyRegistered = "462"
+	errChanOPrivsNeeded  = "482"
+)
+
+// IRCHandler serves the chat to IRC clients. Registering with NICK and USER joins the chat, the
+// room is the #general channel and PRIVMSG to a nick sends a direct message.
+type IRCHandler interface {
+	Serve(ln net.Listener) error
+}
+
+func New(
+	userStorage user.UserStorage,
+	banStorage ban.BanStorage,
+	mentionStorage mention.MentionStorage,
+	connService connection.ConnectionService,
+	chatService chat.ChatService,
+	receiptService receipt.ReceiptService,
+	roomService room.RoomService,
+	lifecycleService lifecycle.LifecycleService,
+	heartbeat *heartbeat.Settings,
+	rateLimit *ratelimit.Users,
+) IRCHandler {
+	return handler{
+		userStorage:      userStorage,
+		banStorage:       banStorage,
+		mentionStorage:   mentionStorage,
+		connService:      connService,
+		chatService:      chatService,
+		receiptService:   receiptService,
+		roomService:      roomService,
+		lifecycleService: lifecycleService,
+		heartbeat:        heartbeat,
+		rateLimit:        rateLimit,
+	}
+}
+
+type handler struct {
+	userStorage      user.UserStorage
+	banStorage       ban.BanStorage
+	mentionStorage   mention.MentionStorage
+	connService      connection.ConnectionService
+	chatService      chat.ChatService
+	receiptService   receipt.ReceiptService
+	roomService      room.RoomService
+	lifecycleService lifecycle.LifecycleService
+	heartbeat        *heartbeat.Settings
+	rateLimit        *ratelimit.Users
+}
+
+// Serve handles the connections of the listener until it is closed.
+func (h handler) Serve(ln net.Listener) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			logger.Default().Warn("error accepting connection", "endpoint", EndpointIRC, "error", err)
+			time.Sleep(acceptRetryDelay)
+
+			continue
+		}
+
+		go h.handle(c)
+	}
+}
+
+func (h handler) handle(nc net.Conn) {
+	c := &conn{conn: nc, nick: "*"}
+	defer nc.Close()
+
+	log := logger.Default().With("endpoint", EndpointIRC, "remote_addr", nc.RemoteAddr().String())
+
+	lines := bufio.NewScanner(nc)
+	lines.Buffer(make([]byte, 0, 512), MaxLineLength)
+
+	nc.SetReadDeadline(time.Now().Add(RegistrationTimeout))
+	token, ok := h.register(c, lines)
+	if !ok {
+		return
+	}
+
+	id, err := h.connService.Add(context.Background(), EndpointIRC, c.nick, nc.RemoteAddr().String())
+	if err != nil {
+		h.userStorage.Remove(token)
+		c.send("ERROR :Closing link: " + err.Error())
+
+		return
+	}
+	defer h.connService.Remove(id)
+
+	defer func() {
+		h.userStorage.Remove(token)
+
+		// Announce user left.
+		h.chatService.PostMessage(chat.Message{
+			Author:  chat.ChatAPIName,
+			Message: fmt.Sprintf("%s has left the chat!", c.nick),
+		})
+	}()
+
+	c.id = id
+	log = log.With("conn_id", id, "user", c.nick)
+
+	h.connService.Attach(id, c)
+
+	ctx, cancel := context.WithCancel(logger.NewContext(context.Background(), log))
+	defer cancel()
+
+	h.welcome(c)
+
+	messages := h.chatService.Subscribe(ctx, c.nick)
+	go h.deliver(ctx, c, messages)
+	go h.ping(ctx, c)
+
+	// Announce new user.
+	h.chatService.PostMessage(chat.Message{
+		Author:  chat.ChatAPIName,
+		Message: fmt.Sprintf("%s has joined the chat!", c.nick),
+	})
+
+	for {
+		if idle := h.heartbeat.Load().IdleTimeout; idle > 0 {
+			nc.SetReadDeadline(time.Now().Add(idle))
+		} else {
+			nc.SetReadDeadline(time.Time{})
+		}
+
+		if !lines.Scan() {
+			break
+		}
+
+		h.connService.Record(id, len(lines.Bytes()))
+
+		if quit := h.command(ctx, c, parse(lines.Text())); quit {
+			c.send("ERROR :Closing link")
+
+			break
+		}
+	}
+
+	if err := lines.Err(); errors.Is(err, os.ErrDeadlineExceeded) {
+		log.Info("closing idle connection")
+	} else if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Warn("error reading line", "error", err)
+	}
+}
+
+// register handles the registration commands until NICK and USER are given and capability
+// negotiation ended, joining the chat with the nick.
+func (h handler) register(c *conn, lines *bufio.Scanner) (ulid.ULID, bool) {
+	var nick, username, key string
+	negotiating := false
+
+	for lines.Scan() {
+		msg := parse(lines.Text())
+
+		switch msg.Command {
+		case "":
+		case "CAP":
+			switch msg.param(0) {
+			case "LS", "LIST":
+				negotiating = true
+				c.send(":" + ServerName + " CAP * " + msg.param(0) + " :")
+			case "REQ":
+				c.send(":" + ServerName + " CAP * NAK :" + msg.param(1))
+			case "END":
+				negotiating = false
+			}
+		case "PASS":
+			// The password is the moderator key, for moderators to take their nick.
+			key = msg.param(0)
+		case "NICK":
+			if len(msg.Params) < 1 {
+				c.numeric(errNoNicknameGiven, "No nickname given")
+			} else if !validNick(msg.Params[0]) {
+				c.numeric(errErroneousNickname, msg.Params[0], "Erroneous nickname")
+			} else {
+				nick = msg.Params[0]
+			}
+		case "USER":
+			if len(msg.Params) < 4 {
+				c.numeric(errNeedMoreParams, "USER", "Not enough parameters")
+			} else {
+				username = msg.Params[0]
+			}
+		case "PING":
+			c.send(":" + ServerName + " PONG " + ServerName + " :" + msg.param(0))
+		case "QUIT":
+			c.send("ERROR :Closing link")
+
+			return ulid.ULID{}, false
+		default:
+			c.numeric(errNotRegistered, "You have not registered")
+		}
+
+		if len(nick) < 1 || len(username) < 1 || negotiating {
+			continue
+		}
+
+		if h.lifecycleService.Draining() {
+			c.send("ERROR :Closing link: server is shutting down")
+
+			return ulid.ULID{}, false
+		}
+
+		token, err := joinAPI.Register(h.userStorage, h.banStorage, h.roomService, nick, key)
+		switch {
+		case errors.Is(err, joinAPI.ErrBanned):
+			c.send("ERROR :Closing link: banned")
+
+			return ulid.ULID{}, false
+		case errors.Is(err, joinAPI.ErrReservedName):
+			c.numeric(errErroneousNickname, nick, "Nickname is reserved")
+			nick = ""
+		case err != nil:
+			c.numeric(errNicknameInUse, nick, "Nickname is already in use")
+			nick = ""
+		default:
+			c.nick = nick
+
+			return token, true
+		}
+	}
+
+	return ulid.ULID{}, false
+}
+
+func (h handler) welcome(c *conn) {
+	c.numeric(rplWelcome, "Welcome to GoChat, "+c.nick)
+	c.numeric(rplYourHost, "Your host is "+ServerName)
+	c.send(fmt.Sprintf(":%s %s %s %s gochat - -", ServerName, rplMyInfo, c.nick, ServerName))
+	c.send(fmt.Sprintf(":%s %s %s CHANTYPES=# NICKLEN=%d CHANNELLEN=%d :are supported by this server",
+		ServerName, rplISupport, c.nick, MaxNickLength, len(Channel)))
+	c.numeric(errNoMotd, "MOTD File is missing")
+}
+
+// command handles a command of a registered client, returning whether the client quits.
+func (h handler) command(ctx context.Context, c *conn, msg message) bool {
+	switch msg.Command {
+	case "":
+	case "PING":
+		c.send(":" + ServerName + " PONG " + ServerName + " :" + msg.param(0))
+	case "PONG", "CAP":
+	case "PASS", "USER":
+		c.numeric(errAlreadyRegistered, "You may not reregister")
+	case "NICK":
+		c.numeric(errErroneousNickname, msg.param(0), "Nickname changes are not supported")
+	case "JOIN":
+		for _, channel := range strings.Split(msg.param(0), ",") {
+			switch {
+			case channel == "0":
+				h.part(c, Channel)
+			case strings.EqualFold(channel, Channel):
+				h.join(c)
+			case len(channel) < 1:
+				c.numeric(errNeedMoreParams, "JOIN", "Not enough parameters")
+			default:
+				c.numeric(errNoSuchChannel, channel, "No such channel")
+			}
+		}
+	case "PART":
+		for _, channel := range strings.Split(msg.param(0), ",") {
+			h.part(c, channel)
+		}
+	case "PRIVMSG", "NOTICE":
+		h.privmsg(ctx, c, msg)
+	case "NAMES":
+		h.names(c)
+	case "WHO":
+		h.who(c, msg.param(0))
+	case "WHOIS":
+		h.whois(c, msg.param(len(msg.Params)-1))
+	case "TOPIC":
+		h.topic(c, msg)
+	case "LIST":
+		c.numeric(rplList, Channel, fmt.Sprint(len(h.presence())), h.roomService.Room().Topic)
+		c.numeric(rplListEnd, "End of LIST")
+	case "MODE":
+		if strings.EqualFold(msg.param(0), Channel) {
+			c.numeric(rplChannelModeIs, Channel, "+")
+		} else if msg.param(0) == c.nick {
+			c.numeric(rplUModeIs, "+")
+		} else {
+			c.numeric(errNoSuchNick, msg.param(0), "No such nick/channel")
+		}
+	case "QUIT":
+		return true
+	default:
+		c.numeric(errUnknownCommand, msg.Command, "Unknown command")
+	}
+
+	return false
+}
+
+func (h handler) join(c *conn) {
+	if c.joined.Swap(true) {
+		return
+	}
+
+	c.send(":" + c.source() + " JOIN " + Channel)
+
+	if topic := h.roomService.Room().Topic; len(topic) > 0 {
+		c.numeric(rplTopic, Channel, topic)
+	}
+
+	h.names(c)
+}
+
+func (h handler) part(c *conn, channel string) {
+	if !strings.EqualFold(channel, Channel) {
+		c.numeric(errNoSuchChannel, channel, "No such channel")
+
+		return
+	}
+
+	if !c.joined.Swap(false) {
+		c.numeric(errNotOnChannel, Channel, "You're not on that channel")
+
+		return
+	}
+
+	c.send(":" + c.source() + " PART " + Channel)
+}
+
+// privmsg posts messages to the channel and sends messages to nicks as direct messages. NOTICE
+// gets no error replies.
+func (h handler) privmsg(ctx context.Context, c *conn, msg message) {
+	notice := msg.Command == "NOTICE"
+	reply := func(code string, params ...string) {
+		if !notice {
+			c.numeric(code, params...)
+		}
+	}
+
+	target, text := msg.param(0), msg.param(1)
+	if len(target) < 1 {
+		reply(errNoRecipient, "No recipient given ("+msg.Command+")")
+
+		return
+	}
+
+	// Client-to-client queries other than actions are not relayed.
+	if strings.HasPrefix(text, "\x01") {
+		action, ok := strings.CutPrefix(strings.Trim(text, "\x01"), "ACTION ")
+		if !ok {
+			return
+		}
+
+		text = "* " + c.nick + " " + action
+	}
+
+	if len(strings.TrimSpace(text)) < 1 {
+		reply(errNoTextToSend, "No text to send")
+
+		return
+	}
+
+	// Channel messages and direct messages share the limit the user has on every endpoint.
+	if !h.rateLimit.Allow(c.nick, EndpointIRC) {
+		reply(rplTryAgain, msg.Command, "Please wait a while and try again.")
+
+		return
+	}
+
+	if strings.HasPrefix(target, "#") {
+		if !strings.EqualFold(target, Channel) || !c.joined.Load() {
+			reply(errCannotSendToChan, target, "Cannot send to channel")
+
+			return
+		}
+
+		_, span := tracing.Start(ctx, "chat.publish", "user", c.nick, "endpoint", EndpointIRC)
+		defer span.End()
+
+		posted := h.chatService.PostMessage(chat.Message{
+			Author:      c.nick,
+			Message:     text,
+			TraceParent: span.TraceParent(),
+		})
+
+		chatAPI.NotifyMentions(h.userStorage, h.mentionStorage, h.chatService, posted)
+
+		return
+	}
+
+	name := c.nicks.name(target)
+	if _, err := h.userStorage.FindTokenByUsername(name); err != nil {
+		reply(errNoSuchNick, target, "No such nick/channel")
+
+		return
+	}
+
+	h.receiptService.SendDirect(c.nick, name, text)
+}
+
+func (h handler) names(c *conn) {
+	names := []string{}
+	for _, name := range h.presence() {
+		names = append(names, h.nick(c, name))
+	}
+
+	// Names are sent in as many replies as needed to keep lines short.
+	prefix := fmt.Sprintf(":%s %s %s = %s :", ServerName, rplNameReply, c.nick, Channel)
+	for len(names) > 0 {
+		line := prefix + names[0]
+		names = names[1:]
+
+		for len(names) > 0 && len(line)+1+len(names[0]) <= maxLine {
+			line += " " + names[0]
+			names = names[1:]
+		}
+
+		c.send(line)
+	}
+
+	c.numeric(rplEndOfNames, Channel, "End of NAMES list")
+}
+
+func (h handler) who(c *conn, mask string) {
+	for _, name := range h.presence() {
+		nick := h.nick(c, name)
+		if len(mask) > 0 && !strings.EqualFold(mask, Channel) && mask != nick {
+			continue
+		}
+
+		c.numeric(rplWhoReply, Channel, nick, ServerName, ServerName, nick, "H", "0 "+name)
+	}
+
+	c.numeric(rplEndOfWho, mask, "End of WHO list")
+}
+
+func (h handler) whois(c *conn, nick string) {
+	if _, err := h.userStorage.FindTokenByUsername(c.nicks.name(nick)); err != nil {
+		c.numeric(errNoSuchNick, nick, "No such nick/channel")
+	} else {
+		c.numeric(rplWhoisUser, nick, nick, ServerName, "*", nick)
+	}
+
+	c.numeric(rplEndOfWhois, nick, "End of WHOIS list")
+}
+
+// topic replies with the room topic, or sets it when one is given.
+func (h handler) topic(c *conn, msg message) {
+	if !strings.EqualFold(msg.param(0), Channel) {
+		c.numeric(errNoSuchChannel, msg.param(0), "No such channel")
+
+		return
+	}
+
+	if len(msg.Params) < 2 {
+		if topic := h.roomService.Room().Topic; len(topic) > 0 {
+			c.numeric(rplTopic, Channel, topic)
+		} else {
+			c.numeric(rplNoTopic, Channel, "No topic is set")
+		}
+
+		return
+	}
+
+	if err := h.roomService.SetTopic(c.nick, msg.Params[1]); errors.Is(err, room.ErrForbidden) {
+		c.numeric(errChanOPrivsNeeded, Channel, "You're not channel operator")
+	} else if err != nil {
+		c.send(fmt.Sprintf(":%s NOTICE %s :%s", ServerName, c.nick, err))
+	}
+}
+
+// presence returns the users with open connections, in alphabetical order.
+func (h handler) presence() []string {
+	present := map[string]bool{}
+	for _, s := range h.connService.List() {
+		present[s.User] = true
+	}
+
+	users := make([]string, 0, len(present))
+	for u := range present {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+
+	return users
+}
+
+// deliver relays the subscribed messages, closing the connection when a write fails or the server
+// shuts down.
+func (h handler) deliver(ctx context.Context, c *conn, messages <-chan chat.Message) {
+	log := logger.FromContext(ctx)
+
+	for msg := range messages {
+		err := chatAPI.TraceDelivery("irc.write", c.id, msg, func() error {
+			return h.write(c, msg)
+		})
+		if err != nil {
+			log.Info("error sending message", "error", err)
+			c.conn.Close()
+
+			return
+		}
+
+		if msg.Type == chat.TypeShutdown {
+			c.conn.Close()
+
+			return
+		}
+	}
+}
+
+// write sends the message as IRC lines. Channel events are only sent to clients on the channel,
+// and messages of the client are not echoed back. Mentions are sent as notices whether the client
+// is on the channel or not.
+func (h handler) write(c *conn, msg chat.Message) error {
+	var lines []string
+
+	switch msg.Type {
+	case chat.TypeMessage:
+		if !c.joined.Load() || msg.Author == c.nick {
+			return nil
+		}
+
+		if msg.Author == chat.ChatAPIName {
+			lines = split(":"+ServerName+" NOTICE "+Channel+" :", msg.Message)
+		} else {
+			lines = split(":"+source(h.nick(c, msg.Author))+" PRIVMSG "+Channel+" :", msg.Message)
+		}
+	case chat.TypeMention:
+		lines = split(":"+ServerName+" NOTICE "+c.nick+" :"+h.nick(c, msg.Author)+" mentioned you: ", msg.Message)
+	case chat.TypeDirect:
+		lines = split(":"+source(h.nick(c, msg.Author))+" PRIVMSG "+c.nick+" :", msg.Message)
+	case chat.TypeTopic:
+		if !c.joined.Load() {
+			return nil
+		}
+
+		lines = []string{":" + ServerName + " TOPIC " + Channel + " :" + flatten.Replace(msg.Message)}
+	case chat.TypeShutdown:
+		lines = []string{"ERROR :" + flatten.Replace(msg.Message)}
+	default:
+		return nil
+	}
+
+	for _, line := range lines {
+		if err := c.send(line); err != nil {
+			return err
+		}
+
+		h.connService.Record(c.id, len(line)+2)
+	}
+
+	return nil
+}
+
+// ping pings the client every heartbeat interval, its replies keeping the connection from idling.
+func (h handler) ping(ctx context.Context, c *conn) {
+	interval := h.heartbeat.Load().Interval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.send("PING :" + ServerName); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// message is a parsed IRC line, tags and source being ignored.
+type message struct {
+	Command string
+	Params  []string
+}
+
+func parse(line string) message {
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasPrefix(line, "@") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+
+	line = strings.TrimLeft(line, " ")
+	if strings.HasPrefix(line, ":") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+
+	params := []string{}
+	for {
+		line = strings.TrimLeft(line, " ")
+		if len(line) < 1 {
+			break
+		}
+
+		if strings.HasPrefix(line, ":") {
+			params = append(params, line[1:])
+
+			break
+		}
+
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		params = append(params, param)
+	}
+
+	if len(params) < 1 {
+		return message{}
+	}
+
+	return message{Command: strings.ToUpper(params[0]), Params: params[1:]}
+}
+
+func (m message) param(i int) string {
+	if i < 0 || i >= len(m.Params) {
+		return ""
+	}
+
+	return m.Params[i]
+}
+
+// validNick tells whether the nick follows the nickname grammar of RFC 2812.
+func validNick(nick string) bool {
+	if len(nick) < 1 || len(nick) > MaxNickLength {
+		return false
+	}
+
+	for i, r := range nick {
+		letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		special := strings.ContainsRune("[]\\`_^{|}", r)
+		if i == 0 && !letter && !special {
+			return false
+		}
+
+		if !letter && !special && !(r >= '0' && r <= '9') && r != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// nickname returns the name as a nick, replacing the characters nicks cannot have, for users
+// joined from other transports.
+func nickname(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == ',' || r == ':' || r == '!' || r == '@' || r == '*' || r == '?' {
+			return '_'
+		}
+
+		return r
+	}, name)
+}
+
+// nick returns the nick the connection knows the user by. Names that are not valid nicks are
+// given their nickname, numbered when it is the name of another user or the nick of another name,
+// so that every nick of the connection leads back to a single user. Names that are valid nicks
+// keep them unless already given to another name.
+func (h handler) nick(c *conn, name string) string {
+	if nickname(name) == name && c.nicks.name(name) == name {
+		return name
+	}
+
+	return c.nicks.assign(name, func(nick string) bool {
+		_, err := h.userStorage.FindTokenByUsername(nick)
+
+		return err == nil
+	})
+}
+
+// source returns the source of messages of the nick.
+func source(nick string) string {
+	return nick + "!" + nick + "@" + ServerName
+}
+
+// nicks maps the names of users that are not valid nicks to the nicks a connection shows them
+// with, and back for the commands naming them.
+type nicks struct {
+	sync.Mutex
+	byName map[string]string
+	byNick map[string]string
+}
+
+// assign returns the nick of the name, assigning it the first nickname of the name that is free
+// when it has none.
+func (n *nicks) assign(name string, taken func(nick string) bool) string {
+	n.Lock()
+	defer n.Unlock()
+
+	if nick, ok := n.byName[name]; ok {
+		return nick
+	}
+
+	if n.byName == nil {
+		n.byName, n.byNick = map[string]string{}, map[string]string{}
+	}
+
+	base := nickname(name)
+	nick := base
+	for i := 2; len(n.byNick[nick]) > 0 || taken(nick); i++ {
+		nick = base + strconv.Itoa(i)
+	}
+
+	n.byName[name] = nick
+	n.byNick[nick] = name
+
+	return nick
+}
+
+// name returns the name of the user of the nick, which is the nick itself unless it was assigned.
+func (n *nicks) name(nick string) string {
+	n.Lock()
+	defer n.Unlock()
+
+	if name, ok := n.byNick[nick]; ok {
+		return name
+	}
+
+	return nick
+}
+
+var flatten = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// split returns the lines sending the text after prefix, one per line of the text, long lines
+// being split at rune boundaries.
+func split(prefix, text string) []string {
+	lines := []string{}
+	limit := maxLine - len(prefix)
+	if limit < minText {
+		limit = minText
+	}
+
+	for _, part := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		part = strings.TrimRight(part, "\r")
+		if len(part) < 1 {
+			continue
+		}
+
+		for len(part) > limit {
+			cut := limit
+			for cut > 0 && !utf8.RuneStart(part[cut]) {
+				cut--
+			}
+
+			if cut < 1 {
+				_, cut = utf8.DecodeRuneInString(part)
+			}
+
+			lines = append(lines, prefix+part[:cut])
+			part = part[cut:]
+		}
+
+		lines = append(lines, prefix+part)
+	}
+
+	return lines
+}
+
+// conn is an IRC connection, serializing the writes of the command handler, the subscription and
+// the pings.
+type conn struct {
+	sync.Mutex
+	conn   net.Conn
+	id     ulid.ULID
+	nick   string
+	joined atomic.Bool
+	nicks  nicks
+}
+
+func (c *conn) send(line string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+
+	return err
+}
+
+// numeric sends a numeric reply to the client, the last parameter being sent as trailing.
+func (c *conn) numeric(code string, params ...string) error {
+	line := ":" + ServerName + " " + code + " " + c.nick
+	for i, p := range params {
+		if i == len(params)-1 {
+			line += " :" + flatten.Replace(p)
+		} else {
+			line += " " + p
+		}
+	}
+
+	return c.send(line)
+}
+
+func (c *conn) source() string {
+	return source(c.nick)
+}
+
+// Close sends the reason before closing the connection, for the connection service to disconnect
+// it like websocket connections.
+func (c *conn) Close(_ websocket.StatusCode, reason string) error {
+	c.send("ERROR :Closing link: " + reason)
+
+	return c.conn.Close()
+}
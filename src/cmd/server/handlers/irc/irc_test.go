@@ -0,0 +1,367 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/ratelimit"
+	"gochat/internal/receipt"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/ban"
+	"gochat/internal/storage/inmemory/mention"
+	inmemoryReceipt "gochat/internal/storage/inmemory/receipt"
+	inmemoryRoom "gochat/internal/storage/inmemory/room"
+	"gochat/internal/storage/inmemory/user"
+	"gochat/internal/websocket/connection"
+	"gochat/internal/websocket/heartbeat"
+)
+
+type fixture struct {
+	addr           string
+	userStorage    user.UserStorage
+	banStorage     ban.BanStorage
+	chatService    chat.ChatService
+	receiptService receipt.ReceiptService
+	rateLimit      *ratelimit.Settings
+}
+
+// moderatorKey is the moderator key of the fixture, which every registration sends as password.
+const moderatorKey = "moderator-key"
+
+// newFixture serves IRC on a local port like the server does, with moderator as moderator.
+func newFixture(t *testing.T) fixture {
+	userStorage := user.New()
+	banStorage := ban.New()
+	chatService := chat.New(chat.DefaultHistorySize)
+	receiptService := receipt.New(inmemoryReceipt.New(), chatService)
+	rateLimit := ratelimit.NewSettings(ratelimit.Config{})
+	connService := connection.New(connection.Limits{})
+	roomService := room.New(inmemoryRoom.New(), chatService, []string{"moderator"})
+	roomService.SetModeratorKey(moderatorKey)
+
+	h := New(
+		userStorage,
+		banStorage,
+		mention.New(),
+		connService,
+		chatService,
+		receiptService,
+		roomService,
+		lifecycle.New(),
+		heartbeat.NewSettings(heartbeat.Config{}),
+		ratelimit.NewUsers(rateLimit),
+	)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	go h.Serve(ln)
+	t.Cleanup(func() {
+		ln.Close()
+		connService.Close()
+	})
+
+	return fixture{
+		addr:           ln.Addr().String(),
+		userStorage:    userStorage,
+		banStorage:     banStorage,
+		chatService:    chatService,
+		receiptService: receiptService,
+		rateLimit:      rateLimit,
+	}
+}
+
+// client is a scripted IRC client.
+type client struct {
+	t     *testing.T
+	conn  net.Conn
+	lines *bufio.Scanner
+}
+
+func dial(t *testing.T, addr string) client {
+	c, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	return client{t: t, conn: c, lines: bufio.NewScanner(c)}
+}
+
+func (c client) send(format string, args ...any) {
+	_, err := fmt.Fprintf(c.conn, format+"\r\n", args...)
+	assert.NoError(c.t, err)
+}
+
+// expect reads lines until one contains the expected text, returning it, and fails on timeout or
+// when the connection is closed.
+func (c client) expect(text string) string {
+	c.t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for c.lines.Scan() {
+		if line := c.lines.Text(); strings.Contains(line, text) {
+			return line
+		}
+	}
+
+	c.t.Errorf("line with %q not received: %v", text, c.lines.Err())
+
+	return ""
+}
+
+// register registers the nick the way IRC clients do, negotiating capabilities first.
+func (f fixture) register(t *testing.T, nick string) client {
+	c := dial(t, f.addr)
+	c.send("CAP LS 302")
+	c.send("PASS %s", moderatorKey)
+	c.send("NICK %s", nick)
+	c.send("USER %s 0 * :Real Name", nick)
+	c.expect("CAP * LS")
+	c.send("CAP REQ :server-time")
+	c.expect("CAP * NAK :server-time")
+	c.send("CAP END")
+	c.expect(":gochat 001 " + nick + " :Welcome to GoChat, " + nick)
+	c.expect(":gochat 422 " + nick)
+
+	return c
+}
+
+func (f fixture) join(t *testing.T, nick string) client {
+	c := f.register(t, nick)
+	c.send("JOIN #general")
+	c.expect(":" + nick + "!" + nick + "@gochat JOIN #general")
+	c.expect(":gochat 366 " + nick + " #general")
+
+	return c
+}
+
+func TestConversation(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+
+	alice := f.join(t, "alice")
+	bob := f.join(t, "bob")
+	alice.expect(":gochat NOTICE #general :bob has joined the chat!")
+
+	// Websocket subscribers get the messages of IRC users.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := f.chatService.Subscribe(ctx, "carol")
+
+	alice.send("PRIVMSG #general :hello @bob")
+	bob.expect(":alice!alice@gochat PRIVMSG #general :hello @bob")
+	bob.expect(":gochat NOTICE bob :alice mentioned you: hello @bob")
+	assert.Equal(t, "hello @bob", (<-messages).Message)
+
+	// Messages of other transports show up in the channel.
+	f.chatService.PostMessage(chat.Message{Author: "carol", Message: "line one\nline two"})
+	alice.expect(":carol!carol@gochat PRIVMSG #general :line one")
+	alice.expect(":carol!carol@gochat PRIVMSG #general :line two")
+
+	bob.send("PRIVMSG alice :psst")
+	alice.expect(":bob!bob@gochat PRIVMSG alice :psst")
+	assert.Equal(t, 1, f.receiptService.Unread("alice", receipt.Direct("bob")).Count)
+
+	bob.send("PRIVMSG #general :\x01ACTION waves\x01")
+	alice.expect("PRIVMSG #general :* bob waves")
+
+	bob.send("PRIVMSG nobody :hi")
+	bob.expect(":gochat 401 bob nobody :No such nick/channel")
+
+	bob.send("QUIT :bye")
+	bob.expect("ERROR :Closing link")
+	alice.expect(":gochat NOTICE #general :bob has left the chat!")
+
+	_, err := f.userStorage.FindTokenByUsername("bob")
+	assert.Error(t, err)
+}
+
+func TestRegistration(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	f.join(t, "alice")
+	f.banStorage.Add(ban.Ban{Username: "mallory"})
+
+	c := dial(t, f.addr)
+	c.send("JOIN #general")
+	c.expect(":gochat 451 * :You have not registered")
+
+	c.send("NICK 1nvalid")
+	c.expect(":gochat 432 * 1nvalid :Erroneous nickname")
+
+	c.send("NICK alice")
+	c.send("USER alice 0 * :Alice")
+	c.expect(":gochat 433 * alice :Nickname is already in use")
+
+	c.send("NICK GoChat")
+	c.expect(":gochat 432 * GoChat :Nickname is reserved")
+
+	// Moderator nicks need the moderator key as password.
+	c.send("NICK moderator")
+	c.expect(":gochat 432 * moderator :Nickname is reserved")
+
+	c.send("NICK ci[bot]")
+	c.expect(":gochat 432 * ci[bot] :Nickname is reserved")
+
+	c.send("NICK bob")
+	c.expect(":gochat 001 bob")
+
+	c.send("USER bob 0 * :Bob")
+	c.expect(":gochat 462 bob :You may not reregister")
+
+	banned := dial(t, f.addr)
+	banned.send("NICK mallory")
+	banned.send("USER mallory 0 * :Mallory")
+	banned.expect("ERROR :Closing link: banned")
+}
+
+func TestChannel(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+
+	alice := f.register(t, "alice")
+	alice.send("PRIVMSG #general :not joined")
+	alice.expect(":gochat 404 alice #general :Cannot send to channel")
+
+	alice.send("JOIN #other")
+	alice.expect(":gochat 403 alice #other :No such channel")
+
+	moderator := f.join(t, "moderator")
+
+	alice.send("JOIN #General")
+	alice.expect("JOIN #general")
+	alice.expect(":gochat 353 alice = #general :alice moderator")
+
+	alice.send("WHO #general")
+	alice.expect(":gochat 352 alice #general alice gochat gochat alice H :0 alice")
+	alice.expect(":gochat 352 alice #general moderator gochat gochat moderator H :0 moderator")
+	alice.expect(":gochat 315 alice #general")
+
+	alice.send("TOPIC #general :mine")
+	alice.expect(":gochat 482 alice #general")
+
+	moderator.send("TOPIC #general :Welcome")
+	alice.expect(":gochat TOPIC #general :Welcome")
+
+	alice.send("TOPIC #general")
+	alice.expect(":gochat 332 alice #general :Welcome")
+
+	alice.send("PART #general")
+	alice.expect(":alice!alice@gochat PART #general")
+
+	alice.send("PART #general")
+	alice.expect(":gochat 442 alice #general")
+
+	alice.send("FOO")
+	alice.expect(":gochat 421 alice FOO :Unknown command")
+
+	alice.send("PING :token")
+	alice.expect(":gochat PONG gochat :token")
+}
+
+func TestNicks(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	f.userStorage.Set(ulid.Make(), "john doe")
+	f.userStorage.Set(ulid.Make(), "john_doe")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := f.chatService.Subscribe(ctx, "john doe")
+
+	alice := f.join(t, "alice")
+
+	// Names that are not nicks are shown sanitized, numbered when the nick is another user's.
+	f.chatService.PostMessage(chat.Message{Author: "john doe", Message: "hi"})
+	alice.expect(":john_doe2!john_doe2@gochat PRIVMSG #general :hi")
+	f.chatService.PostMessage(chat.Message{Author: "john_doe", Message: "hey"})
+	alice.expect(":john_doe!john_doe@gochat PRIVMSG #general :hey")
+
+	alice.send("PRIVMSG john_doe2 :psst")
+	for m := range messages {
+		if m.Type == chat.TypeDirect {
+			assert.Equal(t, "alice", m.Author)
+			assert.Equal(t, "psst", m.Message)
+
+			break
+		}
+	}
+
+	alice.send("WHOIS john_doe2")
+	alice.expect(":gochat 311 alice john_doe2")
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	f.rateLimit.Store(ratelimit.Config{Rate: 0.001, Burst: 2})
+
+	alice := f.join(t, "alice")
+	bob := f.join(t, "bob")
+
+	// Channel and direct messages share the limit.
+	alice.send("PRIVMSG #general :first")
+	bob.expect("PRIVMSG #general :first")
+	alice.send("PRIVMSG bob :second")
+	bob.expect("PRIVMSG bob :second")
+
+	alice.send("PRIVMSG #general :third")
+	alice.expect(":gochat 263 alice PRIVMSG :Please wait a while and try again.")
+	alice.send("PRIVMSG bob :fourth")
+	alice.expect(":gochat 263 alice PRIVMSG :Please wait a while and try again.")
+
+	bob.send("PRIVMSG #general :from bob")
+	alice.expect(":bob!bob@gochat PRIVMSG #general :from bob")
+}
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+
+	alice := f.join(t, "alice")
+
+	f.chatService.PostMessage(chat.Message{Type: chat.TypeShutdown, Author: chat.ChatAPIName, Message: "Server is restarting."})
+	alice.expect("ERROR :Server is restarting.")
+	assert.False(t, alice.lines.Scan())
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, message{Command: "PRIVMSG", Params: []string{"#general", "hello world"}},
+		parse("@time=now :alice!a@host privmsg #general :hello world\r"))
+	assert.Equal(t, message{Command: "USER", Params: []string{"alice", "0", "*", ""}}, parse("USER alice 0 * :"))
+	assert.Equal(t, message{Command: "JOIN", Params: []string{"#general"}}, parse("JOIN  #general "))
+	assert.Equal(t, message{}, parse("  "))
+}
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	prefix := ":alice!alice@gochat PRIVMSG #general :"
+	lines := split(prefix, strings.Repeat("é", 400)+"\n\nend")
+
+	assert.Len(t, lines, 3)
+	for _, line := range lines {
+		assert.LessOrEqual(t, len(line), maxLine)
+		assert.True(t, strings.HasPrefix(line, prefix))
+	}
+
+	assert.Equal(t, strings.Repeat("é", 400), strings.TrimPrefix(lines[0], prefix)+strings.TrimPrefix(lines[1], prefix))
+	assert.Equal(t, prefix+"end", lines[2])
+}
@@ -2,28 +2,48 @@ package join
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
-	"log"
 	"net/http"
 
 	"github.com/oklog/ulid/v2"
 
 	"gochat/cmd/server/models"
+	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/ban"
 	"gochat/internal/storage/inmemory/user"
 )
 
+var joins = metrics.Default.Counter("gochat_joins_total", "Users joined the chat.")
+
+var (
+	ErrReservedName = errors.New("name is reserved")
+	ErrBanned       = errors.New("user is banned")
+	ErrNameTaken    = errors.New("name is already taken")
+)
+
 type JoinHandler interface {
 	Join(w http.ResponseWriter, r *http.Request)
 }
 
-func New(userStorage user.UserStorage) JoinHandler {
+func New(userStorage user.UserStorage, banStorage ban.BanStorage, roomService room.RoomService, lifecycleService lifecycle.LifecycleService) JoinHandler {
 	return &handler{
-		userStorage: userStorage,
+		userStorage:      userStorage,
+		banStorage:       banStorage,
+		roomService:      roomService,
+		lifecycleService: lifecycleService,
 	}
 }
 
 type handler struct {
-	userStorage user.UserStorage
+	userStorage      user.UserStorage
+	banStorage       ban.BanStorage
+	roomService      room.RoomService
+	lifecycleService lifecycle.LifecycleService
 }
 
 func (h handler) Join(w http.ResponseWriter, r *http.Request) {
@@ -33,32 +53,77 @@ func (h handler) Join(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.lifecycleService.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	log := logger.FromContext(r.Context())
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Fatal(err, "error reading body")
+		log.Warn("error reading body", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
 	}
 
 	var user models.User
 	if err := json.Unmarshal(body, &user); err != nil {
-		log.Fatal(err, "error unmarshalling body")
+		log.Warn("error unmarshalling body", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
 	}
 
-	if _, err = h.userStorage.FindTokenByUsername(user.Name); err == nil {
+	token, err := Register(h.userStorage, h.banStorage, h.roomService, user.Name, user.Key)
+	if errors.Is(err, ErrBanned) {
+		log.Info("banned user rejected", "user", user.Name)
+		w.WriteHeader(http.StatusForbidden)
+
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 
 		return
 	}
 
-	token := ulid.Make()
-
-	h.userStorage.Set(token, user.Name)
+	log.Info("user joined", "user", user.Name)
 
 	tokenJson, err := json.Marshal(models.Token{
 		Value: token,
 	})
 	if err != nil {
-		log.Fatal(err, "error marshalling token")
+		log.Error("error marshalling token", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(tokenJson)
 }
+
+// Register joins the user to the chat, returning the token of the user. Other transports
+// registering users go through it for the same rules as joins.
+func Register(userStorage user.UserStorage, banStorage ban.BanStorage, roomService room.RoomService, name, key string) (ulid.ULID, error) {
+	// The chat name is reserved for system messages, bot names for incoming webhooks and moderator
+	// names for users with the moderator key.
+	if name == chat.ChatAPIName || chat.IsBotName(name) || !roomService.Authorize(name, key) {
+		return ulid.ULID{}, ErrReservedName
+	}
+
+	if banStorage.Banned(name) {
+		return ulid.ULID{}, ErrBanned
+	}
+
+	token := ulid.Make()
+	if !userStorage.SetIfAbsent(token, name) {
+		return ulid.ULID{}, ErrNameTaken
+	}
+
+	joins.Inc()
+
+	return token, nil
+}
@@ -0,0 +1,44 @@
+package join
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/chat"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/ban"
+	inmemoryRoom "gochat/internal/storage/inmemory/room"
+	"gochat/internal/storage/inmemory/user"
+)
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	userStorage := user.New()
+	banStorage := ban.New()
+	banStorage.Add(ban.Ban{Username: "spammer"})
+	roomService := room.New(inmemoryRoom.New(), chat.New(chat.DefaultHistorySize), []string{"moderator"})
+	roomService.SetModeratorKey("secret")
+
+	for _, tc := range []struct {
+		name string
+		key  string
+		err  error
+	}{
+		{"user", "", nil},
+		{"user", "", ErrNameTaken},
+		{chat.ChatAPIName, "", ErrReservedName},
+		{chat.BotName("CI"), "", ErrReservedName},
+		{"spammer", "", ErrBanned},
+		{"moderator", "", ErrReservedName},
+		{"moderator", "wrong", ErrReservedName},
+		{"moderator", "secret", nil},
+	} {
+		token, err := Register(userStorage, banStorage, roomService, tc.name, tc.key)
+		assert.Equal(t, tc.err, err, tc.name)
+		if err == nil {
+			assert.Equal(t, tc.name, userStorage.Get(token))
+		}
+	}
+}
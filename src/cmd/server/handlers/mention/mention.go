@@ -0,0 +1,97 @@
+package mention
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"gochat/cmd/server/handlers/auth"
+	"gochat/cmd/server/models"
+	"gochat/internal/logger"
+	"gochat/internal/storage/inmemory/mention"
+	"gochat/internal/storage/inmemory/user"
+)
+
+// Endpoint names the mention endpoint in metrics.
+const Endpoint = "mentions"
+
+type MentionHandler interface {
+	Mentions(w http.ResponseWriter, r *http.Request)
+}
+
+func New(userStorage user.UserStorage, mentionStorage mention.MentionStorage) MentionHandler {
+	return &handler{
+		userStorage:    userStorage,
+		mentionStorage: mentionStorage,
+	}
+}
+
+type handler struct {
+	userStorage    user.UserStorage
+	mentionStorage mention.MentionStorage
+}
+
+// Mentions lists the mention inbox on GET, optionally only unread mentions with ?unread=true,
+// and marks the given mentions (or all when none are given) as read on POST.
+func (h handler) Mentions(w http.ResponseWriter, r *http.Request) {
+	_, user, ok := auth.Authenticate(r, Endpoint, h.userStorage)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w, r, user)
+	case http.MethodPost:
+		h.markRead(w, r, user)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (h handler) list(w http.ResponseWriter, r *http.Request, user string) {
+	mentions := []models.Mention{}
+	for _, m := range h.mentionStorage.List(user, r.URL.Query().Get("unread") == "true") {
+		mentions = append(mentions, models.Mention{
+			MessageID: m.MessageID,
+			Author:    m.Author,
+			Value:     m.Message,
+			Read:      m.Read,
+		})
+	}
+
+	mentionsJson, err := json.Marshal(mentions)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("error marshalling mentions", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(mentionsJson)
+}
+
+func (h handler) markRead(w http.ResponseWriter, r *http.Request, user string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	var read models.MarkRead
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &read); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	h.mentionStorage.MarkRead(user, read.MessageIDs...)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,77 @@
+package mention
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"gochat/cmd/server/models"
+	"gochat/internal/storage/inmemory/mention"
+	"gochat/internal/storage/inmemory/user"
+)
+
+func TestMentions(t *testing.T) {
+	t.Parallel()
+
+	userStorage := user.New()
+	token := ulid.Make()
+	userStorage.Set(token, "user")
+
+	first, second := ulid.Make(), ulid.Make()
+	mentionStorage := mention.New()
+	mentionStorage.Add("user", mention.Mention{MessageID: first, Author: "alice", Message: "hi @user"})
+	mentionStorage.Add("user", mention.Mention{MessageID: second, Author: "bob", Message: "@user yo"})
+	mentionStorage.Add("other", mention.Mention{MessageID: ulid.Make(), Author: "alice", Message: "hi @other"})
+
+	firstJSON := func(read bool) string {
+		return fmt.Sprintf(`{"MessageID":"%s","Author":"alice","Value":"hi @user","Read":%t}`, first, read)
+	}
+	secondJSON := fmt.Sprintf(`{"MessageID":"%s","Author":"bob","Value":"@user yo","Read":false}`, second)
+
+	h := New(userStorage, mentionStorage)
+
+	// Cases run in order, marking mentions read along the way.
+	for _, tc := range []struct {
+		method string
+		target string
+		token  string
+		body   string
+		status int
+		result string
+	}{
+		{http.MethodGet, "/mentions", token.String(), "", http.StatusOK, "[" + firstJSON(false) + "," + secondJSON + "]"},
+		{http.MethodPost, "/mentions", token.String(), `{"MessageIDs":["` + first.String() + `"]}`, http.StatusNoContent, ""},
+		{http.MethodGet, "/mentions", token.String(), "", http.StatusOK, "[" + firstJSON(true) + "," + secondJSON + "]"},
+		{http.MethodGet, "/mentions?unread=true", token.String(), "", http.StatusOK, "[" + secondJSON + "]"},
+		{http.MethodPost, "/mentions", token.String(), "invalid", http.StatusBadRequest, ""},
+		{http.MethodPost, "/mentions", token.String(), "", http.StatusNoContent, ""},
+		{http.MethodGet, "/mentions?unread=true", token.String(), "", http.StatusOK, "[]"},
+		{http.MethodPut, "/mentions", token.String(), "", http.StatusNotFound, ""},
+		{http.MethodGet, "/mentions", "", "", http.StatusUnauthorized, ""},
+		{http.MethodPost, "/mentions", ulid.Make().String(), "", http.StatusUnauthorized, ""},
+	} {
+		name := tc.method + " " + tc.target
+
+		r := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+		r.Header.Set(models.BearerToken, tc.token)
+		w := httptest.NewRecorder()
+		h.Mentions(w, r)
+
+		assert.Equal(t, tc.status, w.Code, name)
+		if len(tc.result) < 1 {
+			assert.Empty(t, w.Body.String(), name)
+
+			continue
+		}
+
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"), name)
+		assert.JSONEq(t, tc.result, w.Body.String(), name)
+	}
+
+	assert.Len(t, mentionStorage.List("other", true), 1)
+}
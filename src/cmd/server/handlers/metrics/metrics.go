@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"net/http"
+
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+)
+
+type MetricsHandler interface {
+	Metrics(w http.ResponseWriter, r *http.Request)
+}
+
+func New(metricsService metrics.MetricsService) MetricsHandler {
+	return &handler{
+		metricsService: metricsService,
+	}
+}
+
+type handler struct {
+	metricsService metrics.MetricsService
+}
+
+// Metrics exposes the metrics in the Prometheus text format.
+func (h handler) Metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+
+	if err := h.metricsService.Write(w); err != nil {
+		logger.FromContext(r.Context()).Warn("error writing metrics", "error", err)
+	}
+}
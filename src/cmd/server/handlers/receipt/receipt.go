@@ -0,0 +1,120 @@
+package receipt
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"gochat/cmd/server/handlers/auth"
+	"gochat/cmd/server/models"
+	"gochat/internal/chat"
+	"gochat/internal/logger"
+	"gochat/internal/receipt"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/user"
+)
+
+// Endpoint names the receipt endpoints in metrics.
+const Endpoint = "receipts"
+
+type ReceiptHandler interface {
+	Read(w http.ResponseWriter, r *http.Request)
+	Unread(w http.ResponseWriter, r *http.Request)
+}
+
+func New(userStorage user.UserStorage, receiptService receipt.ReceiptService) ReceiptHandler {
+	return &handler{
+		userStorage:    userStorage,
+		receiptService: receiptService,
+	}
+}
+
+type handler struct {
+	userStorage    user.UserStorage
+	receiptService receipt.ReceiptService
+}
+
+// Read marks messages of the conversation up to the given message ID as read.
+func (h handler) Read(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	_, user, ok := auth.Authenticate(r, Endpoint, h.userStorage)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	var read models.Read
+	if err := json.Unmarshal(body, &read); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	if err := h.receiptService.MarkRead(user, read.Conversation, read.MessageID); err != nil {
+		if errors.Is(err, chat.ErrMessageNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		logger.FromContext(r.Context()).Warn("error marking message read", "user", user, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unread returns the last read message ID and the number of unread messages of the conversation
+// query parameter, the room when it is not set.
+func (h handler) Unread(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	_, user, ok := auth.Authenticate(r, Endpoint, h.userStorage)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	conversation := r.URL.Query().Get("conversation")
+	if len(conversation) < 1 {
+		conversation = room.ID
+	}
+
+	unread := h.receiptService.Unread(user, conversation)
+
+	unreadJson, err := json.Marshal(models.Unread{
+		Conversation: conversation,
+		LastRead:     unread.LastRead,
+		Count:        unread.Count,
+	})
+	if err != nil {
+		logger.FromContext(r.Context()).Error("error marshalling unread", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(unreadJson)
+}
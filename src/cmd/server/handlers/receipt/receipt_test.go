@@ -0,0 +1,84 @@
+package receipt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"gochat/cmd/server/models"
+	"gochat/internal/chat"
+	"gochat/internal/receipt"
+	inmemoryReceipt "gochat/internal/storage/inmemory/receipt"
+	"gochat/internal/storage/inmemory/user"
+)
+
+func TestReceipts(t *testing.T) {
+	t.Parallel()
+
+	userStorage := user.New()
+	token := ulid.Make()
+	userStorage.Set(token, "user")
+
+	chatService := chat.New(chat.DefaultHistorySize)
+	first := chatService.PostMessage(chat.Message{Author: "other", Message: "first"})
+	second := chatService.PostMessage(chat.Message{Author: "other", Message: "second"})
+	chatService.PostMessage(chat.Message{Author: "user", Message: "own"})
+
+	receiptService := receipt.New(inmemoryReceipt.New(), chatService)
+	direct := receiptService.SendDirect("other", "user", "psst")
+	h := New(userStorage, receiptService)
+
+	unread := func(conversation string, lastRead ulid.ULID, count int) string {
+		return `{"Conversation":"` + conversation + `","LastRead":"` + lastRead.String() + `","Count":` + strconv.Itoa(count) + `}`
+	}
+
+	// Cases run in order, moving the read marker along the way.
+	for _, tc := range []struct {
+		handler func(w http.ResponseWriter, r *http.Request)
+		method  string
+		target  string
+		token   string
+		body    string
+		status  int
+		result  string
+	}{
+		{h.Unread, http.MethodGet, "/unread", token.String(), "", http.StatusOK, unread("general", ulid.ULID{}, 2)},
+		{h.Read, http.MethodPost, "/read", token.String(), `{"MessageID":"` + first.ID.String() + `"}`, http.StatusNoContent, ""},
+		{h.Unread, http.MethodGet, "/unread", token.String(), "", http.StatusOK, unread("general", first.ID, 1)},
+		{h.Read, http.MethodPost, "/read", token.String(), `{"MessageID":"` + second.ID.String() + `"}`, http.StatusNoContent, ""},
+		{h.Unread, http.MethodGet, "/unread", token.String(), "", http.StatusOK, unread("general", second.ID, 0)},
+		{h.Unread, http.MethodGet, "/unread?conversation=general", token.String(), "", http.StatusOK, unread("general", second.ID, 0)},
+		{h.Unread, http.MethodGet, "/unread?conversation=@other", token.String(), "", http.StatusOK, unread("@other", ulid.ULID{}, 1)},
+		{h.Read, http.MethodPost, "/read", token.String(), `{"MessageID":"` + direct.ID.String() + `"}`, http.StatusNotFound, ""},
+		{h.Read, http.MethodPost, "/read", token.String(), `{"MessageID":"` + direct.ID.String() + `","Conversation":"@other"}`, http.StatusNoContent, ""},
+		{h.Unread, http.MethodGet, "/unread?conversation=@other", token.String(), "", http.StatusOK, unread("@other", direct.ID, 0)},
+		{h.Read, http.MethodPost, "/read", token.String(), `{"MessageID":"` + ulid.Make().String() + `"}`, http.StatusNotFound, ""},
+		{h.Read, http.MethodPost, "/read", token.String(), "invalid", http.StatusBadRequest, ""},
+		{h.Read, http.MethodGet, "/read", token.String(), "", http.StatusNotFound, ""},
+		{h.Unread, http.MethodPost, "/unread", token.String(), "", http.StatusNotFound, ""},
+		{h.Read, http.MethodPost, "/read", "", `{"MessageID":"` + first.ID.String() + `"}`, http.StatusUnauthorized, ""},
+		{h.Unread, http.MethodGet, "/unread", ulid.Make().String(), "", http.StatusUnauthorized, ""},
+	} {
+		name := tc.method + " " + tc.target + " " + tc.body
+
+		r := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+		r.Header.Set(models.BearerToken, tc.token)
+		w := httptest.NewRecorder()
+		tc.handler(w, r)
+
+		assert.Equal(t, tc.status, w.Code, name)
+		if len(tc.result) < 1 {
+			assert.Empty(t, w.Body.String(), name)
+
+			continue
+		}
+
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"), name)
+		assert.JSONEq(t, tc.result, w.Body.String(), name)
+	}
+}
@@ -0,0 +1,94 @@
+package request
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"gochat/internal/logger"
+)
+
+const (
+	// HeaderRequestID carries the correlation ID of a request, generated unless the client sent one.
+	HeaderRequestID = "X-Request-ID"
+
+	// MaxRequestIDLength limits the size of request IDs accepted from clients.
+	MaxRequestIDLength = 128
+)
+
+type RequestHandler interface {
+	Handle(next http.HandlerFunc) http.HandlerFunc
+}
+
+func New() RequestHandler {
+	return &handler{}
+}
+
+type handler struct{}
+
+// Handle gives the request a correlation ID, returned in the response, and a logger carrying it in
+// the request context.
+func (h handler) Handle(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if !valid(id) {
+			id = ulid.Make().String()
+		}
+
+		w.Header().Set(HeaderRequestID, id)
+
+		log := logger.FromContext(r.Context()).With("request_id", id)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next(sw, r.WithContext(logger.NewContext(r.Context(), log)))
+
+		log.Debug("request handled", "method", r.Method, "path", r.URL.Path, "status", sw.status, "duration", time.Since(start))
+	}
+}
+
+func valid(id string) bool {
+	if len(id) < 1 || len(id) > MaxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// statusWriter records the response status, keeping the connection hijackable for websockets.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+
+	w.status = http.StatusSwitchingProtocols
+
+	return h.Hijack()
+}
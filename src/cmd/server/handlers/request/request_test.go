@@ -0,0 +1,49 @@
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/logger"
+)
+
+func TestHandle(t *testing.T) {
+	t.Parallel()
+
+	h := New()
+
+	var log *logger.Logger
+	next := h.Handle(func(w http.ResponseWriter, r *http.Request) {
+		log = logger.FromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	w := httptest.NewRecorder()
+	next(w, httptest.NewRequest(http.MethodGet, "/join", nil))
+
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.Len(t, w.Header().Get(HeaderRequestID), 26)
+	assert.NotEqual(t, logger.Default(), log)
+
+	r := httptest.NewRequest(http.MethodGet, "/join", nil)
+	r.Header.Set(HeaderRequestID, "upstream-id")
+
+	w = httptest.NewRecorder()
+	next(w, r)
+
+	assert.Equal(t, "upstream-id", w.Header().Get(HeaderRequestID))
+
+	for _, id := range []string{"with space", strings.Repeat("a", MaxRequestIDLength+1)} {
+		r := httptest.NewRequest(http.MethodGet, "/join", nil)
+		r.Header.Set(HeaderRequestID, id)
+
+		w = httptest.NewRecorder()
+		next(w, r)
+
+		assert.NotEqual(t, id, w.Header().Get(HeaderRequestID))
+	}
+}
@@ -0,0 +1,24 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gochat/internal/logger"
+)
+
+// JSON writes the value as the JSON body of the response with the status, failing with an internal
+// server error when it cannot be marshalled.
+func JSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("error marshalling response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,301 @@
+package rest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/oklog/ulid/v2"
+
+	"gochat/cmd/server/handlers/auth"
+	chatAPI "gochat/cmd/server/handlers/chat"
+	"gochat/cmd/server/handlers/response"
+	"gochat/cmd/server/models"
+	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/ratelimit"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/mention"
+	"gochat/internal/storage/inmemory/user"
+	"gochat/internal/tracing"
+)
+
+// Endpoint names the REST endpoints in metrics.
+const Endpoint = "rest"
+
+// Page sizes of the room messages.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 100
+)
+
+// Spec is the OpenAPI description of the HTTP API.
+//
+//go:embed openapi.yaml
+var Spec []byte
+
+type RESTHandler interface {
+	Rooms(w http.ResponseWriter, r *http.Request)
+	Messages(w http.ResponseWriter, r *http.Request)
+	Users(w http.ResponseWriter, r *http.Request)
+	OpenAPI(w http.ResponseWriter, r *http.Request)
+}
+
+func New(
+	userStorage user.UserStorage,
+	mentionStorage mention.MentionStorage,
+	chatService chat.ChatService,
+	roomService room.RoomService,
+	lifecycleService lifecycle.LifecycleService,
+	rateLimit *ratelimit.Users,
+) RESTHandler {
+	return &handler{
+		userStorage:      userStorage,
+		mentionStorage:   mentionStorage,
+		chatService:      chatService,
+		roomService:      roomService,
+		lifecycleService: lifecycleService,
+		rateLimit:        rateLimit,
+	}
+}
+
+type handler struct {
+	userStorage      user.UserStorage
+	mentionStorage   mention.MentionStorage
+	chatService      chat.ChatService
+	roomService      room.RoomService
+	lifecycleService lifecycle.LifecycleService
+	rateLimit        *ratelimit.Users
+}
+
+// Rooms lists the rooms on GET /rooms, pages through the messages of a room on
+// GET /rooms/{id}/messages and posts a message to it on POST /rooms/{id}/messages.
+func (h handler) Rooms(w http.ResponseWriter, r *http.Request) {
+	_, username, ok := auth.Authenticate(r, Endpoint, h.userStorage)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/rooms"), "/")
+	if len(path) < 1 {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		h.rooms(w, r)
+
+		return
+	}
+
+	id, resource, _ := strings.Cut(path, "/")
+	if id != room.ID || resource != "messages" {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.page(w, r)
+	case http.MethodPost:
+		h.post(w, r, username)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (h handler) rooms(w http.ResponseWriter, r *http.Request) {
+	current := h.roomService.Room()
+
+	pins := []models.Pin{}
+	for _, p := range current.Pins {
+		pins = append(pins, models.Pin{
+			MessageID: p.MessageID,
+			Author:    p.Author,
+			Value:     p.Message,
+			PinnedBy:  p.PinnedBy,
+		})
+	}
+
+	response.JSON(w, r, http.StatusOK, []models.Room{{
+		ID:         room.ID,
+		Topic:      current.Topic,
+		Pins:       pins,
+		Moderators: h.roomService.Moderators(),
+	}})
+}
+
+// page returns the messages of the before and after cursors, up to the limit query parameter.
+func (h handler) page(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	var before, after ulid.ULID
+	var err error
+	if v := values.Get("before"); len(v) > 0 {
+		if before, err = ulid.Parse(v); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	if v := values.Get("after"); len(v) > 0 {
+		if after, err = ulid.Parse(v); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	limit := DefaultPageSize
+	if v := values.Get("limit"); len(v) > 0 {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > MaxPageSize {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	page := h.chatService.Page(before, after, limit)
+
+	result := models.Page{
+		Messages: make([]models.Message, 0, len(page.Messages)),
+	}
+
+	for _, m := range page.Messages {
+		result.Messages = append(result.Messages, chatAPI.Message(m))
+	}
+
+	if len(page.Messages) > 0 {
+		if page.Older {
+			result.Before = page.Messages[0].ID.String()
+		}
+
+		if page.Newer {
+			result.After = page.Messages[len(page.Messages)-1].ID.String()
+		}
+	}
+
+	response.JSON(w, r, http.StatusOK, result)
+}
+
+// post publishes a message of the user, traced like messages published over websocket.
+func (h handler) post(w http.ResponseWriter, r *http.Request, username string) {
+	if h.lifecycleService.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	ctx, span := tracing.Start(r.Context(), "chat.publish", "user", username)
+	defer span.End()
+
+	_, validateSpan := tracing.Start(ctx, "message.validate")
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		validateSpan.RecordError(err)
+		validateSpan.End()
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	var p models.Post
+	if err := json.Unmarshal(body, &p); err != nil || len(strings.TrimSpace(p.Value)) < 1 {
+		validateSpan.RecordError(err)
+		validateSpan.End()
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+	validateSpan.End()
+
+	if !h.rateLimit.Allow(username, Endpoint) {
+		w.WriteHeader(http.StatusTooManyRequests)
+
+		return
+	}
+
+	posted := h.chatService.PostMessage(chat.Message{
+		Author:      username,
+		Message:     p.Value,
+		TraceParent: span.TraceParent(),
+	})
+
+	chatAPI.NotifyMentions(h.userStorage, h.mentionStorage, h.chatService, posted)
+
+	response.JSON(w, r, http.StatusCreated, chatAPI.Message(posted))
+}
+
+// Messages returns a message of the history on GET /messages/{id}.
+func (h handler) Messages(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := auth.Authenticate(r, Endpoint, h.userStorage); !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/messages"), "/")
+	if r.Method != http.MethodGet || len(id) < 1 {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	messageID, err := ulid.Parse(id)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	m, err := h.chatService.Get(messageID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	response.JSON(w, r, http.StatusOK, chatAPI.Message(m))
+}
+
+// Users lists the users in the chat.
+func (h handler) Users(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if _, _, ok := auth.Authenticate(r, Endpoint, h.userStorage); !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	users := []models.User{}
+	for _, name := range h.userStorage.List() {
+		users = append(users, models.User{Name: name})
+	}
+
+	response.JSON(w, r, http.StatusOK, users)
+}
+
+// OpenAPI serves the OpenAPI description of the API.
+func (h handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(Spec)
+}
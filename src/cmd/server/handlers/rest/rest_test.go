@@ -0,0 +1,313 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	joinAPI "gochat/cmd/server/handlers/join"
+	"gochat/cmd/server/models"
+	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/ratelimit"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/ban"
+	"gochat/internal/storage/inmemory/mention"
+	inmemoryRoom "gochat/internal/storage/inmemory/room"
+	"gochat/internal/storage/inmemory/user"
+)
+
+type fixture struct {
+	mux         *http.ServeMux
+	token       ulid.ULID
+	chatService chat.ChatService
+	message     chat.Message
+}
+
+// newFixture serves the API like the server does, with a joined user and a reacted, pinned message.
+func newFixture(t *testing.T) fixture {
+	userStorage := user.New()
+	chatService := chat.New(chat.DefaultHistorySize)
+	roomService := room.New(inmemoryRoom.New(), chatService, []string{"moderator"})
+	lifecycleService := lifecycle.New()
+
+	rateLimit := ratelimit.NewUsers(ratelimit.NewSettings(ratelimit.Config{Rate: 0.001, Burst: 2}))
+	h := New(userStorage, mention.New(), chatService, roomService, lifecycleService, rateLimit)
+	joinHandler := joinAPI.New(userStorage, ban.New(), roomService, lifecycleService)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/join", joinHandler.Join)
+	mux.HandleFunc("/users", h.Users)
+	mux.HandleFunc("/rooms", h.Rooms)
+	mux.HandleFunc("/rooms/", h.Rooms)
+	mux.HandleFunc("/messages/", h.Messages)
+	mux.HandleFunc("/openapi.yaml", h.OpenAPI)
+
+	token := ulid.Make()
+	userStorage.Set(token, "user")
+
+	posted := chatService.PostMessage(chat.Message{Author: "user", Message: "hello"})
+	assert.NoError(t, chatService.AddReaction(posted.ID, "👍", "user"))
+	assert.NoError(t, roomService.Pin("moderator", posted.ID))
+
+	return fixture{
+		mux:         mux,
+		token:       token,
+		chatService: chatService,
+		message:     posted,
+	}
+}
+
+func (f fixture) serve(method, target, body string, authenticated bool) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if authenticated {
+		r.Header.Set(models.BearerToken, f.token.String())
+	}
+
+	w := httptest.NewRecorder()
+	f.mux.ServeHTTP(w, r)
+
+	return w
+}
+
+func loadSpec(t *testing.T) map[string]any {
+	spec := map[string]any{}
+	assert.NoError(t, yaml.Unmarshal(Spec, &spec))
+
+	return spec
+}
+
+// resolve follows a local $ref of the spec.
+func resolve(spec map[string]any, node map[string]any) map[string]any {
+	ref, ok := node["$ref"].(string)
+	if !ok {
+		return node
+	}
+
+	var resolved any = spec
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		resolved = resolved.(map[string]any)[part]
+	}
+
+	return resolve(spec, resolved.(map[string]any))
+}
+
+// validate checks the JSON value against the schema, object properties missing from the schema
+// being reported as undocumented.
+func validate(t *testing.T, spec map[string]any, schema map[string]any, value any, at string) {
+	schema = resolve(spec, schema)
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !assert.True(t, ok, "%s: expected an object, got %v", at, value) {
+			return
+		}
+
+		properties, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			assert.Contains(t, object, name, "%s: missing required property", at)
+		}
+
+		for name, v := range object {
+			property, ok := properties[name].(map[string]any)
+			if !assert.True(t, ok, "%s.%s: undocumented property", at, name) {
+				continue
+			}
+
+			validate(t, spec, property, v, at+"."+name)
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !assert.True(t, ok, "%s: expected an array, got %v", at, value) {
+			return
+		}
+
+		for i, item := range array {
+			validate(t, spec, schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", at, i))
+		}
+	case "string":
+		_, ok := value.(string)
+		assert.True(t, ok, "%s: expected a string, got %v", at, value)
+	case "integer":
+		number, ok := value.(float64)
+		assert.True(t, ok && number == math.Trunc(number), "%s: expected an integer, got %v", at, value)
+	case "boolean":
+		_, ok := value.(bool)
+		assert.True(t, ok, "%s: expected a boolean, got %v", at, value)
+	default:
+		t.Errorf("%s: unsupported schema type %v", at, schema["type"])
+	}
+}
+
+// TestSpec calls every operation of the spec with its example body and checks the status is
+// documented and the response matches its schema.
+func TestSpec(t *testing.T) {
+	t.Parallel()
+
+	spec := loadSpec(t)
+	paths := spec["paths"].(map[string]any)
+
+	names := []string{}
+	for path := range paths {
+		names = append(names, path)
+	}
+	sort.Strings(names)
+
+	for _, path := range names {
+		for method, node := range paths[path].(map[string]any) {
+			if method == "parameters" {
+				continue
+			}
+
+			operation := node.(map[string]any)
+			responses := operation["responses"].(map[string]any)
+			name := strings.ToUpper(method) + " " + path
+
+			f := newFixture(t)
+			target := strings.NewReplacer("{id}", room.ID).Replace(path)
+			if strings.HasPrefix(path, "/messages/") {
+				target = strings.NewReplacer("{id}", f.message.ID.String()).Replace(path)
+			}
+
+			body := []byte{}
+			if requestBody, ok := operation["requestBody"].(map[string]any); ok {
+				example := requestBody["content"].(map[string]any)["application/json"].(map[string]any)["example"]
+
+				var err error
+				body, err = json.Marshal(example)
+				assert.NoError(t, err)
+			}
+
+			security, ok := operation["security"].([]any)
+			secured := !ok || len(security) > 0
+
+			w := f.serve(strings.ToUpper(method), target, string(body), secured)
+
+			response, ok := responses[strconv.Itoa(w.Code)].(map[string]any)
+			if !assert.True(t, ok, "%s: undocumented status %d", name, w.Code) {
+				continue
+			}
+
+			assert.Less(t, w.Code, 300, "%s: %s", name, w.Body.String())
+
+			if content, ok := resolve(spec, response)["content"].(map[string]any); ok {
+				assert.Equal(t, "application/json", w.Header().Get("Content-Type"), name)
+
+				var value any
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &value), name)
+				validate(t, spec, content["application/json"].(map[string]any)["schema"].(map[string]any), value, name)
+			}
+
+			if secured {
+				w = f.serve(strings.ToUpper(method), target, string(body), false)
+				assert.Equal(t, http.StatusUnauthorized, w.Code, name)
+				assert.Contains(t, responses, "401", name)
+			}
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+
+	w := f.serve(http.MethodGet, "/openapi.yaml", "", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, bytes.Equal(Spec, w.Body.Bytes()))
+	assert.Equal(t, "3.0.3", loadSpec(t)["openapi"])
+}
+
+func TestPagination(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	for i := 0; i < 4; i++ {
+		f.chatService.PostMessage(chat.Message{Author: "user", Message: strconv.Itoa(i)})
+	}
+
+	read := func(query string) models.Page {
+		w := f.serve(http.MethodGet, "/rooms/general/messages"+query, "", true)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var page models.Page
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+
+		return page
+	}
+
+	values := func(page models.Page) []string {
+		values := []string{}
+		for _, m := range page.Messages {
+			values = append(values, m.Value)
+		}
+
+		return values
+	}
+
+	page := read("?limit=2")
+	assert.Equal(t, []string{"2", "3"}, values(page))
+	assert.Empty(t, page.After)
+
+	page = read("?limit=2&before=" + page.Before)
+	assert.Equal(t, []string{"0", "1"}, values(page))
+
+	page = read("?limit=2&before=" + page.Before)
+	assert.Equal(t, []string{"hello"}, values(page))
+	assert.Empty(t, page.Before)
+
+	page = read("?limit=3&after=" + page.After)
+	assert.Equal(t, []string{"0", "1", "2"}, values(page))
+	assert.NotEmpty(t, page.After)
+
+	for _, query := range []string{"?limit=0", "?limit=101", "?before=invalid", "?after=invalid"} {
+		w := f.serve(http.MethodGet, "/rooms/general/messages"+query, "", true)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	w := f.serve(http.MethodGet, "/rooms/other/messages", "", true)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPost(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+
+	w := f.serve(http.MethodPost, "/rooms/general/messages", `{"Value":"from http"}`, true)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var posted models.Message
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &posted))
+	assert.Equal(t, "user", posted.Author)
+
+	m, err := f.chatService.Get(posted.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "from http", m.Message)
+
+	w = f.serve(http.MethodPost, "/rooms/general/messages", `{"Value":""}`, true)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The burst of the rate limit is used up by the second post.
+	w = f.serve(http.MethodPost, "/rooms/general/messages", `{"Value":"again"}`, true)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = f.serve(http.MethodPost, "/rooms/general/messages", `{"Value":"too fast"}`, true)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	w = f.serve(http.MethodGet, "/messages/"+ulid.Make().String(), "", true)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
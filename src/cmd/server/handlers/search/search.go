@@ -0,0 +1,124 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gochat/cmd/server/handlers/auth"
+	"gochat/cmd/server/models"
+	"gochat/internal/logger"
+	"gochat/internal/search"
+	"gochat/internal/storage/inmemory/user"
+)
+
+// Endpoint names the search endpoint in metrics.
+const Endpoint = "search"
+
+type SearchHandler interface {
+	Search(w http.ResponseWriter, r *http.Request)
+}
+
+func New(userStorage user.UserStorage, searchService search.SearchService) SearchHandler {
+	return &handler{
+		userStorage:   userStorage,
+		searchService: searchService,
+	}
+}
+
+type handler struct {
+	userStorage   user.UserStorage
+	searchService search.SearchService
+}
+
+// Search finds messages by text with the q, author, room, from and to (RFC 3339), limit and offset
+// query parameters.
+func (h handler) Search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if _, _, ok := auth.Authenticate(r, Endpoint, h.userStorage); !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	query, err := parseQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	result := h.searchService.Search(query)
+
+	messages := make([]models.Message, 0, len(result.Messages))
+	for _, m := range result.Messages {
+		messages = append(messages, models.Message{
+			ID:     m.ID,
+			Type:   m.Type,
+			Author: m.Author,
+			Value:  m.Message,
+		})
+	}
+
+	resultJson, err := json.Marshal(models.SearchResult{
+		Total:    result.Total,
+		Messages: messages,
+	})
+	if err != nil {
+		logger.FromContext(r.Context()).Error("error marshalling search result", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resultJson)
+}
+
+func parseQuery(r *http.Request) (search.Query, error) {
+	values := r.URL.Query()
+
+	query := search.Query{
+		Text:   values.Get("q"),
+		Author: values.Get("author"),
+		Room:   values.Get("room"),
+	}
+
+	var err error
+	if v := values.Get("from"); len(v) > 0 {
+		if query.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return search.Query{}, err
+		}
+	}
+
+	if v := values.Get("to"); len(v) > 0 {
+		if query.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return search.Query{}, err
+		}
+	}
+
+	if v := values.Get("limit"); len(v) > 0 {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			return search.Query{}, err
+		}
+	}
+
+	if v := values.Get("offset"); len(v) > 0 {
+		if query.Offset, err = strconv.Atoi(v); err != nil {
+			return search.Query{}, err
+		}
+
+		if query.Offset < 0 {
+			return search.Query{}, errors.New("negative offset")
+		}
+	}
+
+	return query, nil
+}
@@ -0,0 +1,97 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"gochat/cmd/server/models"
+	"gochat/internal/chat"
+	"gochat/internal/search"
+	"gochat/internal/storage/inmemory/user"
+)
+
+func TestParseQuery(t *testing.T) {
+	t.Parallel()
+
+	from := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, tc := range []struct {
+		target string
+		query  search.Query
+		err    bool
+	}{
+		{"/search?q=hello&author=alice&room=general", search.Query{Text: "hello", Author: "alice", Room: "general"}, false},
+		{"/search?from=2024-01-02T03:04:05Z&to=2024-01-02T03:04:05Z", search.Query{From: from, To: from}, false},
+		{"/search?from=yesterday", search.Query{}, true},
+		{"/search?to=2024-01-02", search.Query{}, true},
+		{"/search?limit=5&offset=10", search.Query{Limit: 5, Offset: 10}, false},
+		{"/search?limit=five", search.Query{}, true},
+		{"/search?offset=-1", search.Query{}, true},
+		{"/search?offset=ten", search.Query{}, true},
+	} {
+		query, err := parseQuery(httptest.NewRequest(http.MethodGet, tc.target, nil))
+		assert.Equal(t, tc.err, err != nil, tc.target)
+		assert.Equal(t, tc.query, query, tc.target)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	t.Parallel()
+
+	userStorage := user.New()
+	token := ulid.Make()
+	userStorage.Set(token, "user")
+
+	searchService := search.New()
+	chatService := chat.New(2*search.MaxLimit, searchService)
+	for i := 0; i < search.MaxLimit+1; i++ {
+		chatService.PostMessage(chat.Message{Author: "user", Message: "hello"})
+	}
+
+	h := New(userStorage, searchService)
+
+	for _, tc := range []struct {
+		target   string
+		token    string
+		status   int
+		total    int
+		messages int
+	}{
+		{"/search?q=hello", token.String(), http.StatusOK, search.MaxLimit + 1, search.DefaultLimit},
+		{"/search?q=hello&limit=0", token.String(), http.StatusOK, search.MaxLimit + 1, search.DefaultLimit},
+		{"/search?q=hello&limit=1000", token.String(), http.StatusOK, search.MaxLimit + 1, search.MaxLimit},
+		{"/search?q=hello&offset=100", token.String(), http.StatusOK, search.MaxLimit + 1, 1},
+		{"/search?q=hello&offset=1000", token.String(), http.StatusOK, search.MaxLimit + 1, 0},
+		{"/search?q=hello&room=random", token.String(), http.StatusOK, 0, 0},
+		{"/search?q=hello&from=invalid", token.String(), http.StatusBadRequest, 0, 0},
+		{"/search?q=hello", "", http.StatusUnauthorized, 0, 0},
+		{"/search?q=hello", ulid.Make().String(), http.StatusUnauthorized, 0, 0},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		r.Header.Set(models.BearerToken, tc.token)
+		w := httptest.NewRecorder()
+		h.Search(w, r)
+
+		assert.Equal(t, tc.status, w.Code, tc.target)
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var result models.SearchResult
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+		assert.Equal(t, tc.total, result.Total, tc.target)
+		assert.Len(t, result.Messages, tc.messages, tc.target)
+	}
+
+	w := httptest.NewRecorder()
+	h.Search(w, httptest.NewRequest(http.MethodPost, "/search", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
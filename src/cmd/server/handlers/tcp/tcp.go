@@ -0,0 +1,346 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"nhooyr.io/websocket"
+
+	"gochat/cmd/server/handlers/auth"
+	chatAPI "gochat/cmd/server/handlers/chat"
+	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/logger"
+	"gochat/internal/ratelimit"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/mention"
+	"gochat/internal/storage/inmemory/user"
+	"gochat/internal/tracing"
+	"gochat/internal/websocket/connection"
+	"gochat/internal/websocket/heartbeat"
+)
+
+// EndpointTCP is the endpoint of line protocol connections in the connection service.
+const EndpointTCP = "tcp"
+
+const (
+	// AuthTimeout is how long a new connection has to authenticate.
+	AuthTimeout = 30 * time.Second
+
+	WriteTimeout = 10 * time.Second
+
+	// MaxLineLength is the length of the longest line accepted, longer lines closing the connection.
+	MaxLineLength = 4096
+
+	// acceptRetryDelay throttles accepting again after an error, e.g. running out of file descriptors.
+	acceptRetryDelay = 100 * time.Millisecond
+)
+
+// TCPHandler serves a line protocol for clients such as nc, telnet or embedded devices. A client
+// authenticates with "AUTH <token>", answered by "OK <user>" or "ERR <reason>". Every following
+// line is published as a message, lines over the rate limit being answered by "ERR rate limited",
+// while the history and incoming messages are written as lines.
+type TCPHandler interface {
+	Serve(ln net.Listener) error
+}
+
+func New(
+	userStorage user.UserStorage,
+	mentionStorage mention.MentionStorage,
+	connService connection.ConnectionService,
+	chatService chat.ChatService,
+	roomService room.RoomService,
+	lifecycleService lifecycle.LifecycleService,
+	heartbeat *heartbeat.Settings,
+	rateLimit *ratelimit.Settings,
+) TCPHandler {
+	return handler{
+		userStorage:      userStorage,
+		mentionStorage:   mentionStorage,
+		connService:      connService,
+		chatService:      chatService,
+		roomService:      roomService,
+		lifecycleService: lifecycleService,
+		heartbeat:        heartbeat,
+		rateLimit:        rateLimit,
+	}
+}
+
+type handler struct {
+	userStorage      user.UserStorage
+	mentionStorage   mention.MentionStorage
+	connService      connection.ConnectionService
+	chatService      chat.ChatService
+	roomService      room.RoomService
+	lifecycleService lifecycle.LifecycleService
+	heartbeat        *heartbeat.Settings
+	rateLimit        *ratelimit.Settings
+}
+
+// Serve handles the connections of the listener until it is closed.
+func (h handler) Serve(ln net.Listener) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			logger.Default().Warn("error accepting connection", "endpoint", EndpointTCP, "error", err)
+			time.Sleep(acceptRetryDelay)
+
+			continue
+		}
+
+		go h.handle(c)
+	}
+}
+
+func (h handler) handle(nc net.Conn) {
+	c := &conn{conn: nc}
+	defer nc.Close()
+
+	log := logger.Default().With("endpoint", EndpointTCP, "remote_addr", nc.RemoteAddr().String())
+
+	lines := bufio.NewScanner(nc)
+	lines.Buffer(make([]byte, 0, 512), MaxLineLength)
+
+	nc.SetReadDeadline(time.Now().Add(AuthTimeout))
+	if !lines.Scan() {
+		return
+	}
+
+	value, ok := strings.CutPrefix(strings.TrimSpace(lines.Text()), "AUTH ")
+	if !ok {
+		c.writeLine("ERR expected AUTH <token>")
+
+		return
+	}
+
+	token, user, ok := auth.AuthenticateToken(strings.TrimSpace(value), EndpointTCP, h.userStorage)
+	if !ok {
+		c.writeLine("ERR unauthorized")
+
+		return
+	}
+
+	if h.lifecycleService.Draining() {
+		c.writeLine("ERR server is shutting down")
+
+		return
+	}
+
+	id, err := h.connService.Add(context.Background(), EndpointTCP, user, nc.RemoteAddr().String())
+	if err != nil {
+		c.writeLine("ERR " + err.Error())
+
+		return
+	}
+	defer h.connService.Remove(id)
+
+	log = log.With("conn_id", id, "user", user)
+
+	h.connService.Attach(id, c)
+
+	if err := c.writeLine("OK " + user); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(logger.NewContext(context.Background(), log))
+	defer cancel()
+
+	// Subscribing before taking the replay loses no message, the replayed ones being skipped.
+	messages := h.chatService.Subscribe(ctx, user)
+	replay := h.replay()
+
+	go h.deliver(ctx, id, c, replay, messages)
+
+	limiter := ratelimit.NewLimiter(h.rateLimit, EndpointTCP)
+
+	// Announce new user.
+	h.chatService.PostMessage(chat.Message{
+		Author:  chat.ChatAPIName,
+		Message: fmt.Sprintf("%s has joined the chat!", user),
+	})
+
+	for {
+		if idle := h.heartbeat.Load().IdleTimeout; idle > 0 {
+			nc.SetReadDeadline(time.Now().Add(idle))
+		} else {
+			nc.SetReadDeadline(time.Time{})
+		}
+
+		if !lines.Scan() {
+			break
+		}
+
+		h.connService.Record(id, len(lines.Bytes()))
+
+		text := strings.TrimSpace(lines.Text())
+		if len(text) < 1 {
+			continue
+		}
+
+		if !limiter.Allow() {
+			c.writeLine("ERR rate limited")
+
+			continue
+		}
+
+		h.post(ctx, user, text)
+	}
+
+	if err := lines.Err(); errors.Is(err, os.ErrDeadlineExceeded) {
+		log.Info("closing idle connection")
+	} else if errors.Is(err, bufio.ErrTooLong) {
+		c.writeLine("ERR line too long")
+	} else if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Warn("error reading line", "error", err)
+	}
+
+	h.userStorage.Remove(token)
+
+	// Announce user left.
+	h.chatService.PostMessage(chat.Message{
+		Author:  chat.ChatAPIName,
+		Message: fmt.Sprintf("%s has left the chat!", user),
+	})
+}
+
+// post publishes a line of the user, traced like messages published over websocket.
+func (h handler) post(ctx context.Context, user, text string) {
+	_, span := tracing.Start(ctx, "chat.publish", "user", user, "endpoint", EndpointTCP)
+	defer span.End()
+
+	posted := h.chatService.PostMessage(chat.Message{
+		Author:      user,
+		Message:     text,
+		TraceParent: span.TraceParent(),
+	})
+
+	chatAPI.NotifyMentions(h.userStorage, h.mentionStorage, h.chatService, posted)
+}
+
+// deliver writes the replay and the subscribed messages, closing the connection when a write fails
+// or the server shuts down.
+func (h handler) deliver(ctx context.Context, id ulid.ULID, c *conn, replay []chat.Message, messages <-chan chat.Message) {
+	log := logger.FromContext(ctx)
+
+	for _, msg := range replay {
+		if err := h.write(id, c, msg); err != nil {
+			log.Warn("error sending history", "error", err)
+			c.conn.Close()
+
+			return
+		}
+	}
+
+	last := chat.LastID(replay)
+	for msg := range messages {
+		if chat.Replayed(msg, last) {
+			continue
+		}
+
+		err := chatAPI.TraceDelivery("tcp.write", id, msg, func() error {
+			return h.write(id, c, msg)
+		})
+		if err != nil {
+			log.Info("error sending message", "error", err)
+			c.conn.Close()
+
+			return
+		}
+
+		if msg.Type == chat.TypeShutdown {
+			c.conn.Close()
+
+			return
+		}
+	}
+}
+
+// replay returns the history followed by the room topic, for new connections to catch up.
+func (h handler) replay() []chat.Message {
+	replay := h.chatService.History()
+	if topic := h.roomService.Room().Topic; len(topic) > 0 {
+		replay = append(replay, chat.Message{
+			Type:    chat.TypeTopic,
+			Author:  chat.ChatAPIName,
+			Message: topic,
+		})
+	}
+
+	return replay
+}
+
+func (h handler) write(id ulid.ULID, c *conn, msg chat.Message) error {
+	line, ok := format(msg)
+	if !ok {
+		return nil
+	}
+
+	if err := c.writeLine(line); err != nil {
+		return err
+	}
+
+	h.connService.Record(id, len(line)+1)
+
+	return nil
+}
+
+var flatten = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// format renders the message as a line, events without a text form such as reactions being
+// skipped.
+func format(msg chat.Message) (string, bool) {
+	text := flatten.Replace(msg.Message)
+
+	switch msg.Type {
+	case chat.TypeMessage:
+		return msg.Author + ": " + text, true
+	case chat.TypeMention:
+		return "* " + msg.Author + " mentioned you: " + text, true
+	case chat.TypeDirect:
+		return "* " + msg.Author + " (direct): " + text, true
+	case chat.TypeTopic:
+		return "* Topic: " + text, true
+	case chat.TypeShutdown:
+		return "* " + text, true
+	default:
+		return "", false
+	}
+}
+
+// conn serializes the writes of the reader and the subscription to a line protocol connection.
+type conn struct {
+	sync.Mutex
+	conn net.Conn
+}
+
+func (c *conn) writeLine(line string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	_, err := c.conn.Write([]byte(line + "\n"))
+
+	return err
+}
+
+// Close writes the reason before closing the connection, for the connection service to disconnect
+// it like websocket connections.
+func (c *conn) Close(_ websocket.StatusCode, reason string) error {
+	if len(reason) > 0 {
+		c.writeLine("* " + reason)
+	}
+
+	return c.conn.Close()
+}
@@ -0,0 +1,195 @@
+package tcp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/chat"
+	"gochat/internal/lifecycle"
+	"gochat/internal/ratelimit"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/mention"
+	inmemoryRoom "gochat/internal/storage/inmemory/room"
+	"gochat/internal/storage/inmemory/user"
+	"gochat/internal/websocket/connection"
+	"gochat/internal/websocket/heartbeat"
+)
+
+type fixture struct {
+	addr        string
+	token       ulid.ULID
+	userStorage user.UserStorage
+	chatService chat.ChatService
+}
+
+// newFixture serves the line protocol on a local port with a joined user.
+func newFixture(t *testing.T, limits connection.Limits, rateLimit ratelimit.Config) fixture {
+	userStorage := user.New()
+	chatService := chat.New(chat.DefaultHistorySize)
+	connService := connection.New(limits)
+
+	h := New(
+		userStorage,
+		mention.New(),
+		connService,
+		chatService,
+		room.New(inmemoryRoom.New(), chatService, []string{}),
+		lifecycle.New(),
+		heartbeat.NewSettings(heartbeat.Config{}),
+		ratelimit.NewSettings(rateLimit),
+	)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	go h.Serve(ln)
+	t.Cleanup(func() {
+		ln.Close()
+		connService.Close()
+	})
+
+	token := ulid.Make()
+	userStorage.Set(token, "user")
+
+	return fixture{
+		addr:        ln.Addr().String(),
+		token:       token,
+		userStorage: userStorage,
+		chatService: chatService,
+	}
+}
+
+type client struct {
+	t     *testing.T
+	conn  net.Conn
+	lines *bufio.Scanner
+}
+
+func dial(t *testing.T, addr string) client {
+	c, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	return client{t: t, conn: c, lines: bufio.NewScanner(c)}
+}
+
+func (c client) send(line string) {
+	_, err := fmt.Fprintf(c.conn, "%s\n", line)
+	assert.NoError(c.t, err)
+}
+
+// expect reads lines until the expected one, failing on timeout or when the connection is closed.
+func (c client) expect(line string) {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for c.lines.Scan() {
+		if c.lines.Text() == line {
+			return
+		}
+	}
+
+	c.t.Errorf("line %q not received: %v", line, c.lines.Err())
+}
+
+func TestLineProtocol(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, connection.Limits{}, ratelimit.Config{})
+	f.chatService.PostMessage(chat.Message{Author: "other", Message: "multi\nline"})
+
+	c := dial(t, f.addr)
+	c.send("AUTH " + f.token.String())
+	c.expect("OK user")
+	c.expect("other: multi line")
+	c.expect("GoChat: user has joined the chat!")
+
+	c.send("hello from tcp")
+	c.expect("user: hello from tcp")
+
+	history := f.chatService.History()
+	assert.Equal(t, "hello from tcp", history[len(history)-1].Message)
+
+	f.chatService.PostMessage(chat.Message{Type: chat.TypeMention, Author: "other", Message: "@user hi", Recipient: "user"})
+	c.expect("* other mentioned you: @user hi")
+
+	f.chatService.PostMessage(chat.Message{Type: chat.TypeShutdown, Author: chat.ChatAPIName, Message: "Server is restarting."})
+	c.expect("* Server is restarting.")
+	assert.False(t, c.lines.Scan())
+
+	// Disconnecting leaves the chat like websocket publishers do.
+	assert.Eventually(t, func() bool {
+		return len(f.userStorage.Get(f.token)) < 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, connection.Limits{}, ratelimit.Config{})
+
+	c := dial(t, f.addr)
+	c.send("AUTH " + ulid.Make().String())
+	c.expect("ERR unauthorized")
+	assert.False(t, c.lines.Scan())
+
+	// A valid token is rejected without the AUTH command.
+	c = dial(t, f.addr)
+	c.send(f.token.String())
+	c.expect("ERR expected AUTH <token>")
+	assert.False(t, c.lines.Scan())
+}
+
+func TestLimits(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, connection.Limits{PerUser: 1}, ratelimit.Config{})
+
+	first := dial(t, f.addr)
+	first.send("AUTH " + f.token.String())
+	first.expect("OK user")
+
+	second := dial(t, f.addr)
+	second.send("AUTH " + f.token.String())
+	second.expect("ERR " + connection.ErrUserLimit.Error())
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, connection.Limits{}, ratelimit.Config{Rate: 0.001, Burst: 1})
+
+	c := dial(t, f.addr)
+	c.send("AUTH " + f.token.String())
+	c.expect("OK user")
+
+	c.send("first")
+	c.expect("user: first")
+
+	c.send("second")
+	c.expect("ERR rate limited")
+
+	for _, msg := range f.chatService.History() {
+		assert.NotEqual(t, "second", msg.Message)
+	}
+}
+
+func TestLineTooLong(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, connection.Limits{}, ratelimit.Config{})
+
+	c := dial(t, f.addr)
+	c.send("AUTH " + f.token.String())
+	c.expect("OK user")
+
+	// Unread data would reset the connection on close, so exactly a full line buffer is sent.
+	_, err := c.conn.Write([]byte(strings.Repeat("a", MaxLineLength)))
+	assert.NoError(t, err)
+	c.expect("ERR line too long")
+}
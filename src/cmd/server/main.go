@@ -2,71 +2,460 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"fmt"
-	"log"
+	"flag"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/oklog/ulid/v2"
+
+	adminAPI "gochat/cmd/server/handlers/admin"
 	chatAPI "gochat/cmd/server/handlers/chat"
+	corsAPI "gochat/cmd/server/handlers/cors"
+	healthAPI "gochat/cmd/server/handlers/health"
+	hookAPI "gochat/cmd/server/handlers/hook"
+	ircAPI "gochat/cmd/server/handlers/irc"
 	joinAPI "gochat/cmd/server/handlers/join"
+	mentionAPI "gochat/cmd/server/handlers/mention"
+	metricsAPI "gochat/cmd/server/handlers/metrics"
+	receiptAPI "gochat/cmd/server/handlers/receipt"
+	requestAPI "gochat/cmd/server/handlers/request"
+	restAPI "gochat/cmd/server/handlers/rest"
+	searchAPI "gochat/cmd/server/handlers/search"
+	tcpAPI "gochat/cmd/server/handlers/tcp"
+	"gochat/internal/certificate"
 	"gochat/internal/chat"
+	"gochat/internal/config"
+	"gochat/internal/health"
+	"gochat/internal/lifecycle"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/origin"
+	"gochat/internal/poll"
+	"gochat/internal/ratelimit"
+	"gochat/internal/receipt"
+	"gochat/internal/reload"
+	"gochat/internal/room"
+	"gochat/internal/search"
+	"gochat/internal/storage/inmemory/ban"
+	"gochat/internal/storage/inmemory/hook"
+	"gochat/internal/storage/inmemory/mention"
+	inmemoryReceipt "gochat/internal/storage/inmemory/receipt"
+	inmemoryRoom "gochat/internal/storage/inmemory/room"
 	"gochat/internal/storage/inmemory/user"
+	"gochat/internal/tracing"
+	"gochat/internal/webhook"
 	"gochat/internal/websocket/connection"
+	"gochat/internal/websocket/heartbeat"
 )
 
-const EnvGoChatPort = "GO_CHAT_PORT"
+// ReconnectDelay is the hint sent to clients on when to reconnect after shutdown.
+const ReconnectDelay = 5 * time.Second
 
 func main() {
-	port := os.Getenv(EnvGoChatPort)
-	if len(port) < 1 {
-		port = "4001"
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+
+		fatal("invalid config", err)
+	}
+
+	if cfg.PrintConfig {
+		out, err := cfg.YAML()
+		if err != nil {
+			fatal("error printing config", err)
+		}
+
+		os.Stdout.Write(out)
+
+		return
+	}
+
+	log := logger.New(os.Stderr, cfg.LogLevel(), cfg.Logging.Format)
+	logger.SetDefault(log)
+
+	log.Info("starting server")
+
+	exporter, err := traceExporter(cfg.Tracing)
+	if err != nil {
+		fatal("error configuring tracing", err)
 	}
 
-	log.Println("Starting server...")
+	if exporter != nil {
+		tracing.Default.SetExporter(exporter)
+	}
+
+	mentionStorage := mention.New()
+	receiptStorage := inmemoryReceipt.New()
+	roomStorage := inmemoryRoom.New()
+	banStorage := ban.New()
+	hookStorage, err := hook.New(cfg.Webhooks.IncomingFile)
+	if err != nil {
+		fatal("error loading incoming webhooks", err)
+	}
+
+	lifecycleService := lifecycle.New()
+	connService := connection.New(cfg.ConnectionLimits())
+	searchService := search.New()
+	chatService := chat.New(cfg.History.Size, searchService)
+	chatService.SetBannedWords(cfg.BannedWords)
+	receiptService := receipt.New(receiptStorage, chatService)
+	rateLimitSettings := ratelimit.NewSettings(cfg.RateLimit())
+	userRateLimit := ratelimit.NewUsers(rateLimitSettings)
+	userStorage := user.New(mentionStorage, receiptService, userRateLimit)
+	roomService := room.New(roomStorage, chatService, cfg.Moderators)
+	roomService.SetModeratorKey(cfg.ModeratorKey)
+	pollService := poll.New(chatService, cfg.PollTimeouts())
+
+	webhookService, err := webhook.New(chatService, cfg.Webhooks.HooksFile, cfg.Webhooks.QueueFile, cfg.Webhooks.DeadLetterFile)
+	if err != nil {
+		fatal("error loading webhook queue", err)
+	}
+
+	// Users joining and leaving are published to webhooks whichever transport they use.
+	userStorage = webhook.Users(userStorage, webhookService)
+
+	// Queues are aggregated rather than labelled by user, keeping the metric cardinality bounded.
+	metrics.Default.GaugeFunc("gochat_subscriber_queue_depth", "Messages waiting to be sent to subscribers.", func() []metrics.Sample {
+		total := 0
+		for _, queued := range chatService.Queued() {
+			total += queued
+		}
+
+		return []metrics.Sample{{Value: float64(total)}}
+	})
+	metrics.Default.GaugeFunc("gochat_subscriber_queue_depth_max", "Messages waiting to be sent to the most backed up user.", func() []metrics.Sample {
+		deepest := 0
+		for _, queued := range chatService.Queued() {
+			if queued > deepest {
+				deepest = queued
+			}
+		}
+
+		return []metrics.Sample{{Value: float64(deepest)}}
+	})
 
-	userStorage := user.New()
+	healthService := health.New(health.DefaultTimeout, map[string]health.Check{
+		// Storages are in memory, so they are healthy as long as they respond.
+		"storage": func() error {
+			userStorage.Get(ulid.ULID{})
+			mentionStorage.List("", true)
+			receiptStorage.Get("", "")
+			roomStorage.Get()
 
-	connService := connection.New()
-	chatService := chat.New()
+			return nil
+		},
+		// Reads take the chat lock, which fan-out does not hold while waiting for subscribers, so this
+		// fails when the chat is stuck rather than when a subscriber is slow.
+		"chat": func() error {
+			chatService.History()
 
-	joinHandler := joinAPI.New(userStorage)
-	chatHandler := chatAPI.New(userStorage, connService, chatService)
+			return nil
+		},
+		"lifecycle": func() error {
+			if lifecycleService.Draining() {
+				return lifecycle.ErrDraining
+			}
 
-	http.HandleFunc("/join", joinHandler.Join)
+			return nil
+		},
+	})
+
+	originService := origin.New(cfg.AllowedOrigins)
+	heartbeatSettings := heartbeat.NewSettings(cfg.Heartbeat())
+
+	reloadService := reload.New(cfg, func() (config.Config, error) {
+		return config.Load(os.Args[1:], os.Getenv)
+	}, func(cfg config.Config) {
+		connService.SetLimits(cfg.ConnectionLimits())
+		chatService.SetHistorySize(cfg.History.Size)
+		chatService.SetBannedWords(cfg.BannedWords)
+		roomService.SetModerators(cfg.Moderators)
+		roomService.SetModeratorKey(cfg.ModeratorKey)
+		originService.SetPatterns(cfg.AllowedOrigins)
+		heartbeatSettings.Store(cfg.Heartbeat())
+		rateLimitSettings.Store(cfg.RateLimit())
+		pollService.SetTimeouts(cfg.PollTimeouts())
+		log.SetLevel(cfg.LogLevel())
+		log.SetFormat(cfg.Logging.Format)
+	})
+
+	joinHandler := joinAPI.New(userStorage, banStorage, roomService, lifecycleService)
+	chatHandler := chatAPI.New(userStorage, mentionStorage, connService, chatService, receiptService, roomService, lifecycleService, originService, pollService, heartbeatSettings, rateLimitSettings)
+	mentionHandler := mentionAPI.New(userStorage, mentionStorage)
+	receiptHandler := receiptAPI.New(userStorage, receiptService)
+	searchHandler := searchAPI.New(userStorage, searchService)
+	restHandler := restAPI.New(userStorage, mentionStorage, chatService, roomService, lifecycleService, userRateLimit)
+	corsHandler := corsAPI.New(originService)
+	metricsHandler := metricsAPI.New(metrics.Default)
+	healthHandler := healthAPI.New(healthService)
+	requestHandler := requestAPI.New()
+	hookHandler := hookAPI.New(hookStorage, userStorage, mentionStorage, chatService, lifecycleService, userRateLimit)
+	tcpHandler := tcpAPI.New(userStorage, mentionStorage, connService, chatService, roomService, lifecycleService, heartbeatSettings, rateLimitSettings)
+	ircHandler := ircAPI.New(userStorage, banStorage, mentionStorage, connService, chatService, receiptService, roomService, lifecycleService, heartbeatSettings, userRateLimit)
+	adminHandler := adminAPI.New(cfg.Admin.Token, userStorage, banStorage, connService, chatService, roomService, lifecycleService, reloadService, webhookService, hookStorage)
+
+	http.HandleFunc("/join", corsHandler.Handle(joinHandler.Join))
 	http.HandleFunc("/subscribe", chatHandler.Subscribe)
 	http.HandleFunc("/publish", chatHandler.Publish)
+	http.HandleFunc("/events", corsHandler.Handle(chatHandler.Events))
+	http.HandleFunc("/poll", corsHandler.Handle(chatHandler.Poll))
+	http.HandleFunc("/mentions", corsHandler.Handle(mentionHandler.Mentions))
+	http.HandleFunc("/read", corsHandler.Handle(receiptHandler.Read))
+	http.HandleFunc("/unread", corsHandler.Handle(receiptHandler.Unread))
+	http.HandleFunc("/search", corsHandler.Handle(searchHandler.Search))
+	http.HandleFunc("/users", corsHandler.Handle(restHandler.Users))
+	http.HandleFunc("/rooms", corsHandler.Handle(restHandler.Rooms))
+	http.HandleFunc("/rooms/", corsHandler.Handle(restHandler.Rooms))
+	http.HandleFunc("/messages/", corsHandler.Handle(restHandler.Messages))
+	http.HandleFunc("/hooks/", hookHandler.Post)
+	http.HandleFunc("/openapi.yaml", corsHandler.Handle(restHandler.OpenAPI))
+	http.HandleFunc("/metrics", metricsHandler.Metrics)
+	http.HandleFunc("/healthz", healthHandler.Healthz)
+	http.HandleFunc("/readyz", healthHandler.Readyz)
 
-	term := make(chan os.Signal, 1)
-	signal.Notify(term, syscall.SIGTERM)
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("/admin/users", adminHandler.Authenticate(adminHandler.Users))
+	adminMux.HandleFunc("/admin/sessions", adminHandler.Authenticate(adminHandler.Sessions))
+	adminMux.HandleFunc("/admin/sessions/", adminHandler.Authenticate(adminHandler.Sessions))
+	adminMux.HandleFunc("/admin/announcements", adminHandler.Authenticate(adminHandler.Announcements))
+	adminMux.HandleFunc("/admin/room", adminHandler.Authenticate(adminHandler.Room))
+	adminMux.HandleFunc("/admin/room/pins", adminHandler.Authenticate(adminHandler.Pins))
+	adminMux.HandleFunc("/admin/room/pins/", adminHandler.Authenticate(adminHandler.Pins))
+	adminMux.HandleFunc("/admin/messages/", adminHandler.Authenticate(adminHandler.Messages))
+	adminMux.HandleFunc("/admin/bans", adminHandler.Authenticate(adminHandler.Bans))
+	adminMux.HandleFunc("/admin/bans/", adminHandler.Authenticate(adminHandler.Bans))
+	adminMux.HandleFunc("/admin/stats", adminHandler.Authenticate(adminHandler.Stats))
+	adminMux.HandleFunc("/admin/webhooks", adminHandler.Authenticate(adminHandler.Webhooks))
+	adminMux.HandleFunc("/admin/webhooks/", adminHandler.Authenticate(adminHandler.Webhooks))
+	adminMux.HandleFunc("/admin/incoming-webhooks", adminHandler.Authenticate(adminHandler.IncomingWebhooks))
+	adminMux.HandleFunc("/admin/incoming-webhooks/", adminHandler.Authenticate(adminHandler.IncomingWebhooks))
+	adminMux.HandleFunc("/admin/reload", adminHandler.Authenticate(adminHandler.Reload))
 
-	srv := http.Server{
-		Addr: fmt.Sprintf(":%s", port),
+	// The admin API is disabled without a token, and served on its own listener when one is configured.
+	adminEnabled := len(cfg.Admin.Token) > 0
+	if adminEnabled && len(cfg.Admin.Listen) < 1 {
+		http.Handle("/admin/", adminMux)
 	}
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("error on serving API: %v\n", err)
+		for range hup {
+			log.Info("reloading config")
+
+			if err := reloadService.Reload(); err != nil {
+				log.Error("error reloading config, keeping the current one", "error", err)
+
+				continue
+			}
+
+			log.Info("config reloaded")
 		}
 	}()
 
-	log.Printf("Server ready on %s!\n", srv.Addr)
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM, syscall.SIGINT)
+
+	srv := http.Server{
+		Addr:     cfg.Listen.Address,
+		Handler:  requestHandler.Handle(http.DefaultServeMux.ServeHTTP),
+		ErrorLog: log.StdLogger(logger.LevelWarn),
+	}
+
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+
+	go pollService.Run(watchCtx)
+	go webhookService.Run(watchCtx)
+
+	if cfg.TLS.Enabled {
+		srv.TLSConfig, err = tlsConfig(watchCtx, cfg.TLS)
+		if err != nil {
+			fatal("error configuring TLS", err)
+		}
+	}
+
+	servers := []*http.Server{&srv}
+	if adminEnabled && len(cfg.Admin.Listen) > 0 {
+		servers = append(servers, &http.Server{
+			Addr:      cfg.Admin.Listen,
+			Handler:   requestHandler.Handle(adminMux.ServeHTTP),
+			ErrorLog:  srv.ErrorLog,
+			TLSConfig: srv.TLSConfig,
+		})
+	}
+
+	// The line protocol and IRC are served on their own listeners when they are configured.
+	listeners := []net.Listener{}
+	for _, l := range []struct {
+		name    string
+		address string
+		useTLS  bool
+		serve   func(ln net.Listener) error
+	}{
+		{"line protocol", cfg.TCP.Listen, cfg.TCP.TLS, tcpHandler.Serve},
+		{"IRC", cfg.IRC.Listen, cfg.IRC.TLS, ircHandler.Serve},
+	} {
+		l := l
+		if len(l.address) < 1 {
+			continue
+		}
+
+		ln, err := net.Listen("tcp", l.address)
+		if err != nil {
+			fatal("error listening for "+l.name, err)
+		}
+
+		if l.useTLS {
+			ln = tls.NewListener(ln, srv.TLSConfig)
+		}
+
+		listeners = append(listeners, ln)
+
+		go func() {
+			if err := l.serve(ln); err != nil {
+				fatal("error on serving "+l.name, err)
+			}
+		}()
+	}
+
+	for _, s := range servers {
+		go serve(s, cfg.TLS.Enabled)
+	}
+
+	log.Info("server ready", "address", srv.Addr, "tls", cfg.TLS.Enabled, "admin", adminEnabled, "admin_address", cfg.Admin.Listen, "tcp_address", cfg.TCP.Listen, "irc_address", cfg.IRC.Listen)
 
 	<-term
 
-	log.Println("Closing websocket connections...")
+	ctx, cancel := context.WithTimeout(context.Background(), reloadService.Config().Timeouts.Shutdown)
+	defer cancel()
+
+	log.Info("draining server")
+
+	lifecycleService.Drain()
+
+	// Subscribers close their connections once the shutdown event is delivered.
+	announced := make(chan struct{})
+	go func() {
+		defer close(announced)
+
+		chatService.PostMessage(chat.Message{
+			Type:       chat.TypeShutdown,
+			Author:     chat.ChatAPIName,
+			Message:    "Server is restarting, please reconnect.",
+			RetryAfter: ReconnectDelay,
+		})
+	}()
+
+	select {
+	case <-announced:
+	case <-ctx.Done():
+		log.Warn("timed out announcing shutdown")
+	}
+
+	// Publishers never get the shutdown event, so they are closed once it is announced.
+	connService.Close(chatAPI.EndpointPublish)
+
+	if err := connService.Wait(ctx); err != nil {
+		log.Warn("timed out draining websocket connections", "error", err)
+	}
+
+	log.Info("closing websocket connections")
 
 	connService.Close()
+	pollService.Close()
+
+	log.Info("websocket connections closed")
+
+	log.Info("stopping server")
+
+	for _, ln := range listeners {
+		ln.Close()
+	}
+
+	for _, s := range servers {
+		if err := s.Shutdown(ctx); err != nil {
+			fatal("error shutting down server", err)
+		}
+	}
+
+	// Changes of the webhook queue since the last save are kept for the next start.
+	webhookService.Flush()
+
+	if err := tracing.Default.Shutdown(ctx); err != nil {
+		log.Warn("error flushing spans", "error", err)
+	}
+
+	log.Info("server stopped")
+}
+
+// fatal logs the error and exits.
+func fatal(msg string, err error) {
+	logger.Default().Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// serve serves the API until the server is shut down, the certificate of TLS servers being served
+// by their TLS config.
+func serve(srv *http.Server, useTLS bool) {
+	var err error
+	if useTLS {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal("error on serving API", err)
+	}
+}
+
+// traceExporter creates the configured span exporter, nil when tracing is disabled.
+func traceExporter(cfg config.Tracing) (tracing.Exporter, error) {
+	switch cfg.Exporter {
+	case tracing.ExporterStdout:
+		return tracing.NewStdoutExporter(os.Stdout), nil
+	case tracing.ExporterOTLPFile:
+		return tracing.NewOTLPFileExporter(cfg.File)
+	case tracing.ExporterOTLPHTTP:
+		return tracing.NewOTLPHTTPExporter(cfg.Endpoint, &http.Client{Timeout: 10 * time.Second}), nil
+	default:
+		return nil, nil
+	}
+}
+
+// tlsConfig serves the configured certificate, reloading it on changes until the context is done,
+// and requires client certificates when a client CA file is configured.
+func tlsConfig(ctx context.Context, cfg config.TLS) (*tls.Config, error) {
+	certService, err := certificate.New(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
 
-	log.Println("Websocket connections closed")
+	go certService.Watch(ctx, certificate.DefaultWatchInterval)
 
-	log.Println("Stopping server...")
+	tlsCfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certService.GetCertificate,
+	}
+
+	if len(cfg.ClientCAFile) > 0 {
+		tlsCfg.ClientCAs, err = certificate.LoadCAs(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
 
-	if err := srv.Shutdown(context.Background()); err != nil {
-		log.Fatalf("error shutting down server: %v\n", err)
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
 	}
 
-	log.Println("Server stopped.")
+	return tlsCfg, nil
 }
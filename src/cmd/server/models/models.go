@@ -1,11 +1,43 @@
 package models
 
-import "github.com/oklog/ulid/v2"
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
 
 const BearerToken = "Bearer"
 
+// Message types sent by clients on the publish connection.
+const (
+	TypeMessage        = "message"
+	TypeAddReaction    = "reaction_add"
+	TypeRemoveReaction = "reaction_remove"
+	TypeRead           = "read"
+	TypeSetTopic       = "topic_set"
+	TypeAddPin         = "pin_add"
+	TypeRemovePin      = "pin_remove"
+)
+
+// Message types sent by the server on the subscribe connection.
+const (
+	TypeReaction = "reaction"
+	TypeMention  = "mention"
+	TypeDirect   = "direct"
+	TypeUnread   = "unread"
+	TypeReceipt  = "receipt"
+	TypeTopic    = "topic"
+	TypePin      = "pin"
+	TypeUnpin    = "unpin"
+	TypeDelete   = "delete"
+	TypeShutdown = "shutdown"
+)
+
 type User struct {
 	Name string
+
+	// Key is the moderator key, needed to join with a moderator name.
+	Key string `json:",omitempty"`
 }
 
 type Token struct {
@@ -13,6 +45,162 @@ type Token struct {
 }
 
 type Message struct {
-	Author string
-	Value  string
+	ID        ulid.ULID
+	Type      string
+	Author    string
+	Value     string
+	Reactions []Reaction `json:",omitempty"`
+	Count     int        `json:",omitempty"`
+
+	// Conversation is the room or the "@user" direct conversation of read, unread and receipt
+	// messages, the room when empty.
+	Conversation string `json:",omitempty"`
+
+	// RetryAfter is the number of seconds after which clients should reconnect.
+	RetryAfter int `json:",omitempty"`
+
+	// TraceParent is the W3C trace context of the message when it is traced.
+	TraceParent string `json:",omitempty"`
+}
+
+type Reaction struct {
+	Value string
+	Count int
+	Users []string
+}
+
+type Mention struct {
+	MessageID ulid.ULID
+	Author    string
+	Value     string
+	Read      bool
+}
+
+type MarkRead struct {
+	MessageIDs []ulid.ULID
+}
+
+type Unread struct {
+	Conversation string
+	LastRead     ulid.ULID
+	Count        int
+}
+
+type Read struct {
+	MessageID ulid.ULID
+
+	// Conversation is the room or the "@user" direct conversation, the room when empty.
+	Conversation string `json:",omitempty"`
+}
+
+type SearchResult struct {
+	Total    int
+	Messages []Message
+}
+
+// Health statuses of the server and its checks.
+const (
+	StatusOK       = "ok"
+	StatusNotReady = "not ready"
+)
+
+type Health struct {
+	Status string
+	Checks map[string]string `json:",omitempty"`
+}
+
+type Error struct {
+	Error string
+}
+
+type Session struct {
+	ID          ulid.ULID
+	Endpoint    string
+	User        string
+	RemoteAddr  string
+	ConnectedAt time.Time
+	Messages    int64
+	Bytes       int64
+}
+
+type AdminUser struct {
+	Name     string
+	Sessions int
+}
+
+type Announcement struct {
+	Value string
+}
+
+type Pin struct {
+	MessageID ulid.ULID
+	Author    string
+	Value     string
+	PinnedBy  string
+}
+
+type Room struct {
+	ID         string
+	Topic      string
+	Pins       []Pin
+	Moderators []string
+}
+
+// Page is a window of messages in chronological order with the cursors of the adjacent pages,
+// empty when there are no older or newer messages.
+type Page struct {
+	Messages []Message
+	Before   string `json:",omitempty"`
+	After    string `json:",omitempty"`
+}
+
+type Post struct {
+	Value string
+}
+
+// Poll is the result of a long-poll, Cursor being passed back to the next poll.
+type Poll struct {
+	Messages []Message
+	Cursor   string
+}
+
+type SetTopic struct {
+	Topic string
+}
+
+type Ban struct {
+	Name     string
+	Reason   string
+	BannedAt time.Time
+}
+
+// Webhook is a registered webhook, its secret only being shown when it is registered.
+type Webhook struct {
+	ID        ulid.ULID
+	URL       string
+	Events    []string
+	Secret    string `json:",omitempty"`
+	CreatedAt time.Time
+}
+
+// IncomingWebhook is a hook external systems post to as a bot, its token only being shown when it
+// is created.
+type IncomingWebhook struct {
+	ID        ulid.ULID
+	Room      string
+	Name      string
+	BotName   string
+	Token     string `json:",omitempty"`
+	CreatedAt time.Time
+}
+
+type Stats struct {
+	Users      int
+	Sessions   map[string]int
+	Queued     int
+	History    int
+	Bans       int
+	Goroutines int
+	Uptime     int64
+	Draining   bool
 }
@@ -2,13 +2,15 @@ module gochat
 
 go 1.20
 
-require nhooyr.io/websocket v1.8.7
+require (
+	github.com/stretchr/testify v1.8.4
+	gopkg.in/yaml.v3 v3.0.1
+	nhooyr.io/websocket v1.8.7
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.8.4 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 require (
@@ -0,0 +1,137 @@
+package certificate
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"gochat/internal/logger"
+)
+
+// DefaultWatchInterval is how often the certificate files are checked for changes.
+const DefaultWatchInterval = 10 * time.Second
+
+var ErrInvalidCA = errors.New("no certificates found in CA file")
+
+// CertificateService serves the TLS certificate loaded from files, reloading it when they change.
+type CertificateService interface {
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+	Watch(ctx context.Context, interval time.Duration)
+}
+
+func New(certFile, keyFile string) (CertificateService, error) {
+	s := &service{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+type service struct {
+	sync.Mutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+func (s *service) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.cert, nil
+}
+
+// Watch reloads the certificate every interval when the files have changed, until the context is
+// done. A certificate that fails to load is logged and the current one kept.
+func (s *service) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := s.reload()
+			if err != nil {
+				logger.Default().Warn("error reloading certificate, keeping the current one", "error", err)
+
+				continue
+			}
+
+			if reloaded {
+				logger.Default().Info("certificate reloaded")
+			}
+		}
+	}
+}
+
+// reload loads the certificate if the files were modified since the last load.
+func (s *service) reload() (bool, error) {
+	modified, err := lastModified(s.certFile, s.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	s.Lock()
+	unchanged := s.cert != nil && modified.Equal(s.modified)
+	s.Unlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.cert = &cert
+	s.modified = modified
+
+	return true, nil
+}
+
+func lastModified(files ...string) (time.Time, error) {
+	var last time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+
+	return last, nil
+}
+
+// LoadCAs reads a PEM bundle of CA certificates.
+func LoadCAs(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, ErrInvalidCA
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,114 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate writes a self-signed certificate for the common name and its key.
+func writeCertificate(t *testing.T, dir, commonName string, modified time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	assert.NoError(t, os.Chtimes(certFile, modified, modified))
+	assert.NoError(t, os.Chtimes(keyFile, modified, modified))
+
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, s CertificateService) string {
+	cert, err := s.GetCertificate(nil)
+	assert.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+
+	return leaf.Subject.CommonName
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	certFile, keyFile := writeCertificate(t, t.TempDir(), "first", time.Now())
+
+	s, err := New(certFile, keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, s))
+
+	_, err = New(filepath.Join(t.TempDir(), "missing.pem"), keyFile)
+	assert.Error(t, err)
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	now := time.Now()
+	certFile, keyFile := writeCertificate(t, dir, "first", now.Add(-time.Minute))
+
+	s, err := New(certFile, keyFile)
+	assert.NoError(t, err)
+
+	reloaded, err := s.(*service).reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+
+	writeCertificate(t, dir, "second", now)
+
+	reloaded, err = s.(*service).reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "second", commonName(t, s))
+
+	assert.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+	assert.NoError(t, os.Chtimes(certFile, now.Add(time.Minute), now.Add(time.Minute)))
+
+	_, err = s.(*service).reload()
+	assert.Error(t, err)
+	assert.Equal(t, "second", commonName(t, s))
+}
+
+func TestLoadCAs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, "ca", time.Now())
+
+	pool, err := LoadCAs(certFile)
+	assert.NoError(t, err)
+	assert.NotNil(t, pool)
+
+	_, err = LoadCAs(keyFile)
+	assert.Equal(t, ErrInvalidCA, err)
+}
@@ -1,37 +1,556 @@
 package chat
 
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/oklog/ulid/v2"
+
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+	"gochat/internal/tracing"
+)
+
 const (
 	ChatAPIName = "GoChat"
+
+	// BotSuffix marks the names of bots posting through incoming webhooks, which users cannot join
+	// with.
+	BotSuffix = " [bot]"
+
+	// DefaultHistorySize is the default number of most recent messages kept for replay.
+	DefaultHistorySize = 100
+
+	// SubscriptionBuffer is the number of messages queued for a subscriber before posting waits for it.
+	SubscriptionBuffer = 16
+)
+
+const (
+	TypeMessage  = "message"
+	TypeReaction = "reaction"
+	TypeMention  = "mention"
+	TypeDirect   = "direct"
+	TypeUnread   = "unread"
+	TypeReceipt  = "receipt"
+	TypeTopic    = "topic"
+	TypePin      = "pin"
+	TypeUnpin    = "unpin"
+	TypeDelete   = "delete"
+	TypeShutdown = "shutdown"
+)
+
+var (
+	messagesPublished = metrics.Default.Counter("gochat_messages_published_total", "Messages posted to the chat.", "type")
+	messagesDelivered = metrics.Default.Counter("gochat_messages_delivered_total", "Messages queued for subscribers.", "type")
+	messagesDropped   = metrics.Default.Counter("gochat_messages_dropped_total", "Messages not delivered to subscribers that unsubscribed.", "type")
+	fanoutDuration    = metrics.Default.Histogram("gochat_fanout_duration_seconds", "Time taken to queue a message for all subscribers.", metrics.DefaultBuckets)
 )
 
 type Message struct {
-	Author  string
-	Message string
+	ID        ulid.ULID
+	Type      string
+	Author    string
+	Message   string
+	Reactions []Reaction
+
+	// Count carries the unread messages count of unread events.
+	Count int
+
+	// RetryAfter hints clients when to reconnect after shutdown events.
+	RetryAfter time.Duration
+
+	// Recipient limits delivery to subscriptions of a single user.
+	Recipient string
+
+	// Conversation names the room or direct conversation of unread and receipt events.
+	Conversation string
+
+	// TraceParent carries the W3C trace context of the message to the spans of its delivery.
+	TraceParent string
+}
+
+// BotName returns the display name of a bot, marked as such.
+func BotName(name string) string {
+	return name + BotSuffix
+}
+
+// IsBotName tells whether the name carries the bot marker, ignoring case and the space before it.
+func IsBotName(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), strings.TrimSpace(BotSuffix))
+}
+
+// LastID returns the ID of the last stored message of the messages, zero when there is none.
+func LastID(messages []Message) ulid.ULID {
+	var last ulid.ULID
+	for _, m := range messages {
+		if m.Type == TypeMessage && m.ID.Compare(last) > 0 {
+			last = m.ID
+		}
+	}
+
+	return last
+}
+
+// Replayed tells whether the message is a stored message up to the last ID of a replay, which a
+// subscription opened before taking the replay delivers again.
+func Replayed(m Message, last ulid.ULID) bool {
+	var zero ulid.ULID
+
+	return m.Type == TypeMessage && m.ID != zero && m.ID.Compare(last) <= 0
+}
+
+// Page is a window of the history in chronological order, telling whether older and newer
+// messages exist around it.
+type Page struct {
+	Messages []Message
+	Older    bool
+	Newer    bool
 }
 
 type ChatService interface {
-	PostMessage(m Message)
-	Subscribe() <-chan Message
+	PostMessage(m Message) Message
+	Subscribe(ctx context.Context, username string) <-chan Message
+	History() []Message
+	Page(before, after ulid.ULID, limit int) Page
+	Get(messageID ulid.ULID) (Message, error)
+	Unread(username string, lastRead ulid.ULID) int
+	AddReaction(messageID ulid.ULID, reaction, username string) error
+	RemoveReaction(messageID ulid.ULID, reaction, username string) error
+	Delete(messageID ulid.ULID) error
+	SetHistorySize(size int)
+	SetBannedWords(words []string)
+	Queued() map[string]int
+}
+
+// Indexer is kept in sync with the messages stored in history.
+type Indexer interface {
+	Index(m Message)
+	Remove(messageID ulid.ULID)
 }
 
-func New() ChatService {
+func New(historySize int, indexers ...Indexer) ChatService {
 	return &service{
-		subscriptions: []chan Message{},
+		subscriptions: []*subscription{},
+		history:       []Message{},
+		historySize:   historySize,
+		indexers:      indexers,
 	}
 }
 
 type service struct {
-	subscriptions []chan Message
+	sync.Mutex
+
+	// fanout serializes the delivery of messages, which happens without the lock so that waiting
+	// for slow subscribers does not hold up reads, keeping the order of messages for subscribers.
+	// It is taken before the lock.
+	fanout sync.Mutex
+
+	subscriptions []*subscription
+
+	// published is a copy of the subscriptions replaced on every change, read without the lock.
+	published atomic.Pointer[[]*subscription]
+
+	history     []Message
+	historySize int
+	indexers    []Indexer
+	bannedWords map[string]bool
 }
 
-func (s *service) PostMessage(m Message) {
-	for _, s := range s.subscriptions {
-		s <- m
+// subscription is locked while a message is sent to it, so that it is not closed meanwhile.
+type subscription struct {
+	sync.Mutex
+	username string
+	messages chan Message
+	done     <-chan struct{}
+	log      *logger.Logger
+	closed   bool
+}
+
+// PostMessage stores and delivers the message, masking the banned words of user messages. Its spans
+// continue the trace of the message TraceParent, which is replaced with the one of the post span for
+// the delivery spans.
+func (s *service) PostMessage(m Message) Message {
+	s.fanout.Lock()
+	defer s.fanout.Unlock()
+
+	s.Lock()
+
+	if len(m.Type) < 1 {
+		m.Type = TypeMessage
+	}
+
+	if (m.Type == TypeMessage || m.Type == TypeDirect) && m.Author != ChatAPIName {
+		m.Message = s.censor(m.Message)
+	}
+
+	parent, _ := tracing.ParseTraceParent(m.TraceParent)
+	ctx, span := tracing.Start(tracing.ContextWithSpanContext(context.Background(), parent), "chat.post", "message.type", m.Type)
+	defer span.End()
+
+	if traceParent := span.TraceParent(); len(traceParent) > 0 {
+		m.TraceParent = traceParent
 	}
+
+	if m.Type == TypeMessage && len(m.Recipient) < 1 {
+		m.ID = ulid.Make()
+		span.SetAttributes("message.id", m.ID)
+
+		_, storeSpan := tracing.Start(ctx, "chat.store")
+		s.store(m)
+		storeSpan.End()
+	}
+
+	// Direct messages are not stored but get an ID for their recipient to mark them read.
+	if m.Type == TypeDirect {
+		m.ID = ulid.Make()
+		span.SetAttributes("message.id", m.ID)
+	}
+
+	messagesPublished.Inc(m.Type)
+
+	subscriptions := s.subscribers()
+	s.Unlock()
+
+	_, fanoutSpan := tracing.Start(ctx, "chat.fanout", "subscribers", len(subscriptions))
+	start := time.Now()
+	broadcast(subscriptions, m)
+	fanoutDuration.Observe(time.Since(start).Seconds())
+	fanoutSpan.End()
+
+	return m
 }
 
-func (s *service) Subscribe() <-chan Message {
-	newSubscription := make(chan Message)
-	s.subscriptions = append(s.subscriptions, newSubscription)
+// Subscribe returns a channel of messages for the user, which is closed once the context is done.
+// The subscription is logged with the logger of the context.
+func (s *service) Subscribe(ctx context.Context, username string) <-chan Message {
+	s.Lock()
+	defer s.Unlock()
+
+	log := logger.FromContext(ctx)
+	log.Debug("subscribed", "subscribers", len(s.subscriptions)+1)
+
+	newSubscription := make(chan Message, SubscriptionBuffer)
+	s.subscriptions = append(s.subscriptions, &subscription{
+		username: username,
+		messages: newSubscription,
+		done:     ctx.Done(),
+		log:      log,
+	})
+	s.publish()
+
+	go func() {
+		<-ctx.Done()
+		s.unsubscribe(newSubscription)
+	}()
+
 	return newSubscription
 }
+
+func (s *service) unsubscribe(messages chan Message) {
+	s.Lock()
+	var sub *subscription
+	for i, candidate := range s.subscriptions {
+		if candidate.messages == messages {
+			sub = candidate
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			s.publish()
+
+			break
+		}
+	}
+	s.Unlock()
+
+	if sub == nil {
+		return
+	}
+
+	// A message being sent to the subscription is dropped as the context is done, so this does not
+	// wait for the subscriber.
+	sub.Lock()
+	sub.closed = true
+	close(messages)
+	sub.Unlock()
+
+	sub.log.Debug("unsubscribed", "queued", len(messages))
+}
+
+// Queued returns the number of messages waiting in the subscriptions of every subscribed user. It
+// reads the published subscriptions rather than taking the lock, so that metrics and health checks
+// are answered while posting waits for a slow subscriber.
+func (s *service) Queued() map[string]int {
+	queued := map[string]int{}
+
+	published := s.published.Load()
+	if published == nil {
+		return queued
+	}
+
+	for _, sub := range *published {
+		queued[sub.username] += len(sub.messages)
+	}
+
+	return queued
+}
+
+// publish replaces the published subscriptions with a copy of the current ones.
+func (s *service) publish() {
+	published := s.subscribers()
+	s.published.Store(&published)
+}
+
+// subscribers returns a copy of the subscriptions to deliver to once the lock is released.
+func (s *service) subscribers() []*subscription {
+	return append([]*subscription{}, s.subscriptions...)
+}
+
+func (s *service) History() []Message {
+	s.Lock()
+	defer s.Unlock()
+
+	history := make([]Message, 0, len(s.history))
+	for _, m := range s.history {
+		history = append(history, m.copy())
+	}
+
+	return history
+}
+
+// Page returns up to limit messages of the history posted before and after the given message IDs,
+// zero IDs leaving that side open. The window is taken right after the after cursor when it is
+// set, otherwise right before the before cursor, so both directions can be paged through.
+func (s *service) Page(before, after ulid.ULID, limit int) Page {
+	s.Lock()
+	defer s.Unlock()
+
+	var zero ulid.ULID
+
+	// History is ordered by ID, so the cursors bound a range of it.
+	from, to := 0, len(s.history)
+	for from < to && after != zero && s.history[from].ID.Compare(after) <= 0 {
+		from++
+	}
+
+	for to > from && before != zero && s.history[to-1].ID.Compare(before) >= 0 {
+		to--
+	}
+
+	if to-from > limit {
+		if after != zero {
+			to = from + limit
+		} else {
+			from = to - limit
+		}
+	}
+
+	page := Page{
+		Messages: make([]Message, 0, to-from),
+		Older:    from > 0,
+		Newer:    to < len(s.history),
+	}
+
+	for _, m := range s.history[from:to] {
+		page.Messages = append(page.Messages, m.copy())
+	}
+
+	return page
+}
+
+func (s *service) Get(messageID ulid.ULID) (Message, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	i := s.find(messageID)
+	if i < 0 {
+		return Message{}, ErrMessageNotFound
+	}
+
+	return s.history[i].copy(), nil
+}
+
+// Unread counts messages in history posted after lastRead by anyone other than the user.
+func (s *service) Unread(username string, lastRead ulid.ULID) int {
+	s.Lock()
+	defer s.Unlock()
+
+	count := 0
+	for _, m := range s.history {
+		if m.ID.Compare(lastRead) > 0 && m.Author != username {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Delete removes the message from history, announcing it for clients to remove it too.
+func (s *service) Delete(messageID ulid.ULID) error {
+	s.fanout.Lock()
+	defer s.fanout.Unlock()
+
+	s.Lock()
+
+	i := s.find(messageID)
+	if i < 0 {
+		s.Unlock()
+
+		return ErrMessageNotFound
+	}
+
+	m := s.history[i]
+	s.history = append(s.history[:i], s.history[i+1:]...)
+	for _, indexer := range s.indexers {
+		indexer.Remove(messageID)
+	}
+
+	subscriptions := s.subscribers()
+	s.Unlock()
+
+	// Announce deleted message.
+	broadcast(subscriptions, Message{
+		ID:     messageID,
+		Type:   TypeDelete,
+		Author: m.Author,
+	})
+
+	return nil
+}
+
+func (s *service) store(m Message) {
+	s.history = append(s.history, m)
+	for _, i := range s.indexers {
+		i.Index(m)
+	}
+
+	s.trim()
+}
+
+// SetHistorySize changes the number of messages kept in history, evicting the oldest ones over it.
+func (s *service) SetHistorySize(size int) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.historySize = size
+	s.trim()
+}
+
+// SetBannedWords changes the words masked in messages posted from now on, ignoring case.
+func (s *service) SetBannedWords(words []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.bannedWords = make(map[string]bool, len(words))
+	for _, w := range words {
+		s.bannedWords[strings.ToLower(w)] = true
+	}
+}
+
+// censor replaces the letters of every banned word of the text with asterisks, matching whole
+// words only so that words containing a banned one are kept.
+func (s *service) censor(text string) string {
+	if len(s.bannedWords) < 1 {
+		return text
+	}
+
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			start++
+
+			continue
+		}
+
+		end := start
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+
+		if s.bannedWords[strings.ToLower(string(runes[start:end]))] {
+			for i := start; i < end; i++ {
+				runes[i] = '*'
+			}
+		}
+
+		start = end
+	}
+
+	return string(runes)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (s *service) trim() {
+	if len(s.history) > s.historySize {
+		evicted := s.history[:len(s.history)-s.historySize]
+		for _, m := range evicted {
+			for _, i := range s.indexers {
+				i.Remove(m.ID)
+			}
+		}
+
+		s.history = s.history[len(s.history)-s.historySize:]
+	}
+}
+
+// broadcast queues the message for the subscriptions, waiting for those with full queues unless
+// they are cancelled.
+func broadcast(subscriptions []*subscription, m Message) {
+	for _, s := range subscriptions {
+		if len(m.Recipient) > 0 && m.Recipient != s.username {
+			continue
+		}
+
+		s.deliver(m)
+	}
+}
+
+func (s *subscription) deliver(m Message) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		s.drop(m)
+
+		return
+	}
+
+	// Skip subscriptions that are being cancelled instead of blocking on them.
+	select {
+	case <-s.done:
+		s.drop(m)
+
+		return
+	default:
+	}
+
+	select {
+	case s.messages <- m:
+		messagesDelivered.Inc(m.Type)
+	case <-s.done:
+		s.drop(m)
+	}
+}
+
+func (s *subscription) drop(m Message) {
+	messagesDropped.Inc(m.Type)
+	s.log.Debug("message dropped for unsubscribed user", "message_id", m.ID, "type", m.Type)
+}
+
+func (m Message) copy() Message {
+	reactions := make([]Reaction, 0, len(m.Reactions))
+	for _, r := range m.Reactions {
+		reactions = append(reactions, Reaction{
+			Value: r.Value,
+			Count: r.Count,
+			Users: append([]string{}, r.Users...),
+		})
+	}
+	m.Reactions = reactions
+
+	return m
+}
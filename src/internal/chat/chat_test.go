@@ -1,37 +1,383 @@
 package chat
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/oklog/ulid/v2"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNew(t *testing.T) {
 	t.Parallel()
 
-	assert.NotNil(t, New())
+	assert.NotNil(t, New(DefaultHistorySize))
+}
+
+func TestBotName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "CI [bot]", BotName("CI"))
+	assert.True(t, IsBotName(BotName("CI")))
+	assert.True(t, IsBotName("ci_[BOT]"))
+	assert.False(t, IsBotName("robot"))
+}
+
+func TestReplayed(t *testing.T) {
+	t.Parallel()
+
+	first, second, third := ulid.Make(), ulid.Make(), ulid.Make()
+	replay := []Message{
+		{ID: first, Type: TypeMessage},
+		{ID: second, Type: TypeMessage},
+		{ID: third, Type: TypePin},
+	}
+
+	last := LastID(replay)
+	assert.Equal(t, second, last)
+	assert.True(t, Replayed(Message{ID: first, Type: TypeMessage}, last))
+	assert.True(t, Replayed(Message{ID: second, Type: TypeMessage}, last))
+	assert.False(t, Replayed(Message{ID: third, Type: TypeMessage}, last))
+	assert.False(t, Replayed(Message{ID: first, Type: TypeReaction}, last))
+	assert.False(t, Replayed(Message{Type: TypeMessage, Recipient: "user"}, last))
+
+	assert.Zero(t, LastID(nil))
 }
 
 func TestPostMessage(t *testing.T) {
 	t.Parallel()
 
 	s := &service{
-		subscriptions: []chan Message{make(chan Message, 1)},
+		subscriptions: []*subscription{{messages: make(chan Message, 1)}},
+		history:       []Message{},
+		historySize:   DefaultHistorySize,
 	}
 
 	s.PostMessage(Message{})
 
-	assert.NotEmpty(t, s.subscriptions[0])
+	assert.NotEmpty(t, s.subscriptions[0].messages)
+
+	msg := <-s.subscriptions[0].messages
+	assert.Equal(t, TypeMessage, msg.Type)
+	assert.NotEmpty(t, msg.ID)
+	assert.Equal(t, []Message{msg}, s.history)
+}
+
+func TestPostMessageRecipient(t *testing.T) {
+	t.Parallel()
+
+	s := &service{
+		subscriptions: []*subscription{
+			{username: "user", messages: make(chan Message, 1)},
+			{username: "other", messages: make(chan Message, 1)},
+		},
+		history:     []Message{},
+		historySize: DefaultHistorySize,
+	}
+
+	s.PostMessage(Message{Message: "@user hi", Recipient: "user"})
+
+	assert.NotEmpty(t, s.subscriptions[0].messages)
+	assert.Empty(t, s.subscriptions[1].messages)
+	assert.Empty(t, s.history)
 }
 
 func TestSubscribe(t *testing.T) {
 	t.Parallel()
 
 	s := &service{
-		subscriptions: []chan Message{},
+		subscriptions: []*subscription{},
 	}
 
-	assert.NotNil(t, s.Subscribe())
+	assert.NotNil(t, s.Subscribe(context.Background(), "user"))
 
 	assert.Equal(t, 1, len(s.subscriptions))
 }
+
+func TestUnsubscribe(t *testing.T) {
+	t.Parallel()
+
+	s := &service{
+		subscriptions: []*subscription{},
+		history:       []Message{},
+		historySize:   DefaultHistorySize,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := s.Subscribe(ctx, "user")
+
+	// Subscriber that does not read must not block posting once cancelled.
+	cancel()
+	s.PostMessage(Message{Message: "hello"})
+
+	_, ok := <-messages
+	assert.False(t, ok)
+	assert.Empty(t, s.subscriptions)
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	s := New(DefaultHistorySize)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Subscribe(ctx, "slow")
+
+	for i := 0; i < SubscriptionBuffer; i++ {
+		s.PostMessage(Message{Message: "queued"})
+	}
+
+	posted := make(chan struct{})
+	go func() {
+		s.PostMessage(Message{Message: "waiting"})
+		close(posted)
+	}()
+
+	// The message is stored while posting waits for the subscriber, which does not hold up reads.
+	assert.Eventually(t, func() bool {
+		return len(s.History()) == SubscriptionBuffer+1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, map[string]int{"slow": SubscriptionBuffer}, s.Queued())
+
+	select {
+	case <-posted:
+		t.Error("posting did not wait for the subscriber")
+	default:
+	}
+
+	cancel()
+	<-posted
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+
+	s := &service{
+		subscriptions: []*subscription{},
+		history:       []Message{},
+		historySize:   2,
+	}
+
+	s.PostMessage(Message{Message: "first"})
+	s.PostMessage(Message{Message: "second"})
+	s.PostMessage(Message{Message: "third"})
+
+	history := s.History()
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, "second", history[0].Message)
+	assert.Equal(t, "third", history[1].Message)
+	assert.True(t, history[0].ID.Compare(history[1].ID) < 0)
+}
+
+func TestPage(t *testing.T) {
+	t.Parallel()
+
+	s := New(DefaultHistorySize)
+
+	ids := []ulid.ULID{}
+	for _, text := range []string{"1", "2", "3", "4", "5"} {
+		ids = append(ids, s.PostMessage(Message{Message: text}).ID)
+	}
+
+	texts := func(page Page) []string {
+		texts := []string{}
+		for _, m := range page.Messages {
+			texts = append(texts, m.Message)
+		}
+
+		return texts
+	}
+
+	var zero ulid.ULID
+
+	page := s.Page(zero, zero, 2)
+	assert.Equal(t, []string{"4", "5"}, texts(page))
+	assert.True(t, page.Older)
+	assert.False(t, page.Newer)
+
+	page = s.Page(ids[3], zero, 2)
+	assert.Equal(t, []string{"2", "3"}, texts(page))
+	assert.True(t, page.Older)
+	assert.True(t, page.Newer)
+
+	page = s.Page(zero, ids[0], 2)
+	assert.Equal(t, []string{"2", "3"}, texts(page))
+
+	page = s.Page(ids[4], ids[0], 10)
+	assert.Equal(t, []string{"2", "3", "4"}, texts(page))
+
+	page = s.Page(ids[0], zero, 2)
+	assert.Empty(t, page.Messages)
+	assert.False(t, page.Older)
+	assert.True(t, page.Newer)
+}
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+
+	s := &service{
+		subscriptions: []*subscription{},
+		history:       []Message{},
+		historySize:   DefaultHistorySize,
+	}
+
+	posted := s.PostMessage(Message{Message: "hello"})
+
+	msg, err := s.Get(posted.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", msg.Message)
+
+	_, err = s.Get(ulid.Make())
+	assert.Equal(t, ErrMessageNotFound, err)
+}
+
+func TestDelete(t *testing.T) {
+	t.Parallel()
+
+	i := &indexer{}
+	s := &service{
+		subscriptions: []*subscription{},
+		history:       []Message{},
+		historySize:   DefaultHistorySize,
+		indexers:      []Indexer{i},
+	}
+
+	messages := s.Subscribe(context.Background(), "user")
+
+	posted := s.PostMessage(Message{Author: "other", Message: "hello"})
+	<-messages
+
+	assert.NoError(t, s.Delete(posted.ID))
+	assert.Equal(t, Message{ID: posted.ID, Type: TypeDelete, Author: "other"}, <-messages)
+	assert.Empty(t, s.History())
+	assert.Equal(t, 1, i.removed)
+
+	assert.Equal(t, ErrMessageNotFound, s.Delete(posted.ID))
+}
+
+func TestUnread(t *testing.T) {
+	t.Parallel()
+
+	s := &service{
+		subscriptions: []*subscription{},
+		history:       []Message{},
+		historySize:   DefaultHistorySize,
+	}
+
+	first := s.PostMessage(Message{Author: "other", Message: "first"})
+	s.PostMessage(Message{Author: "user", Message: "second"})
+	s.PostMessage(Message{Author: "other", Message: "third"})
+
+	assert.Equal(t, 2, s.Unread("user", ulid.ULID{}))
+	assert.Equal(t, 1, s.Unread("user", first.ID))
+	assert.Equal(t, 1, s.Unread("other", ulid.ULID{}))
+}
+
+type indexer struct {
+	indexed []string
+	removed int
+}
+
+func (i *indexer) Index(m Message) {
+	i.indexed = append(i.indexed, m.Message)
+}
+
+func (i *indexer) Remove(messageID ulid.ULID) {
+	i.removed++
+}
+
+func TestIndexers(t *testing.T) {
+	t.Parallel()
+
+	i := &indexer{}
+	s := &service{
+		subscriptions: []*subscription{},
+		history:       []Message{},
+		historySize:   1,
+		indexers:      []Indexer{i},
+	}
+
+	s.PostMessage(Message{Message: "first"})
+	s.PostMessage(Message{Message: "second"})
+	s.PostMessage(Message{Message: "private", Recipient: "user"})
+
+	assert.Equal(t, []string{"first", "second"}, i.indexed)
+	assert.Equal(t, 1, i.removed)
+}
+
+func TestSetHistorySize(t *testing.T) {
+	t.Parallel()
+
+	i := &indexer{}
+	s := &service{
+		subscriptions: []*subscription{},
+		history:       []Message{},
+		historySize:   3,
+		indexers:      []Indexer{i},
+	}
+
+	s.PostMessage(Message{Message: "first"})
+	s.PostMessage(Message{Message: "second"})
+	s.PostMessage(Message{Message: "third"})
+
+	s.SetHistorySize(1)
+
+	assert.Equal(t, 1, len(s.History()))
+	assert.Equal(t, "third", s.History()[0].Message)
+	assert.Equal(t, 2, i.removed)
+
+	s.SetHistorySize(2)
+	s.PostMessage(Message{Message: "fourth"})
+
+	assert.Equal(t, 2, len(s.History()))
+}
+
+func TestSetBannedWords(t *testing.T) {
+	t.Parallel()
+
+	s := New(DefaultHistorySize)
+	s.SetBannedWords([]string{"Darn", "heck"})
+
+	for _, tc := range []struct {
+		message  Message
+		expected string
+	}{
+		{Message{Author: "user", Message: "darn it, DARN!"}, "**** it, ****!"},
+		{Message{Author: "user", Message: "what the héck heck"}, "what the héck ****"},
+		{Message{Author: "user", Message: "darning hecks"}, "darning hecks"},
+		{Message{Author: "user", Message: "heck", Type: TypeDirect, Recipient: "other"}, "****"},
+		{Message{Author: ChatAPIName, Message: "darn has joined the chat!"}, "darn has joined the chat!"},
+	} {
+		assert.Equal(t, tc.expected, s.PostMessage(tc.message).Message, tc.message.Message)
+	}
+
+	assert.Equal(t, "**** it, ****!", s.History()[0].Message)
+
+	s.SetBannedWords(nil)
+	assert.Equal(t, "darn", s.PostMessage(Message{Author: "user", Message: "darn"}).Message)
+}
+
+func TestQueued(t *testing.T) {
+	t.Parallel()
+
+	s := &service{
+		subscriptions: []*subscription{},
+		history:       []Message{},
+		historySize:   DefaultHistorySize,
+	}
+
+	s.Subscribe(context.Background(), "user")
+	s.Subscribe(context.Background(), "user")
+	s.Subscribe(context.Background(), "other")
+
+	s.PostMessage(Message{Message: "hello"})
+	s.PostMessage(Message{Message: "@user hi", Recipient: "user"})
+
+	assert.Equal(t, map[string]int{"user": 4, "other": 1}, s.Queued())
+
+	// Queued does not wait for the lock.
+	s.Lock()
+	defer s.Unlock()
+	assert.Equal(t, map[string]int{"user": 4, "other": 1}, s.Queued())
+}
@@ -0,0 +1,26 @@
+package chat
+
+import (
+	"regexp"
+	"strings"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\p{L}\p{N}_.\-]+)`)
+
+// Mentions returns the unique usernames mentioned as @username in the text, in order of appearance.
+func Mentions(text string) []string {
+	mentions := []string{}
+	seen := map[string]bool{}
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		username := strings.TrimRight(match[1], ".-")
+		if len(username) < 1 || seen[username] {
+			continue
+		}
+
+		seen[username] = true
+		mentions = append(mentions, username)
+	}
+
+	return mentions
+}
@@ -0,0 +1,16 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMentions(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{}, Mentions("no mentions here"))
+	assert.Equal(t, []string{}, Mentions("user@example.com"))
+	assert.Equal(t, []string{"alice", "bob"}, Mentions("@alice hi, @bob. @alice again"))
+	assert.Equal(t, []string{"john.doe"}, Mentions("ping (@john.doe)"))
+}
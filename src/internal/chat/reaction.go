@@ -0,0 +1,147 @@
+package chat
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// MaxReactionLength limits the size of a single reaction value in bytes.
+const MaxReactionLength = 32
+
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrInvalidReaction = errors.New("invalid reaction")
+)
+
+type Reaction struct {
+	Value string
+	Count int
+	Users []string
+}
+
+func (s *service) AddReaction(messageID ulid.ULID, reaction, username string) error {
+	return s.react(messageID, reaction, username, true)
+}
+
+func (s *service) RemoveReaction(messageID ulid.ULID, reaction, username string) error {
+	return s.react(messageID, reaction, username, false)
+}
+
+func (s *service) react(messageID ulid.ULID, reaction, username string, add bool) error {
+	if len(reaction) < 1 || len(reaction) > MaxReactionLength {
+		return ErrInvalidReaction
+	}
+
+	s.fanout.Lock()
+	defer s.fanout.Unlock()
+
+	s.Lock()
+
+	i := s.find(messageID)
+	if i < 0 {
+		s.Unlock()
+
+		return ErrMessageNotFound
+	}
+
+	m := &s.history[i]
+
+	var changed bool
+	if add {
+		changed = m.addReaction(reaction, username)
+	} else {
+		changed = m.removeReaction(reaction, username)
+	}
+
+	if !changed {
+		s.Unlock()
+
+		return nil
+	}
+
+	// Announce reaction change with the full state of the message reactions.
+	announced := Message{
+		ID:        m.ID,
+		Type:      TypeReaction,
+		Author:    username,
+		Message:   reaction,
+		Reactions: m.copy().Reactions,
+	}
+	subscriptions := s.subscribers()
+	s.Unlock()
+
+	broadcast(subscriptions, announced)
+
+	return nil
+}
+
+func (s *service) find(messageID ulid.ULID) int {
+	for i := range s.history {
+		if s.history[i].ID == messageID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m *Message) addReaction(reaction, username string) bool {
+	for i := range m.Reactions {
+		r := &m.Reactions[i]
+		if r.Value != reaction {
+			continue
+		}
+
+		for _, u := range r.Users {
+			if u == username {
+				return false
+			}
+		}
+
+		r.Users = append(r.Users, username)
+		r.Count = len(r.Users)
+
+		return true
+	}
+
+	m.Reactions = append(m.Reactions, Reaction{
+		Value: reaction,
+		Count: 1,
+		Users: []string{username},
+	})
+	sort.Slice(m.Reactions, func(i, j int) bool {
+		return m.Reactions[i].Value < m.Reactions[j].Value
+	})
+
+	return true
+}
+
+func (m *Message) removeReaction(reaction, username string) bool {
+	for i := range m.Reactions {
+		r := &m.Reactions[i]
+		if r.Value != reaction {
+			continue
+		}
+
+		for j, u := range r.Users {
+			if u != username {
+				continue
+			}
+
+			r.Users = append(r.Users[:j], r.Users[j+1:]...)
+			r.Count = len(r.Users)
+
+			if r.Count < 1 {
+				m.Reactions = append(m.Reactions[:i], m.Reactions[i+1:]...)
+			}
+
+			return true
+		}
+
+		return false
+	}
+
+	return false
+}
@@ -0,0 +1,52 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReactions(t *testing.T) {
+	t.Parallel()
+
+	sub := make(chan Message, 10)
+	s := &service{
+		subscriptions: []*subscription{{messages: sub}},
+		history:       []Message{},
+		historySize:   DefaultHistorySize,
+	}
+
+	s.PostMessage(Message{Author: "author", Message: "hello"})
+	msg := <-sub
+
+	assert.Equal(t, ErrMessageNotFound, s.AddReaction(ulid.Make(), "+1", "user"))
+	assert.Equal(t, ErrInvalidReaction, s.AddReaction(msg.ID, "", "user"))
+
+	assert.NoError(t, s.AddReaction(msg.ID, "+1", "user"))
+	assert.NoError(t, s.AddReaction(msg.ID, "+1", "other"))
+	assert.NoError(t, s.AddReaction(msg.ID, "heart", "user"))
+
+	// Duplicate reaction is not broadcast again.
+	assert.NoError(t, s.AddReaction(msg.ID, "+1", "user"))
+	assert.Equal(t, 3, len(sub))
+
+	<-sub
+	<-sub
+	event := <-sub
+	assert.Equal(t, TypeReaction, event.Type)
+	assert.Equal(t, msg.ID, event.ID)
+	assert.Equal(t, []Reaction{
+		{Value: "+1", Count: 2, Users: []string{"user", "other"}},
+		{Value: "heart", Count: 1, Users: []string{"user"}},
+	}, event.Reactions)
+
+	assert.NoError(t, s.RemoveReaction(msg.ID, "heart", "user"))
+	assert.NoError(t, s.RemoveReaction(msg.ID, "+1", "other"))
+	assert.NoError(t, s.RemoveReaction(msg.ID, "+1", "other"))
+	assert.Equal(t, 2, len(sub))
+
+	assert.Equal(t, []Reaction{
+		{Value: "+1", Count: 1, Users: []string{"user"}},
+	}, s.History()[0].Reactions)
+}
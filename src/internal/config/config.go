@@ -0,0 +1,680 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"gochat/internal/chat"
+	"gochat/internal/logger"
+	"gochat/internal/poll"
+	"gochat/internal/ratelimit"
+	"gochat/internal/tracing"
+	"gochat/internal/websocket/connection"
+	"gochat/internal/websocket/heartbeat"
+)
+
+const (
+	EnvGoChatConfig = "GO_CHAT_CONFIG"
+
+	// StorageInMemory is the only supported storage backend.
+	StorageInMemory = "inmemory"
+
+	DefaultShutdownTimeout = 15 * time.Second
+)
+
+var (
+	LogLevels  = []string{"debug", "info", "warn", "error"}
+	LogFormats = []string{"text", "json"}
+	Exporters  = []string{tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLPFile, tracing.ExporterOTLPHTTP}
+)
+
+type Config struct {
+	Listen     Listen   `yaml:"listen"`
+	TLS        TLS      `yaml:"tls"`
+	Storage    Storage  `yaml:"storage"`
+	Limits     Limits   `yaml:"limits"`
+	History    History  `yaml:"history"`
+	Timeouts   Timeouts `yaml:"timeouts"`
+	Logging    Logging  `yaml:"logging"`
+	Tracing    Tracing  `yaml:"tracing"`
+	Admin      Admin    `yaml:"admin"`
+	TCP        TCP      `yaml:"tcp"`
+	IRC        IRC      `yaml:"irc"`
+	Webhooks   Webhooks `yaml:"webhooks"`
+	Moderators []string `yaml:"moderators"`
+
+	// ModeratorKey is the credential joining with a moderator name, which is reserved without one.
+	ModeratorKey string `yaml:"moderator_key"`
+
+	// BannedWords are masked with asterisks in user messages, ignoring case.
+	BannedWords []string `yaml:"banned_words"`
+
+	// AllowedOrigins are host patterns of the cross-origin pages allowed to use the API.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+
+	// PrintConfig asks to print the effective configuration and exit.
+	PrintConfig bool `yaml:"-"`
+}
+
+type Listen struct {
+	Address string `yaml:"address"`
+}
+
+type TLS struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+
+	// ClientCAFile enables mutual TLS, requiring client certificates signed by the CAs in it.
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+type Storage struct {
+	Backend string `yaml:"backend"`
+}
+
+type Limits struct {
+	MaxConnections        int `yaml:"max_connections"`
+	MaxConnectionsPerUser int `yaml:"max_connections_per_user"`
+	MaxConnectionsPerIP   int `yaml:"max_connections_per_ip"`
+
+	// MessageRate is the messages per second a connection can publish, MessageBurst how many it can
+	// publish at once. Zero MessageRate disables the limit.
+	MessageRate  float64 `yaml:"message_rate"`
+	MessageBurst int     `yaml:"message_burst"`
+}
+
+type History struct {
+	Size int `yaml:"size"`
+}
+
+type Timeouts struct {
+	PingInterval time.Duration `yaml:"ping_interval"`
+	PingTimeout  time.Duration `yaml:"ping_timeout"`
+	Idle         time.Duration `yaml:"idle"`
+	Shutdown     time.Duration `yaml:"shutdown"`
+
+	// Poll is how long a long-poll waits for events and PollSession how long a long-poll session
+	// is kept without being polled.
+	Poll        time.Duration `yaml:"poll"`
+	PollSession time.Duration `yaml:"poll_session"`
+}
+
+type Logging struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter"`
+
+	// Endpoint is the OTLP/HTTP traces URL of the otlp-http exporter.
+	Endpoint string `yaml:"endpoint"`
+
+	// File is the file the otlp-file exporter appends to.
+	File string `yaml:"file"`
+}
+
+type Admin struct {
+	// Token is the credential of the admin API, which is disabled without one.
+	Token string `yaml:"token"`
+
+	// Listen is an optional separate address serving the admin API only.
+	Listen string `yaml:"listen"`
+}
+
+type TCP struct {
+	// Listen is the address of the line protocol listener, which is disabled without one.
+	Listen string `yaml:"listen"`
+
+	// TLS serves the line protocol with the TLS certificate of the server.
+	TLS bool `yaml:"tls"`
+}
+
+type IRC struct {
+	// Listen is the address of the IRC gateway, which is disabled without one.
+	Listen string `yaml:"listen"`
+
+	// TLS serves IRC with the TLS certificate of the server.
+	TLS bool `yaml:"tls"`
+}
+
+type Webhooks struct {
+	// HooksFile persists the registered webhooks across restarts, which are kept in memory only
+	// without one. It holds the webhook secrets.
+	HooksFile string `yaml:"hooks_file"`
+
+	// IncomingFile persists the incoming webhooks across restarts, which are kept in memory only
+	// without one. It holds the tokens posting with them.
+	IncomingFile string `yaml:"incoming_file"`
+
+	// QueueFile persists the pending webhook deliveries across restarts, which are kept in memory
+	// only without one.
+	QueueFile string `yaml:"queue_file"`
+
+	// DeadLetterFile is the file deliveries that failed every attempt are appended to.
+	DeadLetterFile string `yaml:"dead_letter_file"`
+}
+
+func Default() Config {
+	return Config{
+		Listen: Listen{
+			Address: ":4001",
+		},
+		Storage: Storage{
+			Backend: StorageInMemory,
+		},
+		Limits: Limits{
+			MaxConnections:        connection.DefaultMaxConnections,
+			MaxConnectionsPerUser: connection.DefaultMaxConnectionsPerUser,
+			MaxConnectionsPerIP:   connection.DefaultMaxConnectionsPerIP,
+			MessageRate:           ratelimit.DefaultRate,
+			MessageBurst:          ratelimit.DefaultBurst,
+		},
+		History: History{
+			Size: chat.DefaultHistorySize,
+		},
+		Timeouts: Timeouts{
+			PingInterval: heartbeat.DefaultInterval,
+			PingTimeout:  heartbeat.DefaultTimeout,
+			Idle:         heartbeat.DefaultIdleTimeout,
+			Shutdown:     DefaultShutdownTimeout,
+			Poll:         poll.DefaultTimeout,
+			PollSession:  poll.DefaultSessionTimeout,
+		},
+		Logging: Logging{
+			Level:  "info",
+			Format: "text",
+		},
+		Tracing: Tracing{
+			Exporter: tracing.ExporterNone,
+		},
+		Moderators:     []string{},
+		BannedWords:    []string{},
+		AllowedOrigins: []string{},
+	}
+}
+
+// Load builds the configuration from defaults, the YAML config file, environment variables and
+// command line flags, each overriding the previous ones.
+func Load(args []string, getenv func(string) string) (Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("gochat", flag.ContinueOnError)
+	path := fs.String("config", getenv(EnvGoChatConfig), "path to the YAML config file")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective config and exit")
+
+	type flagValue struct {
+		setting setting
+		value   string
+	}
+
+	flagValues := []flagValue{}
+	for _, s := range settings {
+		s := s
+		if len(s.flag) < 1 {
+			continue
+		}
+
+		fs.Func(s.flag, s.usage, func(value string) error {
+			flagValues = append(flagValues, flagValue{setting: s, value: value})
+
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if len(*path) > 0 {
+		if err := cfg.loadFile(*path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range settings {
+		if len(s.env) < 1 {
+			continue
+		}
+
+		if value := getenv(s.env); len(value) > 0 {
+			if err := s.set(&cfg, value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, f := range flagValues {
+		if err := f.setting.set(&cfg, f.value); err != nil {
+			return Config{}, fmt.Errorf("invalid -%s: %w", f.setting.flag, err)
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error parsing config file: %w", err)
+	}
+
+	return nil
+}
+
+func (c Config) Validate() error {
+	errs := []error{}
+
+	if _, _, err := net.SplitHostPort(c.Listen.Address); err != nil {
+		errs = append(errs, fmt.Errorf("listen.address: %w", err))
+	}
+
+	if c.TLS.Enabled {
+		if len(c.TLS.CertFile) < 1 || len(c.TLS.KeyFile) < 1 {
+			errs = append(errs, errors.New("tls: cert_file and key_file are required"))
+		}
+	} else if len(c.TLS.ClientCAFile) > 0 {
+		errs = append(errs, errors.New("tls.client_ca_file: requires tls to be enabled"))
+	}
+
+	if c.Storage.Backend != StorageInMemory {
+		errs = append(errs, fmt.Errorf("storage.backend: unsupported backend %q", c.Storage.Backend))
+	}
+
+	if c.Limits.MaxConnections < 0 || c.Limits.MaxConnectionsPerUser < 0 || c.Limits.MaxConnectionsPerIP < 0 || c.Limits.MessageRate < 0 || c.Limits.MessageBurst < 0 {
+		errs = append(errs, errors.New("limits: must not be negative"))
+	}
+
+	if c.History.Size < 1 {
+		errs = append(errs, errors.New("history.size: must be positive"))
+	}
+
+	if c.Timeouts.PingInterval < 0 || c.Timeouts.Idle < 0 {
+		errs = append(errs, errors.New("timeouts: must not be negative"))
+	}
+
+	if c.Timeouts.PingInterval > 0 && c.Timeouts.PingTimeout <= 0 {
+		errs = append(errs, errors.New("timeouts.ping_timeout: must be positive when pinging"))
+	}
+
+	if c.Timeouts.Shutdown <= 0 {
+		errs = append(errs, errors.New("timeouts.shutdown: must be positive"))
+	}
+
+	if c.Timeouts.Poll <= 0 || c.Timeouts.PollSession <= 0 {
+		errs = append(errs, errors.New("timeouts.poll and timeouts.poll_session: must be positive"))
+	}
+
+	if !contains(LogLevels, c.Logging.Level) {
+		errs = append(errs, fmt.Errorf("logging.level: must be one of %s", strings.Join(LogLevels, ", ")))
+	}
+
+	if !contains(LogFormats, c.Logging.Format) {
+		errs = append(errs, fmt.Errorf("logging.format: must be one of %s", strings.Join(LogFormats, ", ")))
+	}
+
+	if !contains(Exporters, c.Tracing.Exporter) {
+		errs = append(errs, fmt.Errorf("tracing.exporter: must be one of %s", strings.Join(Exporters, ", ")))
+	}
+
+	if c.Tracing.Exporter == tracing.ExporterOTLPHTTP && len(c.Tracing.Endpoint) < 1 {
+		errs = append(errs, errors.New("tracing.endpoint: required by the otlp-http exporter"))
+	}
+
+	if c.Tracing.Exporter == tracing.ExporterOTLPFile && len(c.Tracing.File) < 1 {
+		errs = append(errs, errors.New("tracing.file: required by the otlp-file exporter"))
+	}
+
+	if len(c.Admin.Listen) > 0 {
+		if len(c.Admin.Token) < 1 {
+			errs = append(errs, errors.New("admin.listen: requires admin.token"))
+		}
+
+		if _, _, err := net.SplitHostPort(c.Admin.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("admin.listen: %w", err))
+		}
+	}
+
+	if len(c.TCP.Listen) > 0 {
+		if _, _, err := net.SplitHostPort(c.TCP.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("tcp.listen: %w", err))
+		}
+	}
+
+	if c.TCP.TLS && !c.TLS.Enabled {
+		errs = append(errs, errors.New("tcp.tls: requires tls to be enabled"))
+	}
+
+	if len(c.IRC.Listen) > 0 {
+		if _, _, err := net.SplitHostPort(c.IRC.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("irc.listen: %w", err))
+		}
+	}
+
+	if c.IRC.TLS && !c.TLS.Enabled {
+		errs = append(errs, errors.New("irc.tls: requires tls to be enabled"))
+	}
+
+	for _, p := range c.AllowedOrigins {
+		if _, err := filepath.Match(p, ""); err != nil {
+			errs = append(errs, fmt.Errorf("allowed_origins: %q: %w", p, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Masked replaces the secrets that are set in printed configs.
+const Masked = "********"
+
+// YAML returns the configuration in the config file format, with the admin token and the moderator
+// key masked when they are set.
+func (c Config) YAML() ([]byte, error) {
+	for _, secret := range []*string{&c.Admin.Token, &c.ModeratorKey} {
+		if len(*secret) > 0 {
+			*secret = Masked
+		}
+	}
+
+	var out bytes.Buffer
+
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), encoder.Close()
+}
+
+func (c Config) Heartbeat() heartbeat.Config {
+	return heartbeat.Config{
+		Interval:    c.Timeouts.PingInterval,
+		Timeout:     c.Timeouts.PingTimeout,
+		IdleTimeout: c.Timeouts.Idle,
+	}
+}
+
+func (c Config) PollTimeouts() poll.Timeouts {
+	return poll.Timeouts{
+		Poll:    c.Timeouts.Poll,
+		Session: c.Timeouts.PollSession,
+	}
+}
+
+// LogLevel returns the configured log level, info when it is invalid.
+func (c Config) LogLevel() logger.Level {
+	level, _ := logger.ParseLevel(c.Logging.Level)
+
+	return level
+}
+
+func (c Config) ConnectionLimits() connection.Limits {
+	return connection.Limits{
+		Total:   c.Limits.MaxConnections,
+		PerUser: c.Limits.MaxConnectionsPerUser,
+		PerIP:   c.Limits.MaxConnectionsPerIP,
+	}
+}
+
+func (c Config) RateLimit() ratelimit.Config {
+	return ratelimit.Config{
+		Rate:  c.Limits.MessageRate,
+		Burst: c.Limits.MessageBurst,
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setting is a config value that can be set with an environment variable and a flag.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"GO_CHAT_PORT", "", "", func(c *Config, v string) error {
+		c.Listen.Address = ":" + v
+
+		return nil
+	}},
+	{"GO_CHAT_LISTEN_ADDRESS", "listen", "listen address", func(c *Config, v string) error {
+		c.Listen.Address = v
+
+		return nil
+	}},
+	{"GO_CHAT_TLS_CERT_FILE", "tls-cert", "TLS certificate file, enables TLS", func(c *Config, v string) error {
+		c.TLS.Enabled = true
+		c.TLS.CertFile = v
+
+		return nil
+	}},
+	{"GO_CHAT_TLS_KEY_FILE", "tls-key", "TLS key file", func(c *Config, v string) error {
+		c.TLS.KeyFile = v
+
+		return nil
+	}},
+	{"GO_CHAT_TLS_CLIENT_CA_FILE", "tls-client-ca", "CA file for client certificates, enables mutual TLS", func(c *Config, v string) error {
+		c.TLS.ClientCAFile = v
+
+		return nil
+	}},
+	{"GO_CHAT_STORAGE_BACKEND", "storage", "storage backend", func(c *Config, v string) error {
+		c.Storage.Backend = v
+
+		return nil
+	}},
+	{"GO_CHAT_MAX_CONNECTIONS", "max-connections", "maximum number of connections", intSetter(func(c *Config) *int {
+		return &c.Limits.MaxConnections
+	})},
+	{"GO_CHAT_MAX_CONNECTIONS_PER_USER", "max-connections-per-user", "maximum number of connections per user", intSetter(func(c *Config) *int {
+		return &c.Limits.MaxConnectionsPerUser
+	})},
+	{"GO_CHAT_MAX_CONNECTIONS_PER_IP", "max-connections-per-ip", "maximum number of connections per IP address", intSetter(func(c *Config) *int {
+		return &c.Limits.MaxConnectionsPerIP
+	})},
+	{"GO_CHAT_MESSAGE_RATE", "message-rate", "messages per second a connection can publish, 0 disables the limit", func(c *Config, v string) error {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+
+		c.Limits.MessageRate = rate
+
+		return nil
+	}},
+	{"GO_CHAT_MESSAGE_BURST", "message-burst", "messages a connection can publish at once", intSetter(func(c *Config) *int {
+		return &c.Limits.MessageBurst
+	})},
+	{"GO_CHAT_HISTORY_SIZE", "history-size", "number of messages kept in history", intSetter(func(c *Config) *int {
+		return &c.History.Size
+	})},
+	{"GO_CHAT_PING_INTERVAL", "ping-interval", "websocket ping interval", durationSetter(func(c *Config) *time.Duration {
+		return &c.Timeouts.PingInterval
+	})},
+	{"GO_CHAT_PING_TIMEOUT", "ping-timeout", "websocket ping timeout", durationSetter(func(c *Config) *time.Duration {
+		return &c.Timeouts.PingTimeout
+	})},
+	{"GO_CHAT_IDLE_TIMEOUT", "idle-timeout", "websocket idle timeout", durationSetter(func(c *Config) *time.Duration {
+		return &c.Timeouts.Idle
+	})},
+	{"GO_CHAT_SHUTDOWN_TIMEOUT", "shutdown-timeout", "graceful shutdown timeout", durationSetter(func(c *Config) *time.Duration {
+		return &c.Timeouts.Shutdown
+	})},
+	{"GO_CHAT_POLL_TIMEOUT", "poll-timeout", "long-poll wait timeout", durationSetter(func(c *Config) *time.Duration {
+		return &c.Timeouts.Poll
+	})},
+	{"GO_CHAT_POLL_SESSION_TIMEOUT", "poll-session-timeout", "timeout of long-poll sessions not polled", durationSetter(func(c *Config) *time.Duration {
+		return &c.Timeouts.PollSession
+	})},
+	{"GO_CHAT_LOG_LEVEL", "log-level", "log level", func(c *Config, v string) error {
+		c.Logging.Level = v
+
+		return nil
+	}},
+	{"GO_CHAT_LOG_FORMAT", "log-format", "log format", func(c *Config, v string) error {
+		c.Logging.Format = v
+
+		return nil
+	}},
+	{"GO_CHAT_TRACING_EXPORTER", "tracing-exporter", "trace exporter: none, stdout, otlp-file or otlp-http", func(c *Config, v string) error {
+		c.Tracing.Exporter = v
+
+		return nil
+	}},
+	{"GO_CHAT_TRACING_ENDPOINT", "tracing-endpoint", "OTLP/HTTP traces URL of the otlp-http exporter", func(c *Config, v string) error {
+		c.Tracing.Endpoint = v
+
+		return nil
+	}},
+	{"GO_CHAT_TRACING_FILE", "tracing-file", "file of the otlp-file exporter", func(c *Config, v string) error {
+		c.Tracing.File = v
+
+		return nil
+	}},
+	{"GO_CHAT_ADMIN_TOKEN", "admin-token", "admin API credential, enables the admin API", func(c *Config, v string) error {
+		c.Admin.Token = v
+
+		return nil
+	}},
+	{"GO_CHAT_ADMIN_LISTEN", "admin-listen", "separate listen address of the admin API", func(c *Config, v string) error {
+		c.Admin.Listen = v
+
+		return nil
+	}},
+	{"GO_CHAT_TCP_LISTEN", "tcp-listen", "listen address of the line protocol, enables it", func(c *Config, v string) error {
+		c.TCP.Listen = v
+
+		return nil
+	}},
+	{"GO_CHAT_TCP_TLS", "tcp-tls", "serve the line protocol over TLS", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+
+		c.TCP.TLS = b
+
+		return nil
+	}},
+	{"GO_CHAT_IRC_LISTEN", "irc-listen", "listen address of the IRC gateway, enables it", func(c *Config, v string) error {
+		c.IRC.Listen = v
+
+		return nil
+	}},
+	{"GO_CHAT_IRC_TLS", "irc-tls", "serve IRC over TLS", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+
+		c.IRC.TLS = b
+
+		return nil
+	}},
+	{"GO_CHAT_WEBHOOKS_HOOKS_FILE", "webhooks-hooks-file", "file persisting registered webhooks", func(c *Config, v string) error {
+		c.Webhooks.HooksFile = v
+
+		return nil
+	}},
+	{"GO_CHAT_WEBHOOKS_INCOMING_FILE", "webhooks-incoming-file", "file persisting incoming webhooks", func(c *Config, v string) error {
+		c.Webhooks.IncomingFile = v
+
+		return nil
+	}},
+	{"GO_CHAT_WEBHOOKS_QUEUE_FILE", "webhooks-queue-file", "file persisting pending webhook deliveries", func(c *Config, v string) error {
+		c.Webhooks.QueueFile = v
+
+		return nil
+	}},
+	{"GO_CHAT_WEBHOOKS_DEAD_LETTER_FILE", "webhooks-dead-letter-file", "file failed webhook deliveries are appended to", func(c *Config, v string) error {
+		c.Webhooks.DeadLetterFile = v
+
+		return nil
+	}},
+	{"GO_CHAT_MODERATORS", "moderators", "comma-separated moderator user names", listSetter(func(c *Config) *[]string {
+		return &c.Moderators
+	})},
+	{"GO_CHAT_MODERATOR_KEY", "moderator-key", "credential joining with a moderator name", func(c *Config, v string) error {
+		c.ModeratorKey = v
+
+		return nil
+	}},
+	{"GO_CHAT_BANNED_WORDS", "banned-words", "comma-separated words masked in messages", listSetter(func(c *Config) *[]string {
+		return &c.BannedWords
+	})},
+	{"GO_CHAT_ALLOWED_ORIGINS", "allowed-origins", "comma-separated allowed origin host patterns", listSetter(func(c *Config) *[]string {
+		return &c.AllowedOrigins
+	})},
+}
+
+func intSetter(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+
+		*field(c) = i
+
+		return nil
+	}
+}
+
+func listSetter(field func(c *Config) *[]string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		list := []string{}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); len(v) > 0 {
+				list = append(list, v)
+			}
+		}
+
+		*field(c) = list
+
+		return nil
+	}
+}
+
+func durationSetter(field func(c *Config) *time.Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		*field(c) = d
+
+		return nil
+	}
+}
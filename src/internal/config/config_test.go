@@ -0,0 +1,198 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"gochat/internal/ratelimit"
+)
+
+func env(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestDefault(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, Default().Validate())
+
+	cfg, err := Load([]string{}, env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfig(t, `
+listen:
+  address: ":5000"
+history:
+  size: 10
+timeouts:
+  ping_interval: 1m
+moderators: [alice]
+`)
+
+	cfg, err := Load([]string{"-config", path}, env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ":5000", cfg.Listen.Address)
+	assert.Equal(t, 10, cfg.History.Size)
+	assert.Equal(t, time.Minute, cfg.Timeouts.PingInterval)
+	assert.Equal(t, []string{"alice"}, cfg.Moderators)
+	assert.Equal(t, Default().Timeouts.PingTimeout, cfg.Timeouts.PingTimeout)
+
+	cfg, err = Load([]string{}, env(map[string]string{
+		EnvGoChatConfig:        path,
+		"GO_CHAT_PORT":         "6000",
+		"GO_CHAT_HISTORY_SIZE": "20",
+		"GO_CHAT_MODERATORS":   "bob, carol",
+		"GO_CHAT_BANNED_WORDS": "darn,heck",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, ":6000", cfg.Listen.Address)
+	assert.Equal(t, 20, cfg.History.Size)
+	assert.Equal(t, []string{"bob", "carol"}, cfg.Moderators)
+	assert.Equal(t, []string{"darn", "heck"}, cfg.BannedWords)
+
+	cfg, err = Load([]string{"--history-size", "30", "-listen", "127.0.0.1:7000", "--print-config"}, env(map[string]string{
+		EnvGoChatConfig:        path,
+		"GO_CHAT_HISTORY_SIZE": "20",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:7000", cfg.Listen.Address)
+	assert.Equal(t, 30, cfg.History.Size)
+	assert.True(t, cfg.PrintConfig)
+
+	cfg, err = Load([]string{"-message-rate", "0.5"}, env(map[string]string{"GO_CHAT_MESSAGE_BURST": "3"}))
+	assert.NoError(t, err)
+	assert.Equal(t, ratelimit.Config{Rate: 0.5, Burst: 3}, cfg.RateLimit())
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, env(nil))
+	assert.Error(t, err)
+
+	_, err = Load([]string{"-config", writeConfig(t, "unknown: true")}, env(nil))
+	assert.Error(t, err)
+
+	_, err = Load([]string{}, env(map[string]string{"GO_CHAT_PING_INTERVAL": "soon"}))
+	assert.Error(t, err)
+
+	_, err = Load([]string{"-max-connections", "many"}, env(nil))
+	assert.Error(t, err)
+
+	_, err = Load([]string{"-message-rate", "fast"}, env(nil))
+	assert.Error(t, err)
+
+	_, err = Load([]string{"-storage", "postgres"}, env(nil))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	cfg := Default()
+	cfg.Listen.Address = "4001"
+	cfg.TLS.Enabled = true
+	cfg.Limits.MaxConnections = -1
+	cfg.History.Size = 0
+	cfg.Timeouts.PingTimeout = 0
+	cfg.Timeouts.Shutdown = 0
+	cfg.Timeouts.PollSession = 0
+	cfg.Logging.Level = "verbose"
+	cfg.Logging.Format = "xml"
+
+	err := cfg.Validate()
+	for _, field := range []string{"listen.address", "tls", "limits", "history.size", "timeouts.ping_timeout", "timeouts.shutdown", "timeouts.poll", "logging.level", "logging.format"} {
+		assert.ErrorContains(t, err, field)
+	}
+
+	cfg = Default()
+	cfg.TLS.ClientCAFile = "ca.pem"
+	cfg.AllowedOrigins = []string{"[broken"}
+
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "tls.client_ca_file")
+	assert.ErrorContains(t, err, "allowed_origins")
+
+	cfg = Default()
+	cfg.TCP.Listen = "4003"
+	cfg.TCP.TLS = true
+	cfg.IRC.Listen = "6667"
+	cfg.IRC.TLS = true
+
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "tcp.listen")
+	assert.ErrorContains(t, err, "tcp.tls")
+	assert.ErrorContains(t, err, "irc.listen")
+	assert.ErrorContains(t, err, "irc.tls")
+
+	cfg = Default()
+	cfg.Tracing.Exporter = "jaeger"
+	assert.ErrorContains(t, cfg.Validate(), "tracing.exporter")
+
+	cfg.Tracing.Exporter = "otlp-http"
+	assert.ErrorContains(t, cfg.Validate(), "tracing.endpoint")
+
+	cfg.Tracing.Exporter = "otlp-file"
+	assert.ErrorContains(t, cfg.Validate(), "tracing.file")
+
+	cfg = Default()
+	cfg.Admin.Listen = ":4002"
+	assert.ErrorContains(t, cfg.Validate(), "admin.listen: requires admin.token")
+
+	cfg.Admin.Token = "secret"
+	assert.NoError(t, cfg.Validate())
+
+	cfg = Default()
+	cfg.Limits.MessageRate = -1
+	assert.ErrorContains(t, cfg.Validate(), "limits")
+}
+
+func TestYAML(t *testing.T) {
+	t.Parallel()
+
+	out, err := Default().YAML()
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "ping_interval: 30s")
+
+	cfg := Config{}
+	assert.NoError(t, yaml.Unmarshal(out, &cfg))
+	assert.Equal(t, Default(), cfg)
+}
+
+func TestYAMLSecrets(t *testing.T) {
+	t.Parallel()
+
+	cfg := Default()
+	cfg.Admin.Token = "admin-secret"
+	cfg.ModeratorKey = "moderator-secret"
+
+	out, err := cfg.YAML()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(out), "admin-secret")
+	assert.NotContains(t, string(out), "moderator-secret")
+	assert.Contains(t, string(out), "token: '"+Masked+"'")
+	assert.Contains(t, string(out), "moderator_key: '"+Masked+"'")
+
+	// The config itself keeps the secrets.
+	assert.Equal(t, "admin-secret", cfg.Admin.Token)
+	assert.Equal(t, "moderator-secret", cfg.ModeratorKey)
+}
@@ -0,0 +1,121 @@
+package health
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout limits how long a single readiness check may take.
+const DefaultTimeout = 2 * time.Second
+
+var ErrTimeout = errors.New("check timed out")
+
+// Check returns an error when the checked component is not ready.
+type Check func() error
+
+// Report holds the results of the readiness checks by name, nil meaning the check passed.
+type Report struct {
+	Ready  bool
+	Checks map[string]error
+}
+
+type HealthService interface {
+	Ready() Report
+}
+
+func New(timeout time.Duration, checks map[string]Check) HealthService {
+	return &service{
+		timeout: timeout,
+		checks:  checks,
+		probes:  map[string]*probe{},
+	}
+}
+
+type service struct {
+	sync.Mutex
+	timeout time.Duration
+	checks  map[string]Check
+	probes  map[string]*probe
+}
+
+// probe is a running check, which readiness probes wait for until it finishes.
+type probe struct {
+	done chan struct{}
+	err  error
+}
+
+// Ready runs all checks concurrently. Checks that do not finish within the timeout fail, so a
+// blocked component does not block the readiness probe. A check still running from a previous
+// probe is waited for instead of started again, so a blocked component holds a single goroutine.
+func (s *service) Ready() Report {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	report := Report{
+		Ready:  true,
+		Checks: map[string]error{},
+	}
+
+	for name, check := range s.checks {
+		name, check := name, check
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := s.run(name, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Checks[name] = err
+			if err != nil {
+				report.Ready = false
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return report
+}
+
+func (s *service) run(name string, check Check) error {
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	p := s.start(name, check)
+
+	select {
+	case <-p.done:
+		return p.err
+	case <-timer.C:
+		return ErrTimeout
+	}
+}
+
+// start returns the running probe of the check, starting one when there is none.
+func (s *service) start(name string, check Check) *probe {
+	s.Lock()
+	defer s.Unlock()
+
+	if p, ok := s.probes[name]; ok {
+		return p
+	}
+
+	p := &probe{done: make(chan struct{})}
+	s.probes[name] = p
+
+	go func() {
+		p.err = check()
+
+		s.Lock()
+		delete(s.probes, name)
+		s.Unlock()
+
+		close(p.done)
+	}()
+
+	return p
+}
@@ -0,0 +1,70 @@
+package health
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New(DefaultTimeout, map[string]Check{}))
+}
+
+func TestReady(t *testing.T) {
+	t.Parallel()
+
+	ok := func() error {
+		return nil
+	}
+
+	s := New(DefaultTimeout, map[string]Check{"first": ok, "second": ok})
+	assert.Equal(t, Report{Ready: true, Checks: map[string]error{"first": nil, "second": nil}}, s.Ready())
+
+	blocked := make(chan struct{})
+	defer close(blocked)
+
+	s = New(10*time.Millisecond, map[string]Check{
+		"ok": ok,
+		"failing": func() error {
+			return assert.AnError
+		},
+		"blocked": func() error {
+			<-blocked
+
+			return nil
+		},
+	})
+	assert.Equal(t, Report{Ready: false, Checks: map[string]error{"ok": nil, "failing": assert.AnError, "blocked": ErrTimeout}}, s.Ready())
+}
+
+func TestReadyBlocked(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	blocked := make(chan struct{})
+
+	s := New(10*time.Millisecond, map[string]Check{
+		"blocked": func() error {
+			calls.Add(1)
+			<-blocked
+
+			return nil
+		},
+	})
+
+	// Probes while the check is blocked wait for the running one instead of starting another.
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, Report{Ready: false, Checks: map[string]error{"blocked": ErrTimeout}}, s.Ready())
+	}
+	assert.Equal(t, int32(1), calls.Load())
+
+	close(blocked)
+
+	assert.Eventually(t, func() bool {
+		return s.Ready().Ready
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,59 @@
+// Package jsonfile persists values as JSON files, for the state kept in memory that has to survive
+// restarts.
+package jsonfile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Read decodes the JSON file into v, leaving it as is when the name is empty or the file does not
+// exist yet.
+func Read(name string, v any) error {
+	if len(name) < 1 {
+		return nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Write replaces the file with v as JSON, readable by the owner only. The file is written at once,
+// so it holds either the previous or the new value when the server stops while writing it.
+func Write(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
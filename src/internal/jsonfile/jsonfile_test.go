@@ -0,0 +1,32 @@
+package jsonfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadWrite(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "values.json")
+
+	values := []string{"kept"}
+	assert.NoError(t, Read(name, &values))
+	assert.Equal(t, []string{"kept"}, values)
+
+	assert.NoError(t, Write(name, []string{"first", "second"}))
+	assert.NoError(t, Read(name, &values))
+	assert.Equal(t, []string{"first", "second"}, values)
+
+	info, err := os.Stat(name)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	assert.NoError(t, os.WriteFile(name, []byte("invalid"), 0o600))
+	assert.Error(t, Read(name, &values))
+
+	assert.NoError(t, Read("", &values))
+}
@@ -0,0 +1,30 @@
+package lifecycle
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var ErrDraining = errors.New("server is draining")
+
+// LifecycleService tracks whether the server is draining before shutdown.
+type LifecycleService interface {
+	Drain()
+	Draining() bool
+}
+
+func New() LifecycleService {
+	return &service{}
+}
+
+type service struct {
+	draining atomic.Bool
+}
+
+func (s *service) Drain() {
+	s.draining.Store(true)
+}
+
+func (s *service) Draining() bool {
+	return s.draining.Load()
+}
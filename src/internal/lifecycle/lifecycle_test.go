@@ -0,0 +1,25 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New())
+}
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	s := &service{}
+
+	assert.False(t, s.Draining())
+
+	s.Drain()
+
+	assert.True(t, s.Draining())
+}
@@ -0,0 +1,286 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Output formats of log records.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+
+	return strconv.Itoa(int(l))
+}
+
+// ParseLevel parses a level name, case insensitively.
+func ParseLevel(name string) (Level, error) {
+	for level, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return level, nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// Logger writes leveled records with key/value attributes, as text or JSON lines. Loggers derived
+// with With share the output, level and format of their parent. A nil Logger logs with the default
+// one.
+type Logger struct {
+	out   *output
+	attrs []any
+}
+
+type output struct {
+	sync.Mutex
+	w     io.Writer
+	level atomic.Int32
+	json  atomic.Bool
+	now   func() time.Time
+}
+
+var std atomic.Pointer[Logger]
+
+func init() {
+	std.Store(New(os.Stderr, LevelInfo, FormatText))
+}
+
+func New(w io.Writer, level Level, format string) *Logger {
+	l := &Logger{
+		out: &output{
+			w:   w,
+			now: time.Now,
+		},
+		attrs: []any{},
+	}
+	l.SetLevel(level)
+	l.SetFormat(format)
+
+	return l
+}
+
+// Default returns the logger used when no logger is carried by a context.
+func Default() *Logger {
+	return std.Load()
+}
+
+func SetDefault(l *Logger) {
+	std.Store(l)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the logger.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by the context, or the default one.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+
+	return Default()
+}
+
+// SetLevel changes the minimum level of the logger and all loggers sharing its output.
+func (l *Logger) SetLevel(level Level) {
+	l.out.level.Store(int32(level))
+}
+
+// SetFormat changes the format of the logger and all loggers sharing its output.
+func (l *Logger) SetFormat(format string) {
+	l.out.json.Store(format == FormatJSON)
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	if l == nil {
+		return Default().Enabled(level)
+	}
+
+	return level >= Level(l.out.level.Load())
+}
+
+// With returns a logger adding the key/value pairs to every record.
+func (l *Logger) With(args ...any) *Logger {
+	if l == nil {
+		return Default().With(args...)
+	}
+
+	return &Logger{
+		out:   l.out,
+		attrs: append(append([]any{}, l.attrs...), args...),
+	}
+}
+
+func (l *Logger) Debug(msg string, args ...any) {
+	l.log(LevelDebug, msg, args)
+}
+
+func (l *Logger) Info(msg string, args ...any) {
+	l.log(LevelInfo, msg, args)
+}
+
+func (l *Logger) Warn(msg string, args ...any) {
+	l.log(LevelWarn, msg, args)
+}
+
+func (l *Logger) Error(msg string, args ...any) {
+	l.log(LevelError, msg, args)
+}
+
+// StdLogger returns a standard library logger writing every line as a record of the level, for
+// packages such as net/http that log through it.
+func (l *Logger) StdLogger(level Level) *log.Logger {
+	return log.New(writerFunc(func(p []byte) (int, error) {
+		l.log(level, strings.TrimSpace(string(p)), nil)
+
+		return len(p), nil
+	}), "", 0)
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func (l *Logger) log(level Level, msg string, args []any) {
+	if l == nil {
+		Default().log(level, msg, args)
+
+		return
+	}
+
+	if !l.Enabled(level) {
+		return
+	}
+
+	pairs := []any{"time", l.out.now().UTC().Format(time.RFC3339Nano), "level", level.String(), "msg", msg}
+	pairs = append(pairs, l.attrs...)
+	pairs = append(pairs, args...)
+
+	var line []byte
+	if l.out.json.Load() {
+		line = formatJSON(pairs)
+	} else {
+		line = formatText(pairs)
+	}
+
+	l.out.Lock()
+	defer l.out.Unlock()
+
+	l.out.w.Write(line)
+}
+
+// attributes pairs up keys and values, an odd trailing value getting the !BADKEY key.
+func attributes(pairs []any) [][2]any {
+	attrs := [][2]any{}
+	for i := 0; i < len(pairs); i += 2 {
+		if i+1 >= len(pairs) {
+			attrs = append(attrs, [2]any{"!BADKEY", pairs[i]})
+
+			break
+		}
+
+		attrs = append(attrs, [2]any{pairs[i], pairs[i+1]})
+	}
+
+	return attrs
+}
+
+// value converts errors and stringers to strings, leaving other values as they are.
+func value(v any) any {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+func formatText(pairs []any) []byte {
+	var b bytes.Buffer
+	for i, attr := range attributes(pairs) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+
+		b.WriteString(fmt.Sprint(attr[0]))
+		b.WriteByte('=')
+		b.WriteString(quote(fmt.Sprint(value(attr[1]))))
+	}
+	b.WriteByte('\n')
+
+	return b.Bytes()
+}
+
+func quote(s string) string {
+	if len(s) < 1 || strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r)
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+func formatJSON(pairs []any) []byte {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, attr := range attributes(pairs) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(fmt.Sprint(attr[0]))
+		b.Write(key)
+		b.WriteByte(':')
+
+		v, err := json.Marshal(value(attr[1]))
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(attr[1]))
+		}
+		b.Write(v)
+	}
+	b.WriteString("}\n")
+
+	return b.Bytes()
+}
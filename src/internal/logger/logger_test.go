@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newLogger(level Level, format string) (*Logger, *bytes.Buffer) {
+	var out bytes.Buffer
+
+	l := New(&out, level, format)
+	l.out.now = func() time.Time {
+		return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+
+	return l, &out
+}
+
+func TestParseLevel(t *testing.T) {
+	t.Parallel()
+
+	level, err := ParseLevel("warn")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestText(t *testing.T) {
+	t.Parallel()
+
+	l, out := newLogger(LevelInfo, FormatText)
+
+	l.With("conn_id", "abc").Info("message sent", "user", "john doe", "error", errors.New("failed"), "duration", time.Second, "odd")
+
+	assert.Equal(t, `time=2024-01-02T03:04:05Z level=INFO msg="message sent" conn_id=abc user="john doe" error=failed duration=1s !BADKEY=odd`+"\n", out.String())
+}
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+
+	l, out := newLogger(LevelInfo, FormatJSON)
+
+	l.With("conn_id", "abc").Warn("limit", "count", 3, "error", errors.New("failed"))
+
+	assert.Equal(t, `{"time":"2024-01-02T03:04:05Z","level":"WARN","msg":"limit","conn_id":"abc","count":3,"error":"failed"}`+"\n", out.String())
+}
+
+func TestLevel(t *testing.T) {
+	t.Parallel()
+
+	l, out := newLogger(LevelWarn, FormatText)
+	child := l.With("key", "value")
+
+	child.Info("hidden")
+	assert.Empty(t, out.String())
+
+	// Level changes apply to derived loggers.
+	l.SetLevel(LevelDebug)
+	child.Debug("shown")
+	assert.Contains(t, out.String(), "msg=shown")
+}
+
+func TestStdLogger(t *testing.T) {
+	t.Parallel()
+
+	l, out := newLogger(LevelInfo, FormatText)
+
+	l.StdLogger(LevelWarn).Println("http: TLS handshake error")
+
+	assert.Equal(t, `time=2024-01-02T03:04:05Z level=WARN msg="http: TLS handshake error"`+"\n", out.String())
+}
+
+func TestContext(t *testing.T) {
+	t.Parallel()
+
+	l, _ := newLogger(LevelInfo, FormatText)
+
+	assert.Equal(t, Default(), FromContext(context.Background()))
+	assert.Equal(t, l, FromContext(NewContext(context.Background(), l)))
+}
+
+func TestNil(t *testing.T) {
+	t.Parallel()
+
+	var l *Logger
+
+	assert.Equal(t, Default().Enabled(LevelInfo), l.Enabled(LevelInfo))
+	assert.NotNil(t, l.With("key", "value"))
+	assert.NotPanics(t, func() {
+		l.Debug("message")
+	})
+}
@@ -0,0 +1,315 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets of latency histograms in seconds.
+var DefaultBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Default is the registry the server metrics are registered with and exposed from.
+var Default = New()
+
+// Sample is a single value of a metric collected at scrape time.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// MetricsService registers metrics and writes them in the Prometheus text format.
+type MetricsService interface {
+	Counter(name, help string, labels ...string) *Counter
+	Gauge(name, help string, labels ...string) *Gauge
+	GaugeFunc(name, help string, collect func() []Sample, labels ...string)
+	Histogram(name, help string, buckets []float64, labels ...string) *Histogram
+	Write(w io.Writer) error
+}
+
+func New() MetricsService {
+	return &service{
+		metrics: []metric{},
+	}
+}
+
+type service struct {
+	sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func (s *service) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{values{desc: desc{name, help, "counter", labels}, series: map[string]float64{}}}
+	s.register(c)
+
+	return c
+}
+
+func (s *service) Gauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{values{desc: desc{name, help, "gauge", labels}, series: map[string]float64{}}}
+	s.register(g)
+
+	return g
+}
+
+// GaugeFunc registers a gauge whose samples are collected on every scrape.
+func (s *service) GaugeFunc(name, help string, collect func() []Sample, labels ...string) {
+	s.register(&gaugeFunc{desc: desc{name, help, "gauge", labels}, collect: collect})
+}
+
+func (s *service) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name, help, "histogram", labels},
+		buckets: append([]float64{}, buckets...),
+		series:  map[string]*histogramSeries{},
+	}
+	sort.Float64s(h.buckets)
+	s.register(h)
+
+	return h
+}
+
+func (s *service) register(m metric) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.metrics = append(s.metrics, m)
+}
+
+func (s *service) Write(w io.Writer) error {
+	s.Lock()
+	metrics := append([]metric{}, s.metrics...)
+	s.Unlock()
+
+	out := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(out)
+	}
+
+	return out.Flush()
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// values holds a value per label values combination.
+type values struct {
+	mu sync.Mutex
+	desc
+	series map[string]float64
+}
+
+func (v *values) add(delta float64, labelValues []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.series[key(v.labels, labelValues)] += delta
+}
+
+func (v *values) set(value float64, labelValues []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.series[key(v.labels, labelValues)] = value
+}
+
+func (v *values) get(labelValues []string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.series[key(v.labels, labelValues)]
+}
+
+func (v *values) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.header(w)
+	for _, k := range sortedKeys(v.series) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, k, format(v.series[k]))
+	}
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	values
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+
+	c.add(delta, labelValues)
+}
+
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.get(labelValues)
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	values
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.add(1, labelValues)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.add(-1, labelValues)
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.set(value, labelValues)
+}
+
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.get(labelValues)
+}
+
+type gaugeFunc struct {
+	desc
+	collect func() []Sample
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	series := map[string]float64{}
+	for _, s := range g.collect() {
+		series[key(g.labels, s.LabelValues)] += s.Value
+	}
+
+	g.header(w)
+	for _, k := range sortedKeys(series) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, k, format(series[k]))
+	}
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	mu sync.Mutex
+	desc
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	k := key(h.labels, labelValues)
+	s, ok := h.series[k]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: append([]string{}, labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[k] = s
+	}
+
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+
+	s.sum += value
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := h.series[k]
+		labels := append(append([]string{}, h.labels...), "le")
+
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, key(labels, append(append([]string{}, s.labelValues...), format(upper))), s.counts[i])
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, key(labels, append(append([]string{}, s.labelValues...), "+Inf")), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, k, format(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, k, s.count)
+	}
+}
+
+// key formats the label pairs of a series, e.g. {endpoint="publish"}. Missing values are empty.
+func key(labels, labelValues []string) string {
+	if len(labels) < 1 {
+		return ""
+	}
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	pairs := make([]string, 0, len(labels))
+	for i, l := range labels {
+		value := ""
+		if i < len(labelValues) {
+			value = labelValues[i]
+		}
+
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l, escape.Replace(value)))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys(series map[string]float64) []string {
+	keys := make([]string, 0, len(series))
+	for k := range series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func format(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New())
+}
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	s := New()
+
+	c := s.Counter("test_total", "Test counter.", "endpoint")
+	c.Inc("publish")
+	c.Add(2, "publish")
+	c.Add(-1, "publish")
+	c.Inc("sub\"scribe")
+
+	g := s.Gauge("test_gauge", "Test gauge.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	s.GaugeFunc("test_func", "Test gauge func.", func() []Sample {
+		return []Sample{{LabelValues: []string{"a"}, Value: 1}, {LabelValues: []string{"a"}, Value: 2}}
+	}, "user")
+
+	h := s.Histogram("test_seconds", "Test histogram.", []float64{1, 0.1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	assert.Equal(t, float64(3), c.Value("publish"))
+	assert.Equal(t, float64(1), g.Value())
+
+	var out bytes.Buffer
+	assert.NoError(t, s.Write(&out))
+	assert.Equal(t, `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{endpoint="publish"} 3
+test_total{endpoint="sub\"scribe"} 1
+# HELP test_gauge Test gauge.
+# TYPE test_gauge gauge
+test_gauge 1
+# HELP test_func Test gauge func.
+# TYPE test_func gauge
+test_func{user="a"} 3
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 2.55
+test_seconds_count 3
+`, out.String())
+}
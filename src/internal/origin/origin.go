@@ -0,0 +1,73 @@
+package origin
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// OriginService decides which cross-origin requests are allowed. Patterns are matched case
+// insensitively against the origin host with filepath.Match, the way websocket upgrades match them.
+type OriginService interface {
+	Allowed(r *http.Request) bool
+	Patterns() []string
+	SetPatterns(patterns []string)
+}
+
+func New(patterns []string) OriginService {
+	s := &service{}
+	s.SetPatterns(patterns)
+
+	return s
+}
+
+type service struct {
+	sync.Mutex
+	patterns []string
+}
+
+// Allowed reports whether the request is same-origin, carries no origin or comes from an allowed one.
+func (s *service) Allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) < 1 {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, p := range s.Patterns() {
+		if ok, _ := filepath.Match(p, strings.ToLower(u.Host)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *service) Patterns() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]string{}, s.patterns...)
+}
+
+func (s *service) SetPatterns(patterns []string) {
+	lower := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		lower = append(lower, strings.ToLower(p))
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.patterns = lower
+}
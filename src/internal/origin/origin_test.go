@@ -0,0 +1,43 @@
+package origin
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New([]string{}))
+}
+
+func TestAllowed(t *testing.T) {
+	t.Parallel()
+
+	s := New([]string{"*.Example.com"})
+
+	request := func(origin string) bool {
+		r := httptest.NewRequest("GET", "http://chat.local:4001/subscribe", nil)
+		if len(origin) > 0 {
+			r.Header.Set("Origin", origin)
+		}
+
+		return s.Allowed(r)
+	}
+
+	assert.True(t, request(""))
+	assert.True(t, request("http://CHAT.local:4001"))
+	assert.True(t, request("https://app.example.com"))
+	assert.False(t, request("https://example.com"))
+	assert.False(t, request("https://evil.test"))
+	assert.False(t, request("http://chat.local:4002"))
+	assert.False(t, request("://broken"))
+
+	s.SetPatterns([]string{"example.com"})
+
+	assert.Equal(t, []string{"example.com"}, s.Patterns())
+	assert.True(t, request("https://example.com"))
+	assert.False(t, request("https://app.example.com"))
+}
@@ -0,0 +1,340 @@
+package poll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"gochat/internal/chat"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+)
+
+var (
+	ErrNotFound      = errors.New("poll session not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+const (
+	DefaultTimeout        = 25 * time.Second
+	DefaultSessionTimeout = time.Minute
+
+	// MaxQueued is the number of events kept for a session between polls, the oldest being dropped
+	// over it.
+	MaxQueued = 1000
+
+	// MaxSessionsPerUser is the number of sessions a user can have open, opening another one closing
+	// the oldest, as cursor-less polls open sessions outliving them.
+	MaxSessionsPerUser = 10
+)
+
+var (
+	activeSessions  = metrics.Default.Gauge("gochat_poll_sessions", "Active long-poll sessions.")
+	reapedSessions  = metrics.Default.Counter("gochat_poll_sessions_reaped_total", "Long-poll sessions closed after their client stopped polling.")
+	evictedSessions = metrics.Default.Counter("gochat_poll_sessions_evicted_total", "Long-poll sessions closed for newer sessions of the same user.")
+	droppedEvents   = metrics.Default.Counter("gochat_poll_events_dropped_total", "Events dropped from long-poll sessions polled too slowly.")
+)
+
+// Timeouts of the long-poll sessions. Poll is how long a poll waits for events and Session how long
+// a session is kept without being polled.
+type Timeouts struct {
+	Poll    time.Duration
+	Session time.Duration
+}
+
+// Cursor is the position of a client in its session, the sequence number of the last event it
+// received.
+type Cursor struct {
+	Session ulid.ULID
+	Seq     uint64
+}
+
+func (c Cursor) String() string {
+	return fmt.Sprintf("%s-%d", c.Session, c.Seq)
+}
+
+func ParseCursor(s string) (Cursor, error) {
+	id, seq, ok := strings.Cut(s, "-")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	session, err := ulid.Parse(id)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{Session: session, Seq: n}, nil
+}
+
+// PollService maps long-poll sessions onto chat subscriptions, queueing the events of a session
+// between polls.
+type PollService interface {
+	Open(ctx context.Context, username string, replay func() []chat.Message) Cursor
+	Poll(ctx context.Context, username string, cursor Cursor) ([]chat.Message, Cursor, error)
+	SetTimeouts(timeouts Timeouts)
+	Timeouts() Timeouts
+	Reap()
+	Run(ctx context.Context)
+	Close()
+}
+
+func New(chatService chat.ChatService, timeouts Timeouts) PollService {
+	return &service{
+		chatService: chatService,
+		sessions:    map[ulid.ULID]*session{},
+		timeouts:    timeouts,
+		maxPerUser:  MaxSessionsPerUser,
+	}
+}
+
+type service struct {
+	sync.Mutex
+	chatService chat.ChatService
+	sessions    map[ulid.ULID]*session
+	timeouts    Timeouts
+	maxPerUser  int
+}
+
+type session struct {
+	sync.Mutex
+	username string
+	cancel   context.CancelFunc
+	done     <-chan struct{}
+
+	// events hold the events after seq-len(events), wake being closed when more arrive.
+	events []chat.Message
+	seq    uint64
+	wake   chan struct{}
+
+	polls    int
+	lastPoll time.Time
+}
+
+// Open subscribes a new session of the user, queueing the replay messages first. The replay is
+// taken once subscribed, so no message is lost in between, the messages it holds being skipped
+// from the subscription. The subscription lasts until the session is reaped, closed or evicted by
+// newer sessions of the user over MaxSessionsPerUser, the logger of the context being used for it.
+func (s *service) Open(ctx context.Context, username string, replay func() []chat.Message) Cursor {
+	subCtx, cancel := context.WithCancel(logger.NewContext(context.Background(), logger.FromContext(ctx)))
+
+	id := ulid.Make()
+	sess := &session{
+		username: username,
+		cancel:   cancel,
+		done:     subCtx.Done(),
+		wake:     make(chan struct{}),
+		lastPoll: time.Now(),
+	}
+
+	messages := s.chatService.Subscribe(subCtx, username)
+
+	replayed := replay()
+	for _, msg := range replayed {
+		sess.push(msg)
+	}
+	last := chat.LastID(replayed)
+
+	// Draining the subscription keeps posting from waiting on clients between polls.
+	go func() {
+		for msg := range messages {
+			if !chat.Replayed(msg, last) {
+				sess.push(msg)
+			}
+		}
+	}()
+
+	s.Lock()
+	s.evict(username)
+	s.sessions[id] = sess
+	s.Unlock()
+
+	activeSessions.Inc()
+
+	return Cursor{Session: id}
+}
+
+// evict closes the oldest sessions of the user until another one fits.
+func (s *service) evict(username string) {
+	ids := []ulid.ULID{}
+	for id, sess := range s.sessions {
+		if sess.username == username {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Compare(ids[j]) < 0
+	})
+
+	for i := 0; i <= len(ids)-s.maxPerUser; i++ {
+		s.remove(ids[i], s.sessions[ids[i]])
+		evictedSessions.Inc()
+	}
+}
+
+// Poll acknowledges the events up to the cursor and returns the ones after it, waiting up to the
+// poll timeout for events to arrive. The returned cursor points to the last event returned.
+func (s *service) Poll(ctx context.Context, username string, cursor Cursor) ([]chat.Message, Cursor, error) {
+	s.Lock()
+	sess, ok := s.sessions[cursor.Session]
+	timeout := s.timeouts.Poll
+	s.Unlock()
+
+	if !ok || sess.username != username {
+		return nil, cursor, ErrNotFound
+	}
+
+	sess.begin()
+	defer sess.end()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		events, seq, wake := sess.after(cursor.Seq)
+		if len(events) > 0 {
+			return events, Cursor{Session: cursor.Session, Seq: seq}, nil
+		}
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			return []chat.Message{}, cursor, nil
+		case <-ctx.Done():
+			return []chat.Message{}, cursor, ctx.Err()
+		case <-sess.done:
+			return nil, cursor, ErrNotFound
+		}
+	}
+}
+
+func (s *service) SetTimeouts(timeouts Timeouts) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.timeouts = timeouts
+}
+
+func (s *service) Timeouts() Timeouts {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.timeouts
+}
+
+// Reap closes the sessions that have not been polled within the session timeout, unsubscribing
+// them from the chat.
+func (s *service) Reap() {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, sess := range s.sessions {
+		if sess.idle(s.timeouts.Session) {
+			s.remove(id, sess)
+			reapedSessions.Inc()
+		}
+	}
+}
+
+// Run reaps idle sessions every half session timeout until the context is done.
+func (s *service) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.Timeouts().Session / 2):
+			s.Reap()
+		}
+	}
+}
+
+// Close closes every session, failing their waiting polls.
+func (s *service) Close() {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, sess := range s.sessions {
+		s.remove(id, sess)
+	}
+}
+
+func (s *service) remove(id ulid.ULID, sess *session) {
+	sess.cancel()
+	delete(s.sessions, id)
+	activeSessions.Dec()
+}
+
+func (s *session) push(msg chat.Message) {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.events) >= MaxQueued {
+		s.events = s.events[1:]
+		droppedEvents.Inc()
+	}
+
+	s.events = append(s.events, msg)
+	s.seq++
+
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// after drops the events up to seq and returns the remaining ones with the sequence number of the
+// last one, and the channel closed on the next event.
+func (s *session) after(seq uint64) ([]chat.Message, uint64, <-chan struct{}) {
+	s.Lock()
+	defer s.Unlock()
+
+	first := s.seq - uint64(len(s.events)) + 1
+	if seq >= first {
+		acked := seq - first + 1
+		if acked > uint64(len(s.events)) {
+			acked = uint64(len(s.events))
+		}
+
+		s.events = s.events[acked:]
+	}
+
+	events := make([]chat.Message, len(s.events))
+	copy(events, s.events)
+
+	return events, s.seq, s.wake
+}
+
+func (s *session) begin() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.polls++
+	s.lastPoll = time.Now()
+}
+
+func (s *session) end() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.polls--
+	s.lastPoll = time.Now()
+}
+
+// idle tells whether the session has not been polled for longer than the timeout.
+func (s *session) idle(timeout time.Duration) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.polls < 1 && time.Since(s.lastPoll) > timeout
+}
@@ -0,0 +1,227 @@
+package poll
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/chat"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New(chat.New(chat.DefaultHistorySize), Timeouts{}))
+}
+
+func TestCursor(t *testing.T) {
+	t.Parallel()
+
+	c := Cursor{Session: ulid.Make(), Seq: 42}
+
+	parsed, err := ParseCursor(c.String())
+	assert.NoError(t, err)
+	assert.Equal(t, c, parsed)
+
+	for _, s := range []string{"", "42", c.Session.String(), "invalid-42", c.Session.String() + "-x"} {
+		_, err := ParseCursor(s)
+		assert.Equal(t, ErrInvalidCursor, err, s)
+	}
+}
+
+func values(messages []chat.Message) []string {
+	values := []string{}
+	for _, m := range messages {
+		values = append(values, m.Message)
+	}
+
+	return values
+}
+
+func replay(messages []chat.Message) func() []chat.Message {
+	return func() []chat.Message {
+		return messages
+	}
+}
+
+func TestPoll(t *testing.T) {
+	t.Parallel()
+
+	chatService := chat.New(chat.DefaultHistorySize)
+	s := New(chatService, Timeouts{Poll: time.Minute, Session: time.Minute})
+
+	cursor := s.Open(context.Background(), "user", replay([]chat.Message{{Message: "replay"}}))
+
+	messages, next, err := s.Poll(context.Background(), "user", cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"replay"}, values(messages))
+
+	// Polling again with the same cursor returns the unacknowledged events again.
+	messages, _, err = s.Poll(context.Background(), "user", cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"replay"}, values(messages))
+
+	posted := make(chan struct{})
+	go func() {
+		defer close(posted)
+
+		time.Sleep(50 * time.Millisecond)
+		chatService.PostMessage(chat.Message{Author: "user", Message: "live"})
+	}()
+
+	messages, next, err = s.Poll(context.Background(), "user", next)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"live"}, values(messages))
+	assert.Equal(t, uint64(2), next.Seq)
+	<-posted
+
+	_, _, err = s.Poll(context.Background(), "other", next)
+	assert.Equal(t, ErrNotFound, err)
+
+	_, _, err = s.Poll(context.Background(), "user", Cursor{Session: ulid.Make()})
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestOpenReplay(t *testing.T) {
+	t.Parallel()
+
+	chatService := chat.New(chat.DefaultHistorySize)
+	s := New(chatService, Timeouts{Poll: 10 * time.Millisecond, Session: time.Minute})
+
+	// A message posted while the replay is taken is in the replay and the subscription, and
+	// returned once.
+	cursor := s.Open(context.Background(), "user", func() []chat.Message {
+		chatService.PostMessage(chat.Message{Author: "user", Message: "racing"})
+
+		return chatService.History()
+	})
+
+	messages, next, err := s.Poll(context.Background(), "user", cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"racing"}, values(messages))
+
+	messages, _, err = s.Poll(context.Background(), "user", next)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+}
+
+func TestMaxSessionsPerUser(t *testing.T) {
+	t.Parallel()
+
+	s := New(chat.New(chat.DefaultHistorySize), Timeouts{Poll: 10 * time.Millisecond, Session: time.Minute})
+	s.(*service).maxPerUser = 2
+
+	oldest := s.Open(context.Background(), "user", replay(nil))
+	s.Open(context.Background(), "user", replay(nil))
+	other := s.Open(context.Background(), "other", replay(nil))
+	newest := s.Open(context.Background(), "user", replay(nil))
+
+	// Opening a session over the limit closes the oldest one of the user only.
+	_, _, err := s.Poll(context.Background(), "user", oldest)
+	assert.Equal(t, ErrNotFound, err)
+
+	_, _, err = s.Poll(context.Background(), "user", newest)
+	assert.NoError(t, err)
+
+	_, _, err = s.Poll(context.Background(), "other", other)
+	assert.NoError(t, err)
+}
+
+func TestPollTimeout(t *testing.T) {
+	t.Parallel()
+
+	s := New(chat.New(chat.DefaultHistorySize), Timeouts{Poll: 10 * time.Millisecond, Session: time.Minute})
+
+	cursor := s.Open(context.Background(), "user", replay(nil))
+
+	messages, next, err := s.Poll(context.Background(), "user", cursor)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+	assert.Equal(t, cursor, next)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s.SetTimeouts(Timeouts{Poll: time.Minute, Session: time.Minute})
+	_, _, err = s.Poll(ctx, "user", cursor)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestMaxQueued(t *testing.T) {
+	t.Parallel()
+
+	chatService := chat.New(chat.DefaultHistorySize)
+	s := New(chatService, Timeouts{Poll: time.Minute, Session: time.Minute})
+
+	messages := make([]chat.Message, MaxQueued+1)
+	messages[MaxQueued].Message = "last"
+
+	cursor := s.Open(context.Background(), "user", replay(messages))
+
+	messages, next, err := s.Poll(context.Background(), "user", cursor)
+	assert.NoError(t, err)
+	assert.Len(t, messages, MaxQueued)
+	assert.Equal(t, "last", messages[MaxQueued-1].Message)
+	assert.Equal(t, uint64(MaxQueued+1), next.Seq)
+}
+
+func TestReap(t *testing.T) {
+	t.Parallel()
+
+	chatService := chat.New(chat.DefaultHistorySize)
+	s := New(chatService, Timeouts{Poll: time.Minute, Session: 20 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go s.Run(ctx)
+
+	polled := s.Open(context.Background(), "polled", replay(nil))
+	abandoned := s.Open(context.Background(), "abandoned", replay(nil))
+
+	// A waiting poll keeps its session alive past the session timeout.
+	done := make(chan error)
+	go func() {
+		_, _, err := s.Poll(context.Background(), "polled", polled)
+		done <- err
+	}()
+
+	assert.Eventually(t, func() bool {
+		_, ok := chatService.Queued()["abandoned"]
+
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+
+	_, _, err := s.Poll(context.Background(), "abandoned", abandoned)
+	assert.Equal(t, ErrNotFound, err)
+
+	chatService.PostMessage(chat.Message{Author: "user", Message: "live"})
+	assert.NoError(t, <-done)
+	assert.Contains(t, chatService.Queued(), "polled")
+}
+
+func TestClose(t *testing.T) {
+	t.Parallel()
+
+	chatService := chat.New(chat.DefaultHistorySize)
+	s := New(chatService, Timeouts{Poll: time.Minute, Session: time.Minute})
+
+	cursor := s.Open(context.Background(), "user", replay(nil))
+
+	done := make(chan error)
+	go func() {
+		_, _, err := s.Poll(context.Background(), "user", cursor)
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	s.Close()
+
+	assert.Equal(t, ErrNotFound, <-done)
+	assert.Eventually(t, func() bool {
+		return len(chatService.Queued()) < 1
+	}, time.Second, 10*time.Millisecond)
+}
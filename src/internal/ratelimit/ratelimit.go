@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gochat/internal/metrics"
+)
+
+const (
+	DefaultRate  = 5
+	DefaultBurst = 10
+)
+
+var limited = metrics.Default.Counter("gochat_messages_rate_limited_total", "Messages dropped over the rate limit by endpoint.", "endpoint")
+
+// Config of the message rate limit, Rate being the messages per second a connection can sustain
+// and Burst how many it can send at once. Zero Rate disables the limit.
+type Config struct {
+	Rate  float64
+	Burst int
+}
+
+// Settings hold the current Config, which can be replaced while connections are running.
+type Settings struct {
+	cfg atomic.Pointer[Config]
+}
+
+func NewSettings(cfg Config) *Settings {
+	s := &Settings{}
+	s.Store(cfg)
+
+	return s
+}
+
+func (s *Settings) Load() Config {
+	return *s.cfg.Load()
+}
+
+func (s *Settings) Store(cfg Config) {
+	s.cfg.Store(&cfg)
+}
+
+// Limiter is the token bucket of a single connection, following the current settings. It is not
+// safe for concurrent use, connections reading their messages one at a time.
+type Limiter struct {
+	settings *Settings
+	endpoint string
+	tokens   float64
+	last     time.Time
+}
+
+// NewLimiter returns the limiter of a connection of the endpoint, which labels the limited
+// messages in metrics.
+func NewLimiter(settings *Settings, endpoint string) *Limiter {
+	return &Limiter{settings: settings, endpoint: endpoint}
+}
+
+// Allow tells whether another message can be sent now, taking a token when it can.
+func (l *Limiter) Allow() bool {
+	if !l.allow(time.Now()) {
+		limited.Inc(l.endpoint)
+
+		return false
+	}
+
+	return true
+}
+
+func (l *Limiter) allow(now time.Time) bool {
+	cfg := l.settings.Load()
+	if cfg.Rate <= 0 {
+		return true
+	}
+
+	burst := float64(cfg.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * cfg.Rate
+	}
+	l.last = now
+
+	if l.tokens > burst {
+		l.tokens = burst
+	}
+
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+
+	return true
+}
+
+// Users keeps a limiter per user for endpoints without a connection to hold one, such as HTTP
+// requests, so that the limit follows the user from request to request and across endpoints
+// sharing it. It is safe for concurrent use.
+type Users struct {
+	sync.Mutex
+	settings *Settings
+	limiters map[string]*Limiter
+}
+
+func NewUsers(settings *Settings) *Users {
+	return &Users{
+		settings: settings,
+		limiters: map[string]*Limiter{},
+	}
+}
+
+// Allow tells whether the user can send another message now through the endpoint, which labels
+// the limited messages in metrics.
+func (u *Users) Allow(username, endpoint string) bool {
+	u.Lock()
+	l, ok := u.limiters[username]
+	if !ok {
+		l = &Limiter{settings: u.settings}
+		u.limiters[username] = l
+	}
+	allowed := l.allow(time.Now())
+	u.Unlock()
+
+	if !allowed {
+		limited.Inc(endpoint)
+
+		return false
+	}
+
+	return true
+}
+
+// Forget drops the limiter of the user, whose name is then free for somebody else to join with.
+func (u *Users) Forget(username string) {
+	u.Lock()
+	defer u.Unlock()
+
+	delete(u.limiters, username)
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettings(t *testing.T) {
+	t.Parallel()
+
+	s := NewSettings(Config{Rate: 1, Burst: 2})
+	assert.Equal(t, Config{Rate: 1, Burst: 2}, s.Load())
+
+	s.Store(Config{})
+	assert.Equal(t, Config{}, s.Load())
+}
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+
+	settings := NewSettings(Config{Rate: 2, Burst: 3})
+	l := NewLimiter(settings, "test")
+	now := time.Now()
+
+	// The burst is allowed at once, then a token comes back every half second.
+	assert.True(t, l.allow(now))
+	assert.True(t, l.allow(now))
+	assert.True(t, l.allow(now))
+	assert.False(t, l.allow(now))
+
+	assert.False(t, l.allow(now.Add(400*time.Millisecond)))
+	assert.True(t, l.allow(now.Add(500*time.Millisecond)))
+	assert.False(t, l.allow(now.Add(500*time.Millisecond)))
+
+	// Tokens do not pile up over the burst.
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.allow(now))
+	}
+	assert.False(t, l.allow(now))
+
+	// Disabling the limit applies to running limiters.
+	settings.Store(Config{})
+	assert.True(t, l.allow(now))
+}
+
+func TestAllow(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(NewSettings(Config{Rate: 1, Burst: 1}), "allow")
+
+	assert.True(t, l.Allow())
+	assert.False(t, l.Allow())
+	assert.Equal(t, float64(1), limited.Value("allow"))
+}
+
+func TestUsers(t *testing.T) {
+	t.Parallel()
+
+	u := NewUsers(NewSettings(Config{Rate: 1, Burst: 1}))
+
+	// Users have their own limits, shared by the endpoints.
+	assert.True(t, u.Allow("user", "users"))
+	assert.False(t, u.Allow("user", "users"))
+	assert.False(t, u.Allow("user", "other users"))
+	assert.True(t, u.Allow("other", "users"))
+	assert.Equal(t, float64(1), limited.Value("users"))
+	assert.Equal(t, float64(1), limited.Value("other users"))
+
+	u.Forget("user")
+	assert.True(t, u.Allow("user", "users"))
+}
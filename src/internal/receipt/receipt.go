@@ -0,0 +1,158 @@
+package receipt
+
+import (
+	"strings"
+
+	"github.com/oklog/ulid/v2"
+
+	"gochat/internal/chat"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/receipt"
+)
+
+// DirectPrefix marks direct conversations, which are named after the other user.
+const DirectPrefix = "@"
+
+// Direct returns the name of the direct conversation with the user.
+func Direct(username string) string {
+	return DirectPrefix + username
+}
+
+type Unread struct {
+	LastRead ulid.ULID
+	Count    int
+}
+
+// ReceiptService tracks read positions per user and conversation, the conversation being the room
+// or a direct conversation.
+type ReceiptService interface {
+	MarkRead(username, conversation string, messageID ulid.ULID) error
+	Unread(username, conversation string) Unread
+
+	// SendDirect posts a direct message, counting it unread for the recipient until read.
+	SendDirect(author, recipient, text string) chat.Message
+
+	// Forget drops the read positions of the user and those of direct conversations with the user,
+	// whose name is then free for somebody else to join with.
+	Forget(username string)
+}
+
+func New(receiptStorage receipt.ReceiptStorage, chatService chat.ChatService) ReceiptService {
+	return &service{
+		receiptStorage: receiptStorage,
+		chatService:    chatService,
+	}
+}
+
+type service struct {
+	receiptStorage receipt.ReceiptStorage
+	chatService    chat.ChatService
+}
+
+// MarkRead moves the read marker of the user in the conversation, pushes the new unread count to
+// all of the user's sessions and tells the other participants the message was seen. An empty
+// conversation is the room.
+func (s *service) MarkRead(username, conversation string, messageID ulid.ULID) error {
+	conversation = conversationOrRoom(conversation)
+
+	other, direct := strings.CutPrefix(conversation, DirectPrefix)
+	if direct {
+		if !contains(s.receiptStorage.Direct(username, conversation), messageID) {
+			return chat.ErrMessageNotFound
+		}
+	} else if _, err := s.chatService.Get(messageID); err != nil {
+		return err
+	}
+
+	if !s.receiptStorage.Set(username, conversation, messageID) {
+		return nil
+	}
+
+	unread := s.Unread(username, conversation)
+
+	s.chatService.PostMessage(chat.Message{
+		ID:           unread.LastRead,
+		Type:         chat.TypeUnread,
+		Author:       chat.ChatAPIName,
+		Count:        unread.Count,
+		Recipient:    username,
+		Conversation: conversation,
+	})
+
+	seen := chat.Message{
+		ID:           messageID,
+		Type:         chat.TypeReceipt,
+		Author:       username,
+		Conversation: conversation,
+	}
+
+	// Only the author of a direct message sees it was read, in the conversation with the reader.
+	if direct {
+		seen.Recipient = other
+		seen.Conversation = Direct(username)
+	}
+
+	s.chatService.PostMessage(seen)
+
+	return nil
+}
+
+func (s *service) Unread(username, conversation string) Unread {
+	conversation = conversationOrRoom(conversation)
+	lastRead := s.receiptStorage.Get(username, conversation)
+
+	if !strings.HasPrefix(conversation, DirectPrefix) {
+		return Unread{
+			LastRead: lastRead,
+			Count:    s.chatService.Unread(username, lastRead),
+		}
+	}
+
+	count := 0
+	for _, id := range s.receiptStorage.Direct(username, conversation) {
+		if id.Compare(lastRead) > 0 {
+			count++
+		}
+	}
+
+	return Unread{
+		LastRead: lastRead,
+		Count:    count,
+	}
+}
+
+func (s *service) SendDirect(author, recipient, text string) chat.Message {
+	posted := s.chatService.PostMessage(chat.Message{
+		Type:      chat.TypeDirect,
+		Author:    author,
+		Message:   text,
+		Recipient: recipient,
+	})
+
+	s.receiptStorage.AddDirect(recipient, Direct(author), posted.ID)
+
+	return posted
+}
+
+func (s *service) Forget(username string) {
+	s.receiptStorage.Forget(username)
+	s.receiptStorage.ForgetConversation(Direct(username))
+}
+
+func conversationOrRoom(conversation string) string {
+	if len(conversation) < 1 {
+		return room.ID
+	}
+
+	return conversation
+}
+
+func contains(ids []ulid.ULID, id ulid.ULID) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package receipt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/chat"
+	"gochat/internal/room"
+	"gochat/internal/storage/inmemory/receipt"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New(receipt.New(), chat.New(chat.DefaultHistorySize)))
+}
+
+func TestMarkRead(t *testing.T) {
+	t.Parallel()
+
+	chatService := chat.New(chat.DefaultHistorySize)
+	s := &service{
+		receiptStorage: receipt.New(),
+		chatService:    chatService,
+	}
+
+	first := chatService.PostMessage(chat.Message{Author: "other", Message: "first"})
+	chatService.PostMessage(chat.Message{Author: "other", Message: "second"})
+
+	assert.Equal(t, Unread{Count: 2}, s.Unread("user", ""))
+
+	assert.Equal(t, chat.ErrMessageNotFound, s.MarkRead("user", "", ulid.Make()))
+
+	assert.NoError(t, s.MarkRead("user", "", first.ID))
+	assert.Equal(t, Unread{LastRead: first.ID, Count: 1}, s.Unread("user", room.ID))
+	assert.Equal(t, Unread{}, s.Unread("other", room.ID))
+}
+
+func TestDirect(t *testing.T) {
+	t.Parallel()
+
+	chatService := chat.New(chat.DefaultHistorySize)
+	s := New(receipt.New(), chatService)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := chatService.Subscribe(ctx, "other")
+
+	first := s.SendDirect("other", "user", "first")
+	second := s.SendDirect("other", "user", "second")
+	s.SendDirect("user", "other", "reply")
+	<-messages
+
+	assert.Equal(t, Unread{Count: 2}, s.Unread("user", Direct("other")))
+	assert.Equal(t, Unread{Count: 1}, s.Unread("other", Direct("user")))
+
+	// Direct messages are read in their conversation only.
+	assert.Equal(t, chat.ErrMessageNotFound, s.MarkRead("user", "", first.ID))
+	assert.Equal(t, chat.ErrMessageNotFound, s.MarkRead("user", Direct("third"), first.ID))
+
+	assert.NoError(t, s.MarkRead("user", Direct("other"), first.ID))
+	assert.Equal(t, Unread{LastRead: first.ID, Count: 1}, s.Unread("user", Direct("other")))
+	assert.Equal(t, chat.Message{
+		ID:           first.ID,
+		Type:         chat.TypeReceipt,
+		Author:       "user",
+		Recipient:    "other",
+		Conversation: Direct("user"),
+	}, withoutTrace(<-messages))
+
+	assert.NoError(t, s.MarkRead("user", Direct("other"), second.ID))
+	assert.Equal(t, Unread{LastRead: second.ID}, s.Unread("user", Direct("other")))
+}
+
+func TestForget(t *testing.T) {
+	t.Parallel()
+
+	chatService := chat.New(chat.DefaultHistorySize)
+	s := New(receipt.New(), chatService)
+
+	posted := chatService.PostMessage(chat.Message{Author: "other", Message: "hello"})
+	direct := s.SendDirect("user", "other", "psst")
+	assert.NoError(t, s.MarkRead("user", "", posted.ID))
+
+	// The next user with the name starts over, and is not the one the direct messages were with.
+	s.Forget("user")
+
+	assert.Equal(t, Unread{Count: 1}, s.Unread("user", ""))
+	assert.Equal(t, Unread{}, s.Unread("other", Direct("user")))
+	assert.Equal(t, chat.ErrMessageNotFound, s.MarkRead("other", Direct("user"), direct.ID))
+}
+
+func withoutTrace(m chat.Message) chat.Message {
+	m.TraceParent = ""
+
+	return m
+}
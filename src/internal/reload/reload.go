@@ -0,0 +1,72 @@
+package reload
+
+import (
+	"sync"
+
+	"gochat/internal/config"
+	"gochat/internal/logger"
+)
+
+// Applier applies a validated configuration to a running service.
+type Applier func(cfg config.Config)
+
+// ReloadService reloads the configuration and applies it to the running services.
+type ReloadService interface {
+	Reload() error
+	Config() config.Config
+}
+
+func New(cfg config.Config, load func() (config.Config, error), appliers ...Applier) ReloadService {
+	return &service{
+		cfg:      cfg,
+		load:     load,
+		appliers: appliers,
+	}
+}
+
+type service struct {
+	sync.Mutex
+	cfg      config.Config
+	load     func() (config.Config, error)
+	appliers []Applier
+}
+
+// Reload loads the configuration again and applies it. An invalid configuration is rejected as a
+// whole and the current one is kept. Settings that need a restart keep their current values.
+func (s *service) Reload() error {
+	s.Lock()
+	defer s.Unlock()
+
+	cfg, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	if cfg.Listen != s.cfg.Listen || cfg.TLS != s.cfg.TLS || cfg.Storage != s.cfg.Storage || cfg.Tracing != s.cfg.Tracing || cfg.Admin != s.cfg.Admin || cfg.TCP != s.cfg.TCP || cfg.IRC != s.cfg.IRC || cfg.Webhooks != s.cfg.Webhooks {
+		logger.Default().Warn("listen, tls, storage, tracing, admin, tcp, irc and webhooks settings are applied on restart only")
+
+		cfg.Listen = s.cfg.Listen
+		cfg.TLS = s.cfg.TLS
+		cfg.Storage = s.cfg.Storage
+		cfg.Tracing = s.cfg.Tracing
+		cfg.Admin = s.cfg.Admin
+		cfg.TCP = s.cfg.TCP
+		cfg.IRC = s.cfg.IRC
+		cfg.Webhooks = s.cfg.Webhooks
+	}
+
+	for _, apply := range s.appliers {
+		apply(cfg)
+	}
+
+	s.cfg = cfg
+
+	return nil
+}
+
+func (s *service) Config() config.Config {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.cfg
+}
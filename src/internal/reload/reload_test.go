@@ -0,0 +1,62 @@
+package reload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New(config.Default(), func() (config.Config, error) {
+		return config.Default(), nil
+	}))
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	next := config.Default()
+	next.History.Size = 10
+	next.Listen.Address = ":5000"
+	next.Tracing.Exporter = "stdout"
+	next.TCP.Listen = ":4003"
+	next.IRC.Listen = ":6667"
+	next.Webhooks.QueueFile = "webhooks.json"
+
+	applied := []config.Config{}
+	s := New(config.Default(), func() (config.Config, error) {
+		return next, nil
+	}, func(cfg config.Config) {
+		applied = append(applied, cfg)
+	})
+
+	assert.NoError(t, s.Reload())
+
+	assert.Equal(t, 10, s.Config().History.Size)
+	assert.Equal(t, config.Default().Listen, s.Config().Listen)
+	assert.Equal(t, config.Default().Tracing, s.Config().Tracing)
+	assert.Equal(t, config.Default().TCP, s.Config().TCP)
+	assert.Equal(t, config.Default().IRC, s.Config().IRC)
+	assert.Equal(t, config.Default().Webhooks, s.Config().Webhooks)
+	assert.Equal(t, []config.Config{s.Config()}, applied)
+}
+
+func TestReloadInvalid(t *testing.T) {
+	t.Parallel()
+
+	applied := false
+	s := New(config.Default(), func() (config.Config, error) {
+		return config.Config{}, assert.AnError
+	}, func(cfg config.Config) {
+		applied = true
+	})
+
+	assert.Equal(t, assert.AnError, s.Reload())
+
+	assert.False(t, applied)
+	assert.Equal(t, config.Default(), s.Config())
+}
@@ -0,0 +1,190 @@
+package room
+
+import (
+	"crypto/subtle"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/oklog/ulid/v2"
+
+	"gochat/internal/chat"
+	"gochat/internal/storage/inmemory/room"
+)
+
+const (
+	// ID identifies the room, the chat having a single one.
+	ID = "general"
+
+	// MaxTopicLength limits the size of the room topic in bytes.
+	MaxTopicLength = 256
+)
+
+var (
+	ErrForbidden    = errors.New("forbidden")
+	ErrInvalidTopic = errors.New("invalid topic")
+)
+
+type RoomService interface {
+	Room() room.Room
+	SetTopic(username, topic string) error
+	Pin(username string, messageID ulid.ULID) error
+	Unpin(username string, messageID ulid.ULID) error
+	SetModerators(moderators []string)
+	SetModeratorKey(key string)
+	Moderators() []string
+	Authorize(username, key string) bool
+}
+
+func New(roomStorage room.RoomStorage, chatService chat.ChatService, moderators []string) RoomService {
+	s := &service{
+		roomStorage: roomStorage,
+		chatService: chatService,
+	}
+	s.SetModerators(moderators)
+
+	return s
+}
+
+type service struct {
+	sync.Mutex
+	roomStorage room.RoomStorage
+	chatService chat.ChatService
+	moderators  map[string]bool
+	key         string
+}
+
+func (s *service) Room() room.Room {
+	return s.roomStorage.Get()
+}
+
+func (s *service) SetTopic(username, topic string) error {
+	if !s.isModerator(username) {
+		return ErrForbidden
+	}
+
+	if len(topic) > MaxTopicLength {
+		return ErrInvalidTopic
+	}
+
+	s.roomStorage.SetTopic(topic)
+
+	// Announce topic change.
+	s.chatService.PostMessage(chat.Message{
+		Type:    chat.TypeTopic,
+		Author:  chat.ChatAPIName,
+		Message: topic,
+	})
+
+	return nil
+}
+
+func (s *service) Pin(username string, messageID ulid.ULID) error {
+	if !s.isModerator(username) {
+		return ErrForbidden
+	}
+
+	m, err := s.chatService.Get(messageID)
+	if err != nil {
+		return err
+	}
+
+	if !s.roomStorage.Pin(room.Pin{
+		MessageID: m.ID,
+		Author:    m.Author,
+		Message:   m.Message,
+		PinnedBy:  username,
+	}) {
+		return nil
+	}
+
+	// Announce pinned message.
+	s.chatService.PostMessage(chat.Message{
+		ID:      m.ID,
+		Type:    chat.TypePin,
+		Author:  m.Author,
+		Message: m.Message,
+	})
+
+	return nil
+}
+
+func (s *service) Unpin(username string, messageID ulid.ULID) error {
+	if !s.isModerator(username) {
+		return ErrForbidden
+	}
+
+	if !s.roomStorage.Unpin(messageID) {
+		return nil
+	}
+
+	// Announce unpinned message.
+	s.chatService.PostMessage(chat.Message{
+		ID:     messageID,
+		Type:   chat.TypeUnpin,
+		Author: chat.ChatAPIName,
+	})
+
+	return nil
+}
+
+// SetModerators replaces the list of users allowed to manage the room.
+func (s *service) SetModerators(moderators []string) {
+	m := map[string]bool{}
+	for _, moderator := range moderators {
+		m[moderator] = true
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.moderators = m
+}
+
+// SetModeratorKey replaces the key users join with to take moderator names, no key reserving them.
+func (s *service) SetModeratorKey(key string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.key = key
+}
+
+// Authorize tells whether the user can take the name with the key. Moderation rights go with the
+// name, so moderator names need the moderator key instead of going to whoever joins first.
+func (s *service) Authorize(username, key string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.moderators[username] {
+		return true
+	}
+
+	return len(s.key) > 0 && subtle.ConstantTimeCompare([]byte(key), []byte(s.key)) == 1
+}
+
+// Moderators returns the moderators in alphabetical order.
+func (s *service) Moderators() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	moderators := make([]string, 0, len(s.moderators))
+	for moderator := range s.moderators {
+		moderators = append(moderators, moderator)
+	}
+	sort.Strings(moderators)
+
+	return moderators
+}
+
+// isModerator reports whether the user may manage the room, which the chat itself, acting for
+// administrators, always may.
+func (s *service) isModerator(username string) bool {
+	if username == chat.ChatAPIName {
+		return true
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	return s.moderators[username]
+}
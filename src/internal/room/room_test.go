@@ -0,0 +1,84 @@
+package room
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/chat"
+	"gochat/internal/storage/inmemory/room"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New(room.New(), chat.New(chat.DefaultHistorySize), []string{}))
+}
+
+func TestSetTopic(t *testing.T) {
+	t.Parallel()
+
+	s := New(room.New(), chat.New(chat.DefaultHistorySize), []string{"moderator"})
+
+	assert.Equal(t, ErrForbidden, s.SetTopic("user", "topic"))
+	assert.Equal(t, ErrInvalidTopic, s.SetTopic("moderator", string(make([]byte, MaxTopicLength+1))))
+
+	assert.NoError(t, s.SetTopic("moderator", "topic"))
+	assert.Equal(t, "topic", s.Room().Topic)
+}
+
+func TestPin(t *testing.T) {
+	t.Parallel()
+
+	chatService := chat.New(chat.DefaultHistorySize)
+	s := New(room.New(), chatService, []string{"moderator"})
+
+	m := chatService.PostMessage(chat.Message{Author: "author", Message: "message"})
+
+	assert.Equal(t, ErrForbidden, s.Pin("user", m.ID))
+	assert.Equal(t, chat.ErrMessageNotFound, s.Pin("moderator", ulid.Make()))
+
+	assert.NoError(t, s.Pin("moderator", m.ID))
+	assert.NoError(t, s.Pin("moderator", m.ID))
+	assert.Equal(t, []room.Pin{{
+		MessageID: m.ID,
+		Author:    "author",
+		Message:   "message",
+		PinnedBy:  "moderator",
+	}}, s.Room().Pins)
+
+	assert.Equal(t, ErrForbidden, s.Unpin("user", m.ID))
+	assert.NoError(t, s.Unpin("moderator", m.ID))
+	assert.Empty(t, s.Room().Pins)
+}
+
+func TestSetModerators(t *testing.T) {
+	t.Parallel()
+
+	s := New(room.New(), chat.New(chat.DefaultHistorySize), []string{"moderator"})
+
+	s.SetModerators([]string{"user", "another"})
+
+	assert.Equal(t, []string{"another", "user"}, s.Moderators())
+	assert.Equal(t, ErrForbidden, s.SetTopic("moderator", "topic"))
+	assert.NoError(t, s.SetTopic("user", "topic"))
+	assert.NoError(t, s.SetTopic(chat.ChatAPIName, "topic"))
+}
+
+func TestAuthorize(t *testing.T) {
+	t.Parallel()
+
+	s := New(room.New(), chat.New(chat.DefaultHistorySize), []string{"moderator"})
+
+	// Without a key moderator names are reserved.
+	assert.True(t, s.Authorize("user", ""))
+	assert.False(t, s.Authorize("moderator", ""))
+
+	s.SetModeratorKey("secret")
+
+	assert.True(t, s.Authorize("user", ""))
+	assert.False(t, s.Authorize("moderator", ""))
+	assert.False(t, s.Authorize("moderator", "wrong"))
+	assert.True(t, s.Authorize("moderator", "secret"))
+}
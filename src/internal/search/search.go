@@ -0,0 +1,212 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/oklog/ulid/v2"
+
+	"gochat/internal/chat"
+	"gochat/internal/room"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+type Query struct {
+	Text   string
+	Author string
+
+	// Room limits the results to the messages of the room. The chat has a single room holding every
+	// message, so other rooms have no results.
+	Room string
+
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+type Result struct {
+	Total    int
+	Messages []chat.Message
+}
+
+type SearchService interface {
+	chat.Indexer
+	Search(q Query) Result
+}
+
+func New() SearchService {
+	return &service{
+		messages: map[ulid.ULID]chat.Message{},
+		terms:    map[string]map[ulid.ULID]bool{},
+	}
+}
+
+// service is an inverted index of message terms to message IDs.
+type service struct {
+	sync.RWMutex
+	messages map[ulid.ULID]chat.Message
+	terms    map[string]map[ulid.ULID]bool
+}
+
+// Index adds the message to the index, replacing the previously indexed version of it.
+func (s *service) Index(m chat.Message) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.remove(m.ID)
+
+	s.messages[m.ID] = m
+	for _, t := range tokenize(m.Message) {
+		if s.terms[t] == nil {
+			s.terms[t] = map[ulid.ULID]bool{}
+		}
+
+		s.terms[t][m.ID] = true
+	}
+}
+
+func (s *service) Remove(messageID ulid.ULID) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.remove(messageID)
+}
+
+// Search returns messages containing all the query terms, newest first.
+func (s *service) Search(q Query) Result {
+	s.RLock()
+	defer s.RUnlock()
+
+	matches := []chat.Message{}
+	for id := range s.candidates(tokenize(q.Text)) {
+		m := s.messages[id]
+		if !q.matches(m) {
+			continue
+		}
+
+		matches = append(matches, m)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].ID.Compare(matches[j].ID) > 0
+	})
+
+	limit := q.Limit
+	if limit < 1 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	result := Result{
+		Total:    len(matches),
+		Messages: []chat.Message{},
+	}
+	if q.Offset < len(matches) {
+		end := q.Offset + limit
+		if end > len(matches) {
+			end = len(matches)
+		}
+
+		result.Messages = matches[q.Offset:end]
+	}
+
+	return result
+}
+
+func (s *service) remove(messageID ulid.ULID) {
+	m, ok := s.messages[messageID]
+	if !ok {
+		return
+	}
+
+	for _, t := range tokenize(m.Message) {
+		delete(s.terms[t], messageID)
+		if len(s.terms[t]) < 1 {
+			delete(s.terms, t)
+		}
+	}
+
+	delete(s.messages, messageID)
+}
+
+// candidates returns IDs of messages containing all the terms, or all messages without terms.
+func (s *service) candidates(terms []string) map[ulid.ULID]bool {
+	if len(terms) < 1 {
+		all := map[ulid.ULID]bool{}
+		for id := range s.messages {
+			all[id] = true
+		}
+
+		return all
+	}
+
+	// Intersect starting from the rarest term.
+	sort.Slice(terms, func(i, j int) bool {
+		return len(s.terms[terms[i]]) < len(s.terms[terms[j]])
+	})
+
+	candidates := map[ulid.ULID]bool{}
+	for id := range s.terms[terms[0]] {
+		candidates[id] = true
+	}
+
+	for _, t := range terms[1:] {
+		for id := range candidates {
+			if !s.terms[t][id] {
+				delete(candidates, id)
+			}
+		}
+	}
+
+	return candidates
+}
+
+func (q Query) matches(m chat.Message) bool {
+	if len(q.Author) > 0 && !strings.EqualFold(q.Author, m.Author) {
+		return false
+	}
+
+	if len(q.Room) > 0 && q.Room != room.ID {
+		return false
+	}
+
+	posted := ulid.Time(m.ID.Time())
+	if !q.From.IsZero() && posted.Before(q.From) {
+		return false
+	}
+
+	if !q.To.IsZero() && posted.After(q.To) {
+		return false
+	}
+
+	return true
+}
+
+// tokenize splits the text into unique lower-cased terms.
+func tokenize(text string) []string {
+	terms := []string{}
+	seen := map[string]bool{}
+
+	for _, t := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if seen[t] {
+			continue
+		}
+
+		seen[t] = true
+		terms = append(terms, t)
+	}
+
+	return terms
+}
@@ -0,0 +1,76 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/chat"
+	"gochat/internal/room"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New())
+}
+
+func message(at time.Time, author, text string) chat.Message {
+	return chat.Message{
+		ID:      ulid.MustNew(ulid.Timestamp(at), ulid.DefaultEntropy()),
+		Type:    chat.TypeMessage,
+		Author:  author,
+		Message: text,
+	}
+}
+
+func TestSearch(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	first := message(now.Add(-time.Hour), "alice", "Hello world!")
+	second := message(now.Add(-time.Minute), "bob", "hello, Alice")
+	third := message(now, "alice", "goodbye world")
+
+	s := New()
+	s.Index(first)
+	s.Index(second)
+	s.Index(third)
+
+	assert.Equal(t, Result{Total: 2, Messages: []chat.Message{second, first}}, s.Search(Query{Text: "HELLO"}))
+	assert.Equal(t, Result{Total: 2, Messages: []chat.Message{third, first}}, s.Search(Query{Text: "world"}))
+	assert.Equal(t, Result{Total: 1, Messages: []chat.Message{first}}, s.Search(Query{Text: "hello world"}))
+	assert.Equal(t, Result{Total: 0, Messages: []chat.Message{}}, s.Search(Query{Text: "missing"}))
+
+	assert.Equal(t, Result{Total: 2, Messages: []chat.Message{third, first}}, s.Search(Query{Author: "Alice"}))
+	assert.Equal(t, Result{Total: 1, Messages: []chat.Message{first}}, s.Search(Query{Text: "world", To: now.Add(-time.Minute)}))
+	assert.Equal(t, Result{Total: 2, Messages: []chat.Message{third, second}}, s.Search(Query{From: now.Add(-2 * time.Minute)}))
+
+	assert.Equal(t, Result{Total: 2, Messages: []chat.Message{second, first}}, s.Search(Query{Text: "hello", Room: room.ID}))
+	assert.Equal(t, Result{Total: 0, Messages: []chat.Message{}}, s.Search(Query{Text: "hello", Room: "random"}))
+
+	assert.Equal(t, Result{Total: 3, Messages: []chat.Message{second}}, s.Search(Query{Limit: 1, Offset: 1}))
+	assert.Equal(t, Result{Total: 3, Messages: []chat.Message{}}, s.Search(Query{Offset: 3}))
+}
+
+func TestIndexUpdate(t *testing.T) {
+	t.Parallel()
+
+	m := message(time.Now(), "alice", "original text")
+
+	s := New()
+	s.Index(m)
+
+	m.Message = "edited text"
+	s.Index(m)
+
+	assert.Equal(t, 0, s.Search(Query{Text: "original"}).Total)
+	assert.Equal(t, 1, s.Search(Query{Text: "edited"}).Total)
+
+	s.Remove(m.ID)
+
+	assert.Equal(t, 0, s.Search(Query{Text: "text"}).Total)
+	assert.Empty(t, s.(*service).terms)
+}
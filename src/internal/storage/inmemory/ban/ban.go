@@ -0,0 +1,76 @@
+package ban
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Ban struct {
+	Username string
+	Reason   string
+	BannedAt time.Time
+}
+
+type BanStorage interface {
+	Add(b Ban)
+	Remove(username string) bool
+	Banned(username string) bool
+	List() []Ban
+}
+
+func New() BanStorage {
+	return &storage{
+		bans: map[string]Ban{},
+	}
+}
+
+type storage struct {
+	sync.Mutex
+	bans map[string]Ban
+}
+
+// Add bans the user, replacing an existing ban of the user.
+func (s *storage) Add(b Ban) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.bans[b.Username] = b
+}
+
+// Remove lifts the ban and reports whether the user was banned.
+func (s *storage) Remove(username string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	_, ok := s.bans[username]
+	delete(s.bans, username)
+
+	return ok
+}
+
+func (s *storage) Banned(username string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	_, ok := s.bans[username]
+
+	return ok
+}
+
+// List returns the bans ordered by user name.
+func (s *storage) List() []Ban {
+	s.Lock()
+	defer s.Unlock()
+
+	bans := make([]Ban, 0, len(s.bans))
+	for _, b := range s.bans {
+		bans = append(bans, b)
+	}
+
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Username < bans[j].Username
+	})
+
+	return bans
+}
@@ -0,0 +1,41 @@
+package ban
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New())
+}
+
+func TestBanStorage(t *testing.T) {
+	t.Parallel()
+
+	s := &storage{
+		bans: map[string]Ban{},
+	}
+
+	mockBan := Ban{
+		Username: "user",
+		Reason:   "spam",
+		BannedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	assert.False(t, s.Banned("user"))
+	assert.Empty(t, s.List())
+
+	s.Add(mockBan)
+	s.Add(Ban{Username: "another"})
+
+	assert.True(t, s.Banned("user"))
+	assert.Equal(t, []Ban{{Username: "another"}, mockBan}, s.List())
+
+	assert.True(t, s.Remove("user"))
+	assert.False(t, s.Remove("user"))
+	assert.False(t, s.Banned("user"))
+}
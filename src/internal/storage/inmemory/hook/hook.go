@@ -0,0 +1,133 @@
+package hook
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"gochat/internal/jsonfile"
+)
+
+// Hook is an incoming webhook, posting to the room as the bot name with its token.
+type Hook struct {
+	ID        ulid.ULID
+	Token     string
+	Room      string
+	Name      string
+	CreatedAt time.Time
+}
+
+type HookStorage interface {
+	Add(h Hook) error
+	Get(token string) (Hook, bool)
+	Remove(id ulid.ULID) (bool, error)
+	List() []Hook
+}
+
+// New returns the storage of the hooks of the file, which is rewritten on every change so that the
+// hooks and their tokens survive restarts. An empty file name keeps the hooks in memory only.
+func New(file string) (HookStorage, error) {
+	s := &storage{
+		file:  file,
+		hooks: map[string]Hook{},
+	}
+
+	hooks := []Hook{}
+	if err := jsonfile.Read(file, &hooks); err != nil {
+		return nil, err
+	}
+
+	for _, h := range hooks {
+		s.hooks[h.Token] = h
+	}
+
+	return s, nil
+}
+
+type storage struct {
+	sync.Mutex
+	file  string
+	hooks map[string]Hook
+}
+
+// Add stores the hook, which is not added when it cannot be saved.
+func (s *storage) Add(h Hook) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.hooks[h.Token] = h
+	if err := s.save(); err != nil {
+		delete(s.hooks, h.Token)
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *storage) Get(token string) (Hook, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	h, ok := s.hooks[token]
+
+	return h, ok
+}
+
+// Remove deletes the hook, reporting whether it existed. The hook is kept when it cannot be saved.
+func (s *storage) Remove(id ulid.ULID) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for token, h := range s.hooks {
+		if h.ID == id {
+			delete(s.hooks, token)
+			if err := s.save(); err != nil {
+				s.hooks[token] = h
+
+				return false, err
+			}
+
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// List returns the hooks in creation order.
+func (s *storage) List() []Hook {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.list()
+}
+
+func (s *storage) list() []Hook {
+	hooks := make([]Hook, 0, len(s.hooks))
+	for _, h := range s.hooks {
+		hooks = append(hooks, h)
+	}
+
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].ID.Compare(hooks[j].ID) < 0
+	})
+
+	return hooks
+}
+
+// save replaces the file with the hooks.
+func (s *storage) save() error {
+	if len(s.file) < 1 {
+		return nil
+	}
+
+	if err := jsonfile.Write(s.file, s.list()); err != nil {
+		return fmt.Errorf("error saving incoming webhooks: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package hook
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	s, err := New("")
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+
+	file := filepath.Join(t.TempDir(), "hooks.json")
+	assert.NoError(t, os.WriteFile(file, []byte("invalid"), 0o600))
+
+	_, err = New(file)
+	assert.Error(t, err)
+}
+
+func TestHookStorage(t *testing.T) {
+	t.Parallel()
+
+	s := &storage{
+		hooks: map[string]Hook{},
+	}
+
+	first := Hook{ID: ulid.Make(), Token: "first-token", Room: "general", Name: "CI"}
+	second := Hook{ID: ulid.Make(), Token: "second-token", Room: "general", Name: "Deploy"}
+
+	_, ok := s.Get("first-token")
+	assert.False(t, ok)
+	assert.Empty(t, s.List())
+
+	assert.NoError(t, s.Add(second))
+	assert.NoError(t, s.Add(first))
+
+	h, ok := s.Get("first-token")
+	assert.True(t, ok)
+	assert.Equal(t, first, h)
+	assert.Equal(t, []Hook{first, second}, s.List())
+
+	removed, err := s.Remove(second.ID)
+	assert.NoError(t, err)
+	assert.True(t, removed)
+
+	removed, err = s.Remove(second.ID)
+	assert.NoError(t, err)
+	assert.False(t, removed)
+
+	_, ok = s.Get("second-token")
+	assert.False(t, ok)
+	assert.Equal(t, []Hook{first}, s.List())
+}
+
+func TestPersistence(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "hooks.json")
+
+	s, err := New(file)
+	assert.NoError(t, err)
+
+	first := Hook{ID: ulid.Make(), Token: "first-token", Room: "general", Name: "CI"}
+	second := Hook{ID: ulid.Make(), Token: "second-token", Room: "general", Name: "Deploy"}
+	assert.NoError(t, s.Add(first))
+	assert.NoError(t, s.Add(second))
+	_, err = s.Remove(first.ID)
+	assert.NoError(t, err)
+
+	// The hooks and their tokens survive a restart.
+	restarted, err := New(file)
+	assert.NoError(t, err)
+
+	h, ok := restarted.Get("second-token")
+	assert.True(t, ok)
+	assert.Equal(t, second.ID, h.ID)
+	assert.Len(t, restarted.List(), 1)
+
+	// Changes that cannot be saved are not kept.
+	failing := &storage{
+		file:  filepath.Join(t.TempDir(), "missing", "hooks.json"),
+		hooks: map[string]Hook{},
+	}
+	assert.Error(t, failing.Add(first))
+	assert.Empty(t, failing.List())
+}
@@ -0,0 +1,89 @@
+package mention
+
+import (
+	"sync"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// InboxSize is the number of most recent mentions kept per user.
+const InboxSize = 100
+
+type Mention struct {
+	MessageID ulid.ULID
+	Author    string
+	Message   string
+	Read      bool
+}
+
+type MentionStorage interface {
+	Add(username string, m Mention)
+	List(username string, unreadOnly bool) []Mention
+	MarkRead(username string, messageIDs ...ulid.ULID)
+	Forget(username string)
+}
+
+func New() MentionStorage {
+	return &storage{
+		inboxes: map[string][]Mention{},
+	}
+}
+
+type storage struct {
+	sync.Mutex
+	inboxes map[string][]Mention
+}
+
+func (s *storage) Add(username string, m Mention) {
+	s.Lock()
+	defer s.Unlock()
+
+	inbox := append(s.inboxes[username], m)
+	if len(inbox) > InboxSize {
+		inbox = inbox[len(inbox)-InboxSize:]
+	}
+
+	s.inboxes[username] = inbox
+}
+
+func (s *storage) List(username string, unreadOnly bool) []Mention {
+	s.Lock()
+	defer s.Unlock()
+
+	mentions := []Mention{}
+	for _, m := range s.inboxes[username] {
+		if unreadOnly && m.Read {
+			continue
+		}
+
+		mentions = append(mentions, m)
+	}
+
+	return mentions
+}
+
+// MarkRead marks the given mentions as read, or all of them if no message IDs are given.
+func (s *storage) MarkRead(username string, messageIDs ...ulid.ULID) {
+	s.Lock()
+	defer s.Unlock()
+
+	ids := map[ulid.ULID]bool{}
+	for _, id := range messageIDs {
+		ids[id] = true
+	}
+
+	inbox := s.inboxes[username]
+	for i := range inbox {
+		if len(ids) < 1 || ids[inbox[i].MessageID] {
+			inbox[i].Read = true
+		}
+	}
+}
+
+// Forget drops the inbox of the user, which is not passed on to the next user with the name.
+func (s *storage) Forget(username string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.inboxes, username)
+}
@@ -0,0 +1,69 @@
+package mention
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New())
+}
+
+func TestMentionStorage(t *testing.T) {
+	t.Parallel()
+
+	s := &storage{
+		inboxes: map[string][]Mention{},
+	}
+
+	mockFirst := Mention{MessageID: ulid.MustParse("01H2NEEJ6ZVYSBEENV616A1RZ7"), Author: "author", Message: "@user hi"}
+	mockSecond := Mention{MessageID: ulid.MustParse("01H2NEEJ6ZVYSBEENV616A1RZ8"), Author: "author", Message: "@user bye"}
+
+	assert.Empty(t, s.List("user", false))
+
+	s.Add("user", mockFirst)
+	s.Add("user", mockSecond)
+
+	assert.Equal(t, []Mention{mockFirst, mockSecond}, s.List("user", true))
+	assert.Empty(t, s.List("other", false))
+
+	s.MarkRead("user", mockFirst.MessageID)
+
+	assert.Equal(t, []Mention{mockSecond}, s.List("user", true))
+	assert.Equal(t, 2, len(s.List("user", false)))
+
+	s.MarkRead("user")
+
+	assert.Empty(t, s.List("user", true))
+}
+
+func TestInboxSize(t *testing.T) {
+	t.Parallel()
+
+	s := &storage{
+		inboxes: map[string][]Mention{},
+	}
+
+	for i := 0; i < InboxSize+1; i++ {
+		s.Add("user", Mention{MessageID: ulid.Make()})
+	}
+
+	assert.Equal(t, InboxSize, len(s.List("user", false)))
+}
+
+func TestForget(t *testing.T) {
+	t.Parallel()
+
+	s := New()
+	s.Add("user", Mention{MessageID: ulid.Make()})
+	s.Add("other", Mention{MessageID: ulid.Make()})
+
+	s.Forget("user")
+
+	assert.Empty(t, s.List("user", false))
+	assert.Len(t, s.List("other", false), 1)
+}
@@ -0,0 +1,110 @@
+package receipt
+
+import (
+	"sync"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// DirectSize is the number of most recent direct messages kept per conversation for unread counts.
+const DirectSize = 100
+
+type ReceiptStorage interface {
+	// Set moves the last read message of the user in the conversation forward and reports whether
+	// it changed.
+	Set(username, conversation string, messageID ulid.ULID) bool
+	Get(username, conversation string) ulid.ULID
+
+	// AddDirect keeps the ID of a direct message the user received in the conversation, dropping the
+	// oldest ones over DirectSize.
+	AddDirect(username, conversation string, messageID ulid.ULID)
+	Direct(username, conversation string) []ulid.ULID
+
+	// Forget drops the read markers and direct messages of the user.
+	Forget(username string)
+
+	// ForgetConversation drops the read markers and direct messages of the conversation for every user.
+	ForgetConversation(conversation string)
+}
+
+func New() ReceiptStorage {
+	return &storage{
+		receipts: map[key]ulid.ULID{},
+		direct:   map[key][]ulid.ULID{},
+	}
+}
+
+type key struct {
+	username     string
+	conversation string
+}
+
+type storage struct {
+	sync.Mutex
+	receipts map[key]ulid.ULID
+	direct   map[key][]ulid.ULID
+}
+
+func (s *storage) Set(username, conversation string, messageID ulid.ULID) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	k := key{username, conversation}
+	if s.receipts[k].Compare(messageID) >= 0 {
+		return false
+	}
+
+	s.receipts[k] = messageID
+
+	return true
+}
+
+func (s *storage) Get(username, conversation string) ulid.ULID {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.receipts[key{username, conversation}]
+}
+
+func (s *storage) AddDirect(username, conversation string, messageID ulid.ULID) {
+	s.Lock()
+	defer s.Unlock()
+
+	k := key{username, conversation}
+	s.direct[k] = append(s.direct[k], messageID)
+	if len(s.direct[k]) > DirectSize {
+		s.direct[k] = s.direct[k][len(s.direct[k])-DirectSize:]
+	}
+}
+
+func (s *storage) Direct(username, conversation string) []ulid.ULID {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]ulid.ULID{}, s.direct[key{username, conversation}]...)
+}
+
+func (s *storage) Forget(username string) {
+	s.forget(func(k key) bool { return k.username == username })
+}
+
+func (s *storage) ForgetConversation(conversation string) {
+	s.forget(func(k key) bool { return k.conversation == conversation })
+}
+
+func (s *storage) forget(match func(k key) bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	for k := range s.receipts {
+		if match(k) {
+			delete(s.receipts, k)
+		}
+	}
+
+	for k := range s.direct {
+		if match(k) {
+			delete(s.direct, k)
+		}
+	}
+}
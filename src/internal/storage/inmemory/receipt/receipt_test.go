@@ -0,0 +1,79 @@
+package receipt
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New())
+}
+
+func TestReceiptStorage(t *testing.T) {
+	t.Parallel()
+
+	s := New()
+
+	mockOlder := ulid.MustParse("01H2NEEJ6ZVYSBEENV616A1RZ7")
+	mockNewer := ulid.MustParse("01H2NEEJ6ZVYSBEENV616A1RZ8")
+
+	assert.Empty(t, s.Get("user", "general"))
+
+	assert.True(t, s.Set("user", "general", mockNewer))
+	assert.Equal(t, mockNewer, s.Get("user", "general"))
+
+	assert.False(t, s.Set("user", "general", mockNewer))
+	assert.False(t, s.Set("user", "general", mockOlder))
+	assert.Equal(t, mockNewer, s.Get("user", "general"))
+
+	// Conversations have their own markers.
+	assert.Empty(t, s.Get("user", "@other"))
+	assert.True(t, s.Set("user", "@other", mockOlder))
+	assert.Equal(t, mockOlder, s.Get("user", "@other"))
+}
+
+func TestDirect(t *testing.T) {
+	t.Parallel()
+
+	s := New()
+
+	ids := []ulid.ULID{}
+	for i := 0; i < DirectSize+1; i++ {
+		ids = append(ids, ulid.Make())
+		s.AddDirect("user", "@other", ids[i])
+	}
+
+	assert.Equal(t, ids[1:], s.Direct("user", "@other"))
+	assert.Empty(t, s.Direct("other", "@user"))
+}
+
+func TestForget(t *testing.T) {
+	t.Parallel()
+
+	s := New()
+
+	messageID := ulid.Make()
+	s.Set("user", "general", messageID)
+	s.Set("user", "@other", messageID)
+	s.AddDirect("user", "@other", messageID)
+	s.Set("other", "general", messageID)
+	s.Set("other", "@user", messageID)
+	s.AddDirect("other", "@user", messageID)
+	s.Set("third", "@other", messageID)
+
+	s.Forget("user")
+	s.ForgetConversation("@user")
+
+	assert.Empty(t, s.Get("user", "general"))
+	assert.Empty(t, s.Get("user", "@other"))
+	assert.Empty(t, s.Direct("user", "@other"))
+	assert.Empty(t, s.Get("other", "@user"))
+	assert.Empty(t, s.Direct("other", "@user"))
+
+	assert.Equal(t, messageID, s.Get("other", "general"))
+	assert.Equal(t, messageID, s.Get("third", "@other"))
+}
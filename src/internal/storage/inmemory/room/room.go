@@ -0,0 +1,93 @@
+package room
+
+import (
+	"sync"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// MaxPins is the number of messages that can be pinned at once.
+const MaxPins = 50
+
+type Pin struct {
+	MessageID ulid.ULID
+	Author    string
+	Message   string
+	PinnedBy  string
+}
+
+type Room struct {
+	Topic string
+	Pins  []Pin
+}
+
+type RoomStorage interface {
+	Get() Room
+	SetTopic(topic string)
+	Pin(p Pin) bool
+	Unpin(messageID ulid.ULID) bool
+}
+
+func New() RoomStorage {
+	return &storage{
+		room: Room{
+			Pins: []Pin{},
+		},
+	}
+}
+
+type storage struct {
+	sync.Mutex
+	room Room
+}
+
+func (s *storage) Get() Room {
+	s.Lock()
+	defer s.Unlock()
+
+	return Room{
+		Topic: s.room.Topic,
+		Pins:  append([]Pin{}, s.room.Pins...),
+	}
+}
+
+func (s *storage) SetTopic(topic string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.room.Topic = topic
+}
+
+// Pin adds the pin and reports whether the message was not pinned yet. The oldest pin is dropped over MaxPins.
+func (s *storage) Pin(p Pin) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, pin := range s.room.Pins {
+		if pin.MessageID == p.MessageID {
+			return false
+		}
+	}
+
+	s.room.Pins = append(s.room.Pins, p)
+	if len(s.room.Pins) > MaxPins {
+		s.room.Pins = s.room.Pins[len(s.room.Pins)-MaxPins:]
+	}
+
+	return true
+}
+
+func (s *storage) Unpin(messageID ulid.ULID) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	for i, pin := range s.room.Pins {
+		if pin.MessageID == messageID {
+			s.room.Pins = append(s.room.Pins[:i], s.room.Pins[i+1:]...)
+
+			return true
+		}
+	}
+
+	return false
+}
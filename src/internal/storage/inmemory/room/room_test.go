@@ -0,0 +1,64 @@
+package room
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	assert.NotNil(t, New())
+}
+
+func TestRoomStorage(t *testing.T) {
+	t.Parallel()
+
+	s := &storage{
+		room: Room{
+			Pins: []Pin{},
+		},
+	}
+
+	mockPin := Pin{
+		MessageID: ulid.MustParse("01H2NEEJ6ZVYSBEENV616A1RZ7"),
+		Author:    "author",
+		Message:   "message",
+		PinnedBy:  "moderator",
+	}
+
+	assert.Equal(t, Room{Pins: []Pin{}}, s.Get())
+
+	s.SetTopic("topic")
+	assert.True(t, s.Pin(mockPin))
+	assert.False(t, s.Pin(mockPin))
+
+	assert.Equal(t, Room{Topic: "topic", Pins: []Pin{mockPin}}, s.Get())
+
+	assert.True(t, s.Unpin(mockPin.MessageID))
+	assert.False(t, s.Unpin(mockPin.MessageID))
+
+	assert.Empty(t, s.Get().Pins)
+}
+
+func TestMaxPins(t *testing.T) {
+	t.Parallel()
+
+	s := &storage{
+		room: Room{
+			Pins: []Pin{},
+		},
+	}
+
+	first := ulid.Make()
+	s.Pin(Pin{MessageID: first})
+	for i := 0; i < MaxPins; i++ {
+		s.Pin(Pin{MessageID: ulid.Make()})
+	}
+
+	pins := s.Get().Pins
+	assert.Equal(t, MaxPins, len(pins))
+	assert.NotEqual(t, first, pins[0].MessageID)
+}
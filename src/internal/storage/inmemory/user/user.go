@@ -2,6 +2,7 @@ package user
 
 import (
 	"errors"
+	"sort"
 	"sync"
 
 	"github.com/oklog/ulid/v2"
@@ -10,19 +11,29 @@ import (
 type UserStorage interface {
 	FindTokenByUsername(username string) (ulid.ULID, error)
 	Set(token ulid.ULID, username string)
+	SetIfAbsent(token ulid.ULID, username string) bool
 	Get(token ulid.ULID) string
 	Remove(token ulid.ULID)
+	List() []string
 }
 
-func New() UserStorage {
+// Forgetter drops what it keeps about a user once the user leaves, as the name is then free for
+// somebody else to join with.
+type Forgetter interface {
+	Forget(username string)
+}
+
+func New(forgetters ...Forgetter) UserStorage {
 	return &storage{
-		users: map[ulid.ULID]string{},
+		users:      map[ulid.ULID]string{},
+		forgetters: forgetters,
 	}
 }
 
 type storage struct {
 	sync.Mutex
-	users map[ulid.ULID]string
+	users      map[ulid.ULID]string
+	forgetters []Forgetter
 }
 
 func (s *storage) FindTokenByUsername(username string) (ulid.ULID, error) {
@@ -45,6 +56,23 @@ func (s *storage) Set(token ulid.ULID, username string) {
 	s.users[token] = username
 }
 
+// SetIfAbsent stores the token of the user unless another token has the name, telling whether it
+// did, so that concurrent joins cannot take the same name.
+func (s *storage) SetIfAbsent(token ulid.ULID, username string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, u := range s.users {
+		if u == username {
+			return false
+		}
+	}
+
+	s.users[token] = username
+
+	return true
+}
+
 func (s *storage) Get(token ulid.ULID) string {
 	s.Lock()
 	defer s.Unlock()
@@ -52,9 +80,38 @@ func (s *storage) Get(token ulid.ULID) string {
 	return s.users[token]
 }
 
+// Remove removes the token, the forgetters forgetting the user unless another token has the name.
 func (s *storage) Remove(token ulid.ULID) {
+	s.Lock()
+	username, ok := s.users[token]
+	delete(s.users, token)
+
+	for _, u := range s.users {
+		if u == username {
+			ok = false
+		}
+	}
+	s.Unlock()
+
+	if !ok {
+		return
+	}
+
+	for _, f := range s.forgetters {
+		f.Forget(username)
+	}
+}
+
+// List returns the names of the joined users in alphabetical order.
+func (s *storage) List() []string {
 	s.Lock()
 	defer s.Unlock()
 
-	delete(s.users, token)
+	users := make([]string, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+
+	return users
 }
@@ -2,6 +2,8 @@ package user
 
 import (
 	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/oklog/ulid/v2"
@@ -42,3 +44,80 @@ func TestUserStorage(t *testing.T) {
 
 	assert.Empty(t, s.Get(mockToken))
 }
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	s := New()
+	assert.Empty(t, s.List())
+
+	s.Set(ulid.Make(), "bob")
+	s.Set(ulid.Make(), "alice")
+
+	assert.Equal(t, []string{"alice", "bob"}, s.List())
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	t.Parallel()
+
+	s := New()
+	first, second := ulid.Make(), ulid.Make()
+
+	assert.True(t, s.SetIfAbsent(first, "user"))
+	assert.False(t, s.SetIfAbsent(second, "user"))
+	assert.Equal(t, "user", s.Get(first))
+	assert.Empty(t, s.Get(second))
+
+	s.Remove(first)
+	assert.True(t, s.SetIfAbsent(second, "user"))
+}
+
+func TestSetIfAbsentConcurrent(t *testing.T) {
+	t.Parallel()
+
+	s := New()
+
+	var wg sync.WaitGroup
+	var taken atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if s.SetIfAbsent(ulid.Make(), "user") {
+				taken.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), taken.Load())
+	assert.Equal(t, []string{"user"}, s.List())
+}
+
+type forgetter struct {
+	forgotten []string
+}
+
+func (f *forgetter) Forget(username string) {
+	f.forgotten = append(f.forgotten, username)
+}
+
+func TestForget(t *testing.T) {
+	t.Parallel()
+
+	f := &forgetter{}
+	s := New(f)
+
+	first, second := ulid.Make(), ulid.Make()
+	s.Set(first, "user")
+	s.Set(second, "user")
+
+	// The name is kept while another token has it.
+	s.Remove(first)
+	assert.Empty(t, f.forgotten)
+
+	s.Remove(second)
+	s.Remove(second)
+	assert.Equal(t, []string{"user"}, f.forgotten)
+}
@@ -0,0 +1,303 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exporter names of the configuration.
+const (
+	ExporterNone     = "none"
+	ExporterStdout   = "stdout"
+	ExporterOTLPFile = "otlp-file"
+	ExporterOTLPHTTP = "otlp-http"
+)
+
+// ServiceName is the service.name resource attribute of exported spans.
+const ServiceName = "gochat"
+
+// NewStdoutExporter writes every span as a JSON line, for reading traces without a collector.
+func NewStdoutExporter(w io.Writer) Exporter {
+	return &stdoutExporter{w: w}
+}
+
+type stdoutExporter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+type stdoutSpan struct {
+	Name         string         `json:"name"`
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Start        time.Time      `json:"start"`
+	Duration     string         `json:"duration"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+func (e *stdoutExporter) Export(_ context.Context, spans []SpanData) error {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	for _, span := range spans {
+		s := stdoutSpan{
+			Name:     span.Name,
+			TraceID:  span.TraceID.String(),
+			SpanID:   span.SpanID.String(),
+			Start:    span.Start.UTC(),
+			Duration: span.End.Sub(span.Start).String(),
+			Error:    span.Error,
+		}
+
+		if span.ParentSpanID.IsValid() {
+			s.ParentSpanID = span.ParentSpanID.String()
+		}
+
+		if len(span.Attributes) > 0 {
+			s.Attributes = map[string]any{}
+			for _, attr := range span.Attributes {
+				s.Attributes[attr.Key] = attributeValue(attr.Value)
+			}
+		}
+
+		if err := encoder.Encode(s); err != nil {
+			return err
+		}
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	_, err := e.w.Write(b.Bytes())
+
+	return err
+}
+
+func (e *stdoutExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// NewOTLPFileExporter appends every batch as an OTLP/JSON ExportTraceServiceRequest line to the
+// file, the format read by the collector's otlpjsonfile receiver.
+func NewOTLPFileExporter(path string) (Exporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &otlpFileExporter{f: f}, nil
+}
+
+type otlpFileExporter struct {
+	sync.Mutex
+	f *os.File
+}
+
+func (e *otlpFileExporter) Export(_ context.Context, spans []SpanData) error {
+	data, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	_, err = e.f.Write(append(data, '\n'))
+
+	return err
+}
+
+func (e *otlpFileExporter) Shutdown(context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+
+	return e.f.Close()
+}
+
+// NewOTLPHTTPExporter posts every batch as OTLP/JSON to the traces endpoint of a collector, such
+// as http://localhost:4318/v1/traces.
+func NewOTLPHTTPExporter(endpoint string, client *http.Client) Exporter {
+	return &otlpHTTPExporter{endpoint: endpoint, client: client}
+}
+
+type otlpHTTPExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (e *otlpHTTPExporter) Export(ctx context.Context, spans []SpanData) error {
+	data, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded %s", res.Status)
+	}
+
+	return nil
+}
+
+func (e *otlpHTTPExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// OTLP/JSON encoding of ExportTraceServiceRequest, with hex IDs and 64 bit integers as strings.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            *otlpStatus     `json:"status,omitempty"`
+	}
+
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// OTLP span kind and status code values.
+const (
+	otlpKindInternal = 1
+	otlpStatusError  = 2
+)
+
+func otlpRequest(spans []SpanData) otlpTraces {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			Name:              span.Name,
+			Kind:              otlpKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		}
+
+		if span.ParentSpanID.IsValid() {
+			s.ParentSpanID = span.ParentSpanID.String()
+		}
+
+		for _, attr := range span.Attributes {
+			s.Attributes = append(s.Attributes, otlpAttribute{Key: attr.Key, Value: otlpAttributeValue(attr.Value)})
+		}
+
+		if span.Error != "" {
+			s.Status = &otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+
+		converted = append(converted, s)
+	}
+
+	name := ServiceName
+
+	return otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: &name}}},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: ServiceName},
+				Spans: converted,
+			}},
+		}},
+	}
+}
+
+func otlpAttributeValue(v any) otlpValue {
+	switch v := attributeValue(v).(type) {
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &v}
+	default:
+		s := fmt.Sprint(v)
+
+		return otlpValue{StringValue: &s}
+	}
+}
+
+// attributeValue converts errors, stringers and durations to strings or numbers exporters can encode.
+func attributeValue(v any) any {
+	switch v := v.(type) {
+	case time.Duration:
+		return v.Seconds()
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
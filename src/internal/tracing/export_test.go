@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func spanData() []SpanData {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	parent, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	return []SpanData{{
+		Name:         "websocket.write",
+		TraceID:      parent.TraceID,
+		SpanID:       SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		ParentSpanID: parent.SpanID,
+		Start:        start,
+		End:          start.Add(time.Millisecond),
+		Attributes:   []Attribute{{"bytes", 42}, {"user", "john"}, {"ok", true}},
+		Error:        "failed",
+	}}
+}
+
+const otlpJSON = `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"gochat"}}]},` +
+	`"scopeSpans":[{"scope":{"name":"gochat"},"spans":[{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736",` +
+	`"spanId":"0102030405060708","parentSpanId":"00f067aa0ba902b7","name":"websocket.write","kind":1,` +
+	`"startTimeUnixNano":"1704164645000000000","endTimeUnixNano":"1704164645001000000",` +
+	`"attributes":[{"key":"bytes","value":{"intValue":"42"}},{"key":"user","value":{"stringValue":"john"}},` +
+	`{"key":"ok","value":{"boolValue":true}}],"status":{"code":2,"message":"failed"}}]}]}]}`
+
+func TestStdoutExporter(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	e := NewStdoutExporter(&out)
+
+	assert.NoError(t, e.Export(context.Background(), spanData()))
+	assert.Equal(t, `{"name":"websocket.write","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"0102030405060708",`+
+		`"parent_span_id":"00f067aa0ba902b7","start":"2024-01-02T03:04:05Z","duration":"1ms",`+
+		`"attributes":{"bytes":42,"ok":true,"user":"john"},"error":"failed"}`+"\n", out.String())
+}
+
+func TestOTLPFileExporter(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+	e, err := NewOTLPFileExporter(path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, e.Export(context.Background(), spanData()))
+	assert.NoError(t, e.Export(context.Background(), spanData()))
+	assert.NoError(t, e.Shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, otlpJSON+"\n"+otlpJSON+"\n", string(data))
+}
+
+func TestOTLPHTTPExporter(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer collector.Close()
+
+	e := NewOTLPHTTPExporter(collector.URL+"/v1/traces", collector.Client())
+	assert.NoError(t, e.Export(context.Background(), spanData()))
+	assert.JSONEq(t, otlpJSON, string(<-received))
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	e = NewOTLPHTTPExporter(failing.URL, failing.Client())
+	assert.ErrorContains(t, e.Export(context.Background(), spanData()), "503")
+}
+
+func TestOTLPDuration(t *testing.T) {
+	t.Parallel()
+
+	data, err := json.Marshal(otlpAttributeValue(1500 * time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"doubleValue":1.5}`, string(data))
+}
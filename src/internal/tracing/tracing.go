@@ -0,0 +1,388 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+)
+
+// Batching of finished spans before export.
+const (
+	QueueSize     = 2048
+	BatchSize     = 512
+	FlushInterval = time.Second
+)
+
+var (
+	spansExported = metrics.Default.Counter("gochat_spans_exported_total", "Spans handed to the trace exporter.")
+	spansDropped  = metrics.Default.Counter("gochat_spans_dropped_total", "Spans dropped because the export queue was full or the export failed.")
+)
+
+var ErrInvalidTraceParent = errors.New("invalid traceparent")
+
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext identifies a span across process and message boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// TraceParent formats the span context as a W3C traceparent header value, empty when invalid.
+func (sc SpanContext) TraceParent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceParent parses a W3C traceparent header value.
+func ParseTraceParent(value string) (SpanContext, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+
+	sc.Sampled = flags[0]&1 == 1
+
+	return sc, nil
+}
+
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanData is a finished span handed to exporters.
+type SpanData struct {
+	Name         string
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attribute
+	Error        string
+}
+
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// Span records a single operation. Spans of an untraced context are not recorded and all their
+// methods are no-ops.
+type Span struct {
+	mu       sync.Mutex
+	tracer   *service
+	data     SpanData
+	sampled  bool
+	finished bool
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return SpanContext{TraceID: s.data.TraceID, SpanID: s.data.SpanID, Sampled: s.sampled}
+}
+
+// TraceParent returns the traceparent of the span to propagate it, empty when it is not recorded.
+func (s *Span) TraceParent() string {
+	return s.Context().TraceParent()
+}
+
+// SetAttributes adds key/value pairs to the span.
+func (s *Span) SetAttributes(kv ...any) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Attributes = append(s.data.Attributes, attributes(kv)...)
+}
+
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Error = err.Error()
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+
+		return
+	}
+
+	s.finished = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.enqueue(data)
+}
+
+type contextKey struct{}
+
+// ContextWithSpanContext returns a context whose spans continue the trace of a remote span.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// SpanContextFromContext returns the context of the current span, or of the remote parent.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(contextKey{}).(SpanContext)
+
+	return sc
+}
+
+// TracingService starts spans and exports them in batches once an exporter is set.
+type TracingService interface {
+	Start(ctx context.Context, name string, kv ...any) (context.Context, *Span)
+	SetExporter(exporter Exporter)
+	Shutdown(ctx context.Context) error
+}
+
+// Default is the tracer the server is instrumented with, recording nothing until an exporter is set.
+var Default = New()
+
+// Start starts a span with the default tracer.
+func Start(ctx context.Context, name string, kv ...any) (context.Context, *Span) {
+	return Default.Start(ctx, name, kv...)
+}
+
+func New() TracingService {
+	return &service{}
+}
+
+type service struct {
+	sync.Mutex
+	exporter Exporter
+	queue    chan SpanData
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// Start starts a child span of the span in the context, or a new trace. Nothing is recorded
+// without an exporter or when the parent is not sampled.
+func (s *service) Start(ctx context.Context, name string, kv ...any) (context.Context, *Span) {
+	s.Lock()
+	enabled := s.exporter != nil
+	s.Unlock()
+
+	parent := SpanContextFromContext(ctx)
+	if !enabled || (parent.IsValid() && !parent.Sampled) {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer:  s,
+		sampled: true,
+		data: SpanData{
+			Name:         name,
+			TraceID:      parent.TraceID,
+			SpanID:       newSpanID(),
+			ParentSpanID: parent.SpanID,
+			Start:        time.Now(),
+			Attributes:   attributes(kv),
+		},
+	}
+
+	if !parent.IsValid() {
+		span.data.TraceID = newTraceID()
+	}
+
+	return context.WithValue(ctx, contextKey{}, span.Context()), span
+}
+
+// SetExporter starts exporting finished spans. It is meant to be called once on start.
+func (s *service) SetExporter(exporter Exporter) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.exporter = exporter
+	s.queue = make(chan SpanData, QueueSize)
+	s.stop = make(chan struct{})
+	s.stopped = make(chan struct{})
+
+	go s.run(exporter, s.queue, s.stop, s.stopped)
+}
+
+// Shutdown exports the queued spans and shuts the exporter down.
+func (s *service) Shutdown(ctx context.Context) error {
+	s.Lock()
+	exporter, stop, stopped := s.exporter, s.stop, s.stopped
+	s.exporter = nil
+	s.Unlock()
+
+	if exporter == nil {
+		return nil
+	}
+
+	close(stop)
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return exporter.Shutdown(ctx)
+}
+
+// enqueue drops spans when the queue is full rather than slowing the traced code down.
+func (s *service) enqueue(data SpanData) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.exporter == nil {
+		return
+	}
+
+	select {
+	case s.queue <- data:
+	default:
+		spansDropped.Inc()
+	}
+}
+
+func (s *service) run(exporter Exporter, queue <-chan SpanData, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+
+	batch := []SpanData{}
+	flush := func() {
+		if len(batch) < 1 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := exporter.Export(ctx, batch); err != nil {
+			logger.Default().Warn("error exporting spans", "spans", len(batch), "error", err)
+			spansDropped.Add(float64(len(batch)))
+		} else {
+			spansExported.Add(float64(len(batch)))
+		}
+
+		batch = []SpanData{}
+	}
+
+	for {
+		select {
+		case data := <-queue:
+			batch = append(batch, data)
+			if len(batch) >= BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-stop:
+			for {
+				select {
+				case data := <-queue:
+					batch = append(batch, data)
+				default:
+					flush()
+
+					return
+				}
+			}
+		}
+	}
+}
+
+func attributes(kv []any) []Attribute {
+	attrs := make([]Attribute, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		attrs = append(attrs, Attribute{Key: fmt.Sprint(kv[i]), Value: kv[i+1]})
+	}
+
+	return attrs
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+
+	return id
+}
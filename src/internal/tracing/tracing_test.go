@@ -0,0 +1,129 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type exporter struct {
+	sync.Mutex
+	spans    []SpanData
+	shutdown bool
+}
+
+func (e *exporter) Export(_ context.Context, spans []SpanData) error {
+	e.Lock()
+	defer e.Unlock()
+
+	e.spans = append(e.spans, spans...)
+
+	return nil
+}
+
+func (e *exporter) Shutdown(context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+
+	e.shutdown = true
+
+	return nil
+}
+
+func TestTraceParent(t *testing.T) {
+	t.Parallel()
+
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceParent(value)
+	assert.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, value, sc.TraceParent())
+
+	for _, invalid := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-xxf067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceParent(invalid)
+		assert.ErrorIs(t, err, ErrInvalidTraceParent, invalid)
+	}
+
+	assert.Empty(t, SpanContext{}.TraceParent())
+}
+
+func TestStartWithoutExporter(t *testing.T) {
+	t.Parallel()
+
+	s := New()
+
+	ctx, span := s.Start(context.Background(), "operation")
+	assert.Nil(t, span)
+	assert.Empty(t, span.TraceParent())
+	assert.False(t, SpanContextFromContext(ctx).IsValid())
+	assert.NotPanics(t, func() {
+		span.SetAttributes("key", "value")
+		span.RecordError(errors.New("failed"))
+		span.End()
+	})
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestSpans(t *testing.T) {
+	t.Parallel()
+
+	e := &exporter{}
+	s := New()
+	s.SetExporter(e)
+
+	ctx, parent := s.Start(context.Background(), "parent", "user", "john")
+	_, child := s.Start(ctx, "child")
+	child.RecordError(errors.New("failed"))
+	child.End()
+	child.End()
+	parent.SetAttributes("count", 2)
+	parent.End()
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.True(t, e.shutdown)
+	assert.Len(t, e.spans, 2)
+
+	assert.Equal(t, "child", e.spans[0].Name)
+	assert.Equal(t, "failed", e.spans[0].Error)
+	assert.Equal(t, parent.Context().TraceID, e.spans[0].TraceID)
+	assert.Equal(t, parent.Context().SpanID, e.spans[0].ParentSpanID)
+
+	assert.Equal(t, "parent", e.spans[1].Name)
+	assert.False(t, e.spans[1].ParentSpanID.IsValid())
+	assert.Equal(t, []Attribute{{"user", "john"}, {"count", 2}}, e.spans[1].Attributes)
+	assert.False(t, e.spans[1].End.Before(e.spans[1].Start))
+}
+
+func TestRemoteParent(t *testing.T) {
+	t.Parallel()
+
+	e := &exporter{}
+	s := New()
+	s.SetExporter(e)
+
+	remote, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, span := s.Start(ContextWithSpanContext(context.Background(), remote), "delivery")
+	span.End()
+
+	unsampled, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span = s.Start(ContextWithSpanContext(context.Background(), unsampled), "ignored")
+	assert.Nil(t, span)
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.Len(t, e.spans, 1)
+	assert.Equal(t, remote.TraceID, e.spans[0].TraceID)
+	assert.Equal(t, remote.SpanID, e.spans[0].ParentSpanID)
+}
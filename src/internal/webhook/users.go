@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"github.com/oklog/ulid/v2"
+
+	"gochat/internal/storage/inmemory/user"
+)
+
+// Users wraps the user storage to publish user.joined events as users join and user.left events as
+// they leave, whichever transport they use.
+func Users(userStorage user.UserStorage, webhookService WebhookService) user.UserStorage {
+	return users{
+		UserStorage:    userStorage,
+		webhookService: webhookService,
+	}
+}
+
+type users struct {
+	user.UserStorage
+	webhookService WebhookService
+}
+
+func (u users) Set(token ulid.ULID, username string) {
+	u.UserStorage.Set(token, username)
+	u.webhookService.Publish(Event{Type: EventUserJoined, User: username})
+}
+
+func (u users) SetIfAbsent(token ulid.ULID, username string) bool {
+	if !u.UserStorage.SetIfAbsent(token, username) {
+		return false
+	}
+
+	u.webhookService.Publish(Event{Type: EventUserJoined, User: username})
+
+	return true
+}
+
+func (u users) Remove(token ulid.ULID) {
+	username := u.UserStorage.Get(token)
+	u.UserStorage.Remove(token)
+
+	if len(username) > 0 {
+		u.webhookService.Publish(Event{Type: EventUserLeft, User: username})
+	}
+}
@@ -0,0 +1,691 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"gochat/internal/chat"
+	"gochat/internal/jsonfile"
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+)
+
+var (
+	ErrNotFound     = errors.New("webhook not found")
+	ErrInvalidURL   = errors.New("invalid webhook URL")
+	ErrInvalidEvent = errors.New("invalid webhook event")
+)
+
+const (
+	EventMessagePosted  = "message.posted"
+	EventMessageDeleted = "message.deleted"
+	EventUserJoined     = "user.joined"
+	EventUserLeft       = "user.left"
+)
+
+// Events are the event types webhooks can be registered for.
+var Events = []string{EventMessagePosted, EventMessageDeleted, EventUserJoined, EventUserLeft}
+
+const (
+	HeaderEvent    = "X-GoChat-Event"
+	HeaderDelivery = "X-GoChat-Delivery"
+
+	// HeaderSignature carries "sha256=" followed by the hex HMAC-SHA256 of the body keyed with the
+	// webhook secret.
+	HeaderSignature = "X-GoChat-Signature"
+)
+
+const (
+	// MaxAttempts is the number of failed attempts after which a delivery is dead-lettered.
+	MaxAttempts = 10
+
+	// Timeout is how long a receiver has to respond to a delivery.
+	Timeout = 10 * time.Second
+
+	// MinBackoff is the delay before the first retry, doubled on every further one up to MaxBackoff.
+	MinBackoff = time.Second
+	MaxBackoff = 10 * time.Minute
+
+	// MaxBacklog is the number of deliveries queued for a webhook from which a failed delivery is
+	// dead-lettered without retrying, so a dead receiver does not hold up its webhook for hours.
+	MaxBacklog = 100
+
+	// MaxQueued caps the deliveries waiting to be sent, further ones being dropped.
+	MaxQueued = 10000
+
+	// SaveInterval is how often changes of the queue are written to the queue file.
+	SaveInterval = time.Second
+)
+
+var (
+	deliveries  = metrics.Default.Counter("gochat_webhook_deliveries_total", "Webhook delivery attempts by result: success, retry or dead.", "result")
+	queueDepth  = metrics.Default.Gauge("gochat_webhook_queue_depth", "Webhook deliveries waiting to be sent.")
+	dropped     = metrics.Default.Counter("gochat_webhook_dropped_total", "Webhook deliveries dropped because the queue was full.")
+	persistErrs = metrics.Default.Counter("gochat_webhook_persist_errors_total", "Failed writes of the webhook queue or dead-letter log.")
+)
+
+type Hook struct {
+	ID        ulid.ULID
+	URL       string
+	Events    []string
+	Secret    string
+	CreatedAt time.Time
+}
+
+// Event is the JSON body posted to webhooks, carrying the message of message events and the user
+// of user events.
+type Event struct {
+	ID      ulid.ULID
+	Type    string
+	Time    time.Time
+	Message *Message `json:",omitempty"`
+	User    string   `json:",omitempty"`
+}
+
+type Message struct {
+	ID     ulid.ULID
+	Author string
+	Value  string `json:",omitempty"`
+}
+
+// Delivery is an event queued for a webhook. It is sent to the URL of the webhook signed with its
+// secret, so the secret is never written to the queue file or dead-letter log.
+type Delivery struct {
+	ID       ulid.ULID
+	Hook     ulid.ULID
+	Event    string
+	Payload  json.RawMessage
+	Attempts int
+	Next     time.Time
+	Error    string `json:",omitempty"`
+}
+
+// WebhookService posts chat events to the registered webhooks. Deliveries are queued up to
+// MaxQueued, saved to the queue file when set every SaveInterval, and retried with exponential
+// backoff until MaxAttempts, after which they are appended to the dead-letter log.
+type WebhookService interface {
+	Add(url string, events []string, secret string) (Hook, error)
+	Remove(id ulid.ULID) error
+	List() []Hook
+	Publish(event Event)
+	Queued() int
+	Run(ctx context.Context)
+
+	// Flush writes the pending changes of the queue to the queue file.
+	Flush()
+}
+
+// New loads the webhooks of the hooks file and the deliveries left in the queue file, dropping the
+// deliveries of webhooks that are not registered anymore. Empty file names keep the webhooks and
+// the queue in memory and only log dead letters.
+func New(chatService chat.ChatService, hooksFile, queueFile, deadLetterFile string) (WebhookService, error) {
+	s := &service{
+		chatService:    chatService,
+		client:         &http.Client{Timeout: Timeout},
+		hooksFile:      hooksFile,
+		queueFile:      queueFile,
+		deadLetterFile: deadLetterFile,
+		hooks:          []Hook{},
+		queue:          []Delivery{},
+		inFlight:       map[ulid.ULID]bool{},
+		wake:           make(chan struct{}, 1),
+		minBackoff:     MinBackoff,
+		maxBackoff:     MaxBackoff,
+		maxQueued:      MaxQueued,
+		maxBacklog:     MaxBacklog,
+	}
+
+	if err := jsonfile.Read(hooksFile, &s.hooks); err != nil {
+		return nil, err
+	}
+
+	queue := []Delivery{}
+	if err := jsonfile.Read(queueFile, &queue); err != nil {
+		return nil, err
+	}
+
+	for _, d := range queue {
+		if s.hook(d.Hook) < 0 {
+			continue
+		}
+
+		s.queue = append(s.queue, d)
+	}
+
+	if orphaned := len(queue) - len(s.queue); orphaned > 0 {
+		logger.Default().Warn("dropping deliveries of unknown webhooks", "file", queueFile, "deliveries", orphaned)
+		s.dirty = true
+	}
+
+	queueDepth.Set(float64(len(s.queue)))
+
+	return s, nil
+}
+
+type service struct {
+	sync.Mutex
+	chatService    chat.ChatService
+	client         *http.Client
+	hooksFile      string
+	queueFile      string
+	deadLetterFile string
+	hooks          []Hook
+	queue          []Delivery
+	inFlight       map[ulid.ULID]bool
+	wake           chan struct{}
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	maxQueued      int
+	maxBacklog     int
+
+	// dirty is set when the queue changed since it was last written to the queue file.
+	dirty bool
+
+	// saving serializes writes of the queue file, which happen outside the lock.
+	saving sync.Mutex
+}
+
+// Add registers a webhook for the events, generating a secret when none is given.
+func (s *service) Add(rawURL string, events []string, secret string) (Hook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) < 1 {
+		return Hook{}, ErrInvalidURL
+	}
+
+	if len(events) < 1 {
+		return Hook{}, ErrInvalidEvent
+	}
+
+	for _, e := range events {
+		if !contains(Events, e) {
+			return Hook{}, ErrInvalidEvent
+		}
+	}
+
+	if len(secret) < 1 {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return Hook{}, err
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	h := Hook{
+		ID:        ulid.Make(),
+		URL:       u.String(),
+		Events:    append([]string{}, events...),
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	hooks := append(append([]Hook{}, s.hooks...), h)
+	if err := s.saveHooks(hooks); err != nil {
+		return Hook{}, err
+	}
+	s.hooks = hooks
+
+	return h, nil
+}
+
+// Remove unregisters the webhook, dropping its queued deliveries.
+func (s *service) Remove(id ulid.ULID) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for i, h := range s.hooks {
+		if h.ID != id {
+			continue
+		}
+
+		hooks := append(append([]Hook{}, s.hooks[:i]...), s.hooks[i+1:]...)
+		if err := s.saveHooks(hooks); err != nil {
+			return err
+		}
+		s.hooks = hooks
+
+		queue := s.queue[:0]
+		for _, d := range s.queue {
+			if d.Hook != id {
+				queue = append(queue, d)
+			}
+		}
+		s.queue = queue
+		s.changed()
+
+		return nil
+	}
+
+	return ErrNotFound
+}
+
+// List returns the registered webhooks in registration order.
+func (s *service) List() []Hook {
+	s.Lock()
+	defer s.Unlock()
+
+	hooks := make([]Hook, 0, len(s.hooks))
+	for _, h := range s.hooks {
+		h.Events = append([]string{}, h.Events...)
+		hooks = append(hooks, h)
+	}
+
+	return hooks
+}
+
+// Publish queues the event for the webhooks registered for its type.
+func (s *service) Publish(event Event) {
+	var zero ulid.ULID
+	if event.ID == zero {
+		event.ID = ulid.Make()
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Default().Error("error encoding webhook event", "event", event.Type, "error", err)
+
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	queued := false
+	for _, h := range s.hooks {
+		if !contains(h.Events, event.Type) {
+			continue
+		}
+
+		if len(s.queue) >= s.maxQueued {
+			dropped.Inc()
+			logger.Default().Warn("webhook queue full, dropping delivery", "webhook_id", h.ID, "event", event.Type)
+
+			continue
+		}
+
+		s.queue = append(s.queue, Delivery{
+			ID:      ulid.Make(),
+			Hook:    h.ID,
+			Event:   event.Type,
+			Payload: payload,
+			Next:    time.Now(),
+		})
+		queued = true
+	}
+
+	if !queued {
+		return
+	}
+
+	s.changed()
+	s.notify()
+}
+
+// Queued returns the number of deliveries waiting to be sent.
+func (s *service) Queued() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.queue)
+}
+
+// Run publishes the message events of the chat and sends the queued deliveries until the context
+// is done, saving the queue every SaveInterval. Deliveries cut short by it stay queued.
+func (s *service) Run(ctx context.Context) {
+	messages := s.chatService.Subscribe(ctx, chat.ChatAPIName)
+	go func() {
+		for msg := range messages {
+			s.observe(msg)
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(SaveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Flush()
+			}
+		}
+	}()
+
+	for {
+		due, wait := s.due(time.Now())
+		for _, d := range due {
+			go s.attempt(ctx, d)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// observe turns the stored and deleted messages of the chat into events. Messages of the chat
+// itself are skipped, as the join and leave announcements are published as user events.
+func (s *service) observe(msg chat.Message) {
+	if msg.Author == chat.ChatAPIName {
+		return
+	}
+
+	switch msg.Type {
+	case chat.TypeMessage:
+		var zero ulid.ULID
+		if msg.ID == zero {
+			return
+		}
+
+		s.Publish(Event{
+			Type:    EventMessagePosted,
+			Message: &Message{ID: msg.ID, Author: msg.Author, Value: msg.Message},
+		})
+	case chat.TypeDelete:
+		s.Publish(Event{
+			Type:    EventMessageDeleted,
+			Message: &Message{ID: msg.ID, Author: msg.Author},
+		})
+	}
+}
+
+// due returns the deliveries to send now and how long to wait for the next one otherwise. The
+// deliveries of a webhook are sent one at a time in order, so only the first one of every webhook
+// without a delivery in flight is considered, and marked in flight. Once MaxBacklog deliveries are
+// queued for a webhook its failed deliveries are dead-lettered at once, so the backlog drains.
+func (s *service) due(now time.Time) ([]Delivery, time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	due := []Delivery{}
+	wait := s.maxBackoff
+	seen := map[ulid.ULID]bool{}
+	for _, d := range s.queue {
+		if seen[d.Hook] || s.inFlight[d.Hook] {
+			seen[d.Hook] = true
+
+			continue
+		}
+		seen[d.Hook] = true
+
+		if !d.Next.After(now) {
+			due = append(due, d)
+			s.inFlight[d.Hook] = true
+		} else if next := d.Next.Sub(now); next < wait {
+			wait = next
+		}
+	}
+
+	return due, wait
+}
+
+func (s *service) attempt(ctx context.Context, d Delivery) {
+	s.Lock()
+	j := s.hook(d.Hook)
+	var h Hook
+	if j >= 0 {
+		h = s.hooks[j]
+	}
+	s.Unlock()
+
+	var err error
+	if j >= 0 {
+		err = s.send(ctx, h, d)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.inFlight, d.Hook)
+	s.notify()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	i := s.find(d.ID)
+	if j < 0 || i < 0 {
+		// The webhook was removed meanwhile.
+		return
+	}
+
+	log := logger.Default().With("webhook_id", d.Hook, "delivery_id", d.ID, "event", d.Event)
+
+	switch {
+	case err == nil:
+		deliveries.Inc("success")
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+	case d.Attempts+1 >= MaxAttempts || s.backlog(d.Hook) >= s.maxBacklog:
+		deliveries.Inc("dead")
+		log.Warn("webhook delivery failed, giving up", "attempts", d.Attempts+1, "backlog", s.backlog(d.Hook), "error", err)
+
+		d.Attempts++
+		d.Error = err.Error()
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+		s.deadLetter(d)
+	default:
+		deliveries.Inc("retry")
+		log.Info("webhook delivery failed, retrying", "attempts", d.Attempts+1, "error", err)
+
+		d.Attempts++
+		d.Error = err.Error()
+		d.Next = time.Now().Add(s.backoff(d.Attempts))
+		s.queue[i] = d
+	}
+
+	s.changed()
+}
+
+// backoff returns the delay before the retry following the given number of failed attempts.
+func (s *service) backoff(attempts int) time.Duration {
+	delay := s.minBackoff
+	for i := 1; i < attempts && delay < s.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > s.maxBackoff {
+		return s.maxBackoff
+	}
+
+	return delay
+}
+
+func (s *service) send(ctx context.Context, h Hook, d Delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GoChat-Webhook")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, d.ID.String())
+	req.Header.Set(HeaderSignature, Sign(h.Secret, d.Payload))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("receiver responded %s", res.Status)
+	}
+
+	return nil
+}
+
+// notify wakes Run up to send the deliveries that became due.
+func (s *service) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// backlog returns the number of deliveries queued for the webhook.
+func (s *service) backlog(hook ulid.ULID) int {
+	n := 0
+	for _, d := range s.queue {
+		if d.Hook == hook {
+			n++
+		}
+	}
+
+	return n
+}
+
+// hook returns the index of the webhook, -1 when it is not registered.
+func (s *service) hook(id ulid.ULID) int {
+	for i := range s.hooks {
+		if s.hooks[i].ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *service) find(id ulid.ULID) int {
+	for i := range s.queue {
+		if s.queue[i].ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// changed records a change of the queue, to be written by the next flush.
+func (s *service) changed() {
+	queueDepth.Set(float64(len(s.queue)))
+	s.dirty = true
+}
+
+// Flush replaces the queue file with a copy of the queue taken under the lock, renaming a complete
+// copy over it, so publishing never waits on the disk.
+func (s *service) Flush() {
+	if len(s.queueFile) < 1 {
+		return
+	}
+
+	s.saving.Lock()
+	defer s.saving.Unlock()
+
+	s.Lock()
+	if !s.dirty {
+		s.Unlock()
+
+		return
+	}
+	queue := append([]Delivery{}, s.queue...)
+	s.dirty = false
+	s.Unlock()
+
+	if err := jsonfile.Write(s.queueFile, queue); err != nil {
+		persistErrs.Inc()
+		logger.Default().Error("error saving webhook queue", "file", s.queueFile, "error", err)
+
+		// The queue is written again by the next flush.
+		s.Lock()
+		s.dirty = true
+		s.Unlock()
+	}
+}
+
+// saveHooks replaces the hooks file with the webhooks.
+func (s *service) saveHooks(hooks []Hook) error {
+	if len(s.hooksFile) < 1 {
+		return nil
+	}
+
+	if err := jsonfile.Write(s.hooksFile, hooks); err != nil {
+		persistErrs.Inc()
+
+		return fmt.Errorf("error saving webhooks: %w", err)
+	}
+
+	return nil
+}
+
+// deadLetter appends the delivery to the dead-letter log.
+func (s *service) deadLetter(d Delivery) {
+	if len(s.deadLetterFile) < 1 {
+		return
+	}
+
+	line, err := json.Marshal(d)
+	if err == nil {
+		err = appendLine(s.deadLetterFile, line)
+	}
+
+	if err != nil {
+		persistErrs.Inc()
+		logger.Default().Error("error writing webhook dead letter", "file", s.deadLetterFile, "delivery_id", d.ID, "error", err)
+	}
+}
+
+func appendLine(name string, line []byte) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+// Sign returns the signature header value of the payload, for receivers to check it was sent by
+// the server knowing the secret.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,370 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"gochat/internal/chat"
+	"gochat/internal/storage/inmemory/user"
+)
+
+// receiver records the deliveries it gets, failing the first ones.
+type receiver struct {
+	sync.Mutex
+	server   *httptest.Server
+	failures int
+	requests []*http.Request
+	events   []Event
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, failures int) *receiver {
+	r := &receiver{failures: failures}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.Lock()
+		defer r.Unlock()
+
+		if r.failures != 0 {
+			r.failures--
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		var e Event
+		json.Unmarshal(body, &e)
+
+		r.requests = append(r.requests, req)
+		r.events = append(r.events, e)
+		r.bodies = append(r.bodies, body)
+	}))
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+func (r *receiver) received() []Event {
+	r.Lock()
+	defer r.Unlock()
+
+	return append([]Event{}, r.events...)
+}
+
+// run starts the service with fast retries.
+func run(t *testing.T, s WebhookService) {
+	s.(*service).minBackoff = time.Millisecond
+	s.(*service).maxBackoff = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go s.Run(ctx)
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	s, err := New(chat.New(chat.DefaultHistorySize), "", "", "")
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+
+	_, err = New(chat.New(chat.DefaultHistorySize), "", t.TempDir(), "")
+	assert.Error(t, err)
+}
+
+func TestAdd(t *testing.T) {
+	t.Parallel()
+
+	s, _ := New(chat.New(chat.DefaultHistorySize), "", "", "")
+
+	h, err := s.Add("https://example.com/hook", []string{EventMessagePosted}, "")
+	assert.NoError(t, err)
+	assert.Len(t, h.Secret, 64)
+
+	_, err = s.Add("ftp://example.com/hook", []string{EventMessagePosted}, "")
+	assert.Equal(t, ErrInvalidURL, err)
+
+	_, err = s.Add("/hook", []string{EventMessagePosted}, "")
+	assert.Equal(t, ErrInvalidURL, err)
+
+	_, err = s.Add("https://example.com/hook", []string{}, "")
+	assert.Equal(t, ErrInvalidEvent, err)
+
+	_, err = s.Add("https://example.com/hook", []string{"message.edited"}, "")
+	assert.Equal(t, ErrInvalidEvent, err)
+
+	assert.Equal(t, []Hook{h}, s.List())
+
+	assert.NoError(t, s.Remove(h.ID))
+	assert.Equal(t, ErrNotFound, s.Remove(h.ID))
+	assert.Empty(t, s.List())
+}
+
+func TestDelivery(t *testing.T) {
+	t.Parallel()
+
+	r := newReceiver(t, 0)
+	chatService := chat.New(chat.DefaultHistorySize)
+	s, _ := New(chatService, "", "", "")
+
+	h, _ := s.Add(r.server.URL, []string{EventMessagePosted, EventMessageDeleted}, "secret")
+	s.Add(r.server.URL, []string{EventUserJoined}, "")
+	run(t, s)
+
+	// Wait for the chat subscription.
+	assert.Eventually(t, func() bool {
+		_, ok := chatService.Queued()[chat.ChatAPIName]
+
+		return ok
+	}, time.Second, time.Millisecond)
+
+	// Announcements are not messages of users.
+	chatService.PostMessage(chat.Message{Author: chat.ChatAPIName, Message: "user has joined the chat!"})
+
+	posted := chatService.PostMessage(chat.Message{Author: "user", Message: "hello"})
+	chatService.PostMessage(chat.Message{Type: chat.TypeMention, Author: "user", Message: "hi", Recipient: chat.ChatAPIName})
+	assert.NoError(t, chatService.Delete(posted.ID))
+
+	assert.Eventually(t, func() bool {
+		return len(r.received()) == 2
+	}, 5*time.Second, time.Millisecond)
+
+	events := r.received()
+	assert.Equal(t, EventMessagePosted, events[0].Type)
+	assert.Equal(t, &Message{ID: posted.ID, Author: "user", Value: "hello"}, events[0].Message)
+	assert.Equal(t, EventMessageDeleted, events[1].Type)
+	assert.Equal(t, &Message{ID: posted.ID, Author: "user"}, events[1].Message)
+
+	r.Lock()
+	defer r.Unlock()
+
+	req := r.requests[0]
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, EventMessagePosted, req.Header.Get(HeaderEvent))
+	assert.Equal(t, Sign(h.Secret, r.bodies[0]), req.Header.Get(HeaderSignature))
+	assert.True(t, strings.HasPrefix(req.Header.Get(HeaderSignature), "sha256="))
+	assert.NotEqual(t, req.Header.Get(HeaderDelivery), r.requests[1].Header.Get(HeaderDelivery))
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	r := newReceiver(t, 3)
+	s, _ := New(chat.New(chat.DefaultHistorySize), "", "", "")
+	s.Add(r.server.URL, []string{EventUserJoined}, "")
+	run(t, s)
+
+	s.Publish(Event{Type: EventUserJoined, User: "user"})
+
+	assert.Eventually(t, func() bool {
+		return len(r.received()) == 1
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, "user", r.received()[0].User)
+
+	assert.Eventually(t, func() bool {
+		return s.Queued() == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	s := &service{minBackoff: MinBackoff, maxBackoff: MaxBackoff}
+
+	assert.Equal(t, time.Second, s.backoff(1))
+	assert.Equal(t, 2*time.Second, s.backoff(2))
+	assert.Equal(t, 8*time.Second, s.backoff(4))
+	assert.Equal(t, MaxBackoff, s.backoff(20))
+}
+
+func TestDeadLetter(t *testing.T) {
+	t.Parallel()
+
+	deadLetterFile := filepath.Join(t.TempDir(), "dead-letter.log")
+
+	r := newReceiver(t, -1)
+	s, _ := New(chat.New(chat.DefaultHistorySize), "", "", deadLetterFile)
+	s.Add(r.server.URL, []string{EventUserLeft}, "secret")
+	run(t, s)
+
+	s.Publish(Event{Type: EventUserLeft, User: "user"})
+
+	assert.Eventually(t, func() bool {
+		return s.Queued() == 0
+	}, 5*time.Second, time.Millisecond)
+
+	data, err := os.ReadFile(deadLetterFile)
+	assert.NoError(t, err)
+
+	var d Delivery
+	assert.NoError(t, json.Unmarshal(data, &d))
+	assert.Equal(t, MaxAttempts, d.Attempts)
+	assert.Equal(t, EventUserLeft, d.Event)
+	assert.Equal(t, "receiver responded 500 Internal Server Error", d.Error)
+	assert.NotContains(t, string(data), "secret")
+}
+
+func TestBacklog(t *testing.T) {
+	t.Parallel()
+
+	deadLetterFile := filepath.Join(t.TempDir(), "dead-letter.log")
+
+	r := newReceiver(t, -1)
+	s, _ := New(chat.New(chat.DefaultHistorySize), "", "", deadLetterFile)
+	s.(*service).maxBacklog = 2
+	s.Add(r.server.URL, []string{EventUserJoined}, "")
+
+	for i := 0; i < 3; i++ {
+		s.Publish(Event{Type: EventUserJoined, User: "user"})
+	}
+	run(t, s)
+
+	// Deliveries of a backed up webhook fail once only, until the backlog is below the limit.
+	assert.Eventually(t, func() bool {
+		return s.Queued() == 0
+	}, 5*time.Second, time.Millisecond)
+
+	data, err := os.ReadFile(deadLetterFile)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 3)
+
+	attempts := []int{}
+	for _, line := range lines {
+		var d Delivery
+		assert.NoError(t, json.Unmarshal([]byte(line), &d))
+		attempts = append(attempts, d.Attempts)
+	}
+	assert.Equal(t, []int{1, 1, MaxAttempts}, attempts)
+}
+
+func TestQueueFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	hooksFile := filepath.Join(dir, "hooks.json")
+	queueFile := filepath.Join(dir, "queue.json")
+	r := newReceiver(t, 0)
+
+	s, err := New(chat.New(chat.DefaultHistorySize), hooksFile, queueFile, "")
+	assert.NoError(t, err)
+	h, _ := s.Add(r.server.URL, []string{EventUserJoined}, "secret")
+	s.Publish(Event{Type: EventUserJoined, User: "user"})
+	assert.Equal(t, 1, s.Queued())
+	s.Flush()
+
+	// Secrets are kept in the hooks file only.
+	data, err := os.ReadFile(queueFile)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+
+	// Deliveries of webhooks that are not registered anymore are dropped.
+	orphaned, err := New(chat.New(chat.DefaultHistorySize), "", queueFile, "")
+	assert.NoError(t, err)
+	assert.Zero(t, orphaned.Queued())
+
+	// Webhooks and deliveries queued before a restart are sent after it.
+	restarted, err := New(chat.New(chat.DefaultHistorySize), hooksFile, queueFile, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []Hook{h}, restarted.List())
+	assert.Equal(t, 1, restarted.Queued())
+	run(t, restarted)
+
+	assert.Eventually(t, func() bool {
+		return len(r.received()) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	r.Lock()
+	assert.Equal(t, Sign("secret", r.bodies[0]), r.requests[0].Header.Get(HeaderSignature))
+	r.Unlock()
+
+	assert.Eventually(t, func() bool {
+		data, _ := os.ReadFile(queueFile)
+
+		return string(data) == "[]"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, restarted.Remove(h.ID))
+
+	restarted, err = New(chat.New(chat.DefaultHistorySize), hooksFile, queueFile, "")
+	assert.NoError(t, err)
+	assert.Empty(t, restarted.List())
+}
+
+func TestMaxQueued(t *testing.T) {
+	t.Parallel()
+
+	s, _ := New(chat.New(chat.DefaultHistorySize), "", "", "")
+	s.(*service).maxQueued = 2
+	s.Add("http://127.0.0.1:1/hook", []string{EventUserJoined}, "")
+
+	before := dropped.Value()
+	for i := 0; i < 3; i++ {
+		s.Publish(Event{Type: EventUserJoined, User: "user"})
+	}
+
+	assert.Equal(t, 2, s.Queued())
+	assert.Equal(t, before+1, dropped.Value())
+}
+
+func TestRemove(t *testing.T) {
+	t.Parallel()
+
+	s, _ := New(chat.New(chat.DefaultHistorySize), "", "", "")
+	h, _ := s.Add("http://127.0.0.1:1/hook", []string{EventUserJoined}, "")
+	other, _ := s.Add("http://127.0.0.1:1/other", []string{EventUserJoined}, "")
+
+	s.Publish(Event{Type: EventUserJoined, User: "user"})
+	s.Publish(Event{Type: EventUserLeft, User: "user"})
+	assert.Equal(t, 2, s.Queued())
+
+	assert.NoError(t, s.Remove(h.ID))
+	assert.Equal(t, 1, s.Queued())
+	assert.Equal(t, []Hook{other}, s.List())
+}
+
+func TestUsers(t *testing.T) {
+	t.Parallel()
+
+	s, _ := New(chat.New(chat.DefaultHistorySize), "", "", "")
+	s.Add("http://127.0.0.1:1/hook", []string{EventUserJoined, EventUserLeft}, "")
+
+	userStorage := Users(user.New(), s)
+	token := ulid.Make()
+
+	userStorage.Set(token, "user")
+	assert.Equal(t, "user", userStorage.Get(token))
+	assert.Equal(t, 1, s.Queued())
+
+	// A name already taken joins nobody.
+	assert.False(t, userStorage.SetIfAbsent(ulid.Make(), "user"))
+	assert.Equal(t, 1, s.Queued())
+
+	userStorage.Remove(token)
+	userStorage.Remove(token)
+	assert.Empty(t, userStorage.Get(token))
+	assert.Equal(t, 2, s.Queued())
+
+	assert.True(t, userStorage.SetIfAbsent(token, "user"))
+	assert.Equal(t, 3, s.Queued())
+
+	var e Event
+	json.Unmarshal(s.(*service).queue[1].Payload, &e)
+	assert.Equal(t, EventUserLeft, e.Type)
+	assert.Equal(t, "user", e.User)
+}
@@ -1,38 +1,382 @@
 package connection
 
 import (
-	"log"
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/oklog/ulid/v2"
 	"nhooyr.io/websocket"
+
+	"gochat/internal/logger"
+	"gochat/internal/metrics"
+)
+
+var (
+	ErrNotFound    = errors.New("connection not found")
+	ErrServerLimit = errors.New("too many connections")
+	ErrUserLimit   = errors.New("too many connections of user")
+	ErrIPLimit     = errors.New("too many connections from address")
+)
+
+var (
+	activeConnections   = metrics.Default.Gauge("gochat_connections", "Active websocket connections.", "endpoint")
+	rejectedConnections = metrics.Default.Counter("gochat_connections_rejected_total", "Connections rejected over a limit.", "limit")
+	evictedConnections  = metrics.Default.Counter("gochat_connections_evicted_total", "Connections closed after lowering the limits.")
+)
+
+// Default connection limits.
+const (
+	DefaultMaxConnections        = 10000
+	DefaultMaxConnectionsPerUser = 10
+	DefaultMaxConnectionsPerIP   = 100
 )
 
+// Limits on concurrent connections, zero means unlimited.
+type Limits struct {
+	Total   int
+	PerUser int
+	PerIP   int
+}
+
 type Connection interface {
 	Close(code websocket.StatusCode, reason string) error
 }
 
+// Session describes a registered connection.
+type Session struct {
+	ID          ulid.ULID
+	Endpoint    string
+	User        string
+	RemoteAddr  string
+	ConnectedAt time.Time
+	Messages    int64
+	Bytes       int64
+}
+
 type ConnectionService interface {
-	Add(conn Connection)
-	Close()
+	Add(ctx context.Context, endpoint, user, remoteAddr string) (ulid.ULID, error)
+	Attach(id ulid.ULID, conn Connection)
+	Remove(id ulid.ULID)
+	Record(id ulid.ULID, bytes int)
+	Get(id ulid.ULID) (Session, error)
+	List() []Session
+	ByUser(user string) []Session
+	Disconnect(id ulid.ULID, code websocket.StatusCode, reason string) error
+	SetLimits(limits Limits)
+	Wait(ctx context.Context) error
+	Close(endpoints ...string)
 }
 
-func New() ConnectionService {
+func New(limits Limits) ConnectionService {
 	return &service{
-		connections: []Connection{},
+		connections: map[ulid.ULID]*entry{},
+		limits:      limits,
 	}
 }
 
+type entry struct {
+	conn    Connection
+	session Session
+	log     *logger.Logger
+}
+
 type service struct {
-	connections []Connection
+	sync.Mutex
+	connections map[ulid.ULID]*entry
+	limits      Limits
+}
+
+// Add registers a new session if it fits into the limits. The connection itself is attached once
+// it is accepted, so the limits are enforced before upgrading the request. The session is logged
+// with the logger of the context.
+func (s *service) Add(ctx context.Context, endpoint, user, remoteAddr string) (ulid.ULID, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	log := logger.FromContext(ctx).With("endpoint", endpoint, "user", user, "remote_addr", remoteAddr)
+
+	if err := s.allow(user, host(remoteAddr)); err != nil {
+		rejectedConnections.Inc(limitName(err))
+		log.Warn("connection rejected", "error", err)
+
+		return ulid.ULID{}, err
+	}
+
+	id := ulid.Make()
+	log = log.With("conn_id", id)
+	log.Debug("connection registered")
+
+	s.connections[id] = &entry{
+		log: log,
+		session: Session{
+			ID:          id,
+			Endpoint:    endpoint,
+			User:        user,
+			RemoteAddr:  remoteAddr,
+			ConnectedAt: time.Now(),
+		},
+	}
+
+	activeConnections.Inc(endpoint)
+
+	return id, nil
+}
+
+func (s *service) Attach(id ulid.ULID, conn Connection) {
+	s.Lock()
+	defer s.Unlock()
+
+	if e, ok := s.connections[id]; ok {
+		e.conn = conn
+	}
+}
+
+func (s *service) Remove(id ulid.ULID) {
+	s.Lock()
+	defer s.Unlock()
+
+	if e, ok := s.connections[id]; ok {
+		activeConnections.Dec(e.session.Endpoint)
+		delete(s.connections, id)
+
+		e.log.Debug("connection removed", "messages", e.session.Messages, "bytes", e.session.Bytes)
+	}
+}
+
+// Record counts a single message of the given size sent or received over the connection.
+func (s *service) Record(id ulid.ULID, bytes int) {
+	s.Lock()
+	defer s.Unlock()
+
+	if e, ok := s.connections[id]; ok {
+		e.session.Messages++
+		e.session.Bytes += int64(bytes)
+	}
+}
+
+func (s *service) Get(id ulid.ULID) (Session, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.connections[id]
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+
+	return e.session, nil
+}
+
+// List returns all sessions ordered by connect time.
+func (s *service) List() []Session {
+	return s.filter(func(Session) bool {
+		return true
+	})
+}
+
+func (s *service) ByUser(user string) []Session {
+	return s.filter(func(session Session) bool {
+		return session.User == user
+	})
+}
+
+// Disconnect closes the connection with the given status. The connection is removed by its handler.
+func (s *service) Disconnect(id ulid.ULID, code websocket.StatusCode, reason string) error {
+	s.Lock()
+	e, ok := s.connections[id]
+	s.Unlock()
+
+	if !ok || e.conn == nil {
+		return ErrNotFound
+	}
+
+	e.log.Info("disconnecting connection", "code", int(code), "reason", reason)
+
+	return e.conn.Close(code, reason)
+}
+
+// SetLimits changes the limits, evicting the oldest sessions that do not fit into the new ones.
+func (s *service) SetLimits(limits Limits) {
+	s.Lock()
+	s.limits = limits
+
+	sessions := s.sorted(func(Session) bool {
+		return true
+	})
+
+	kept := newUsage()
+	evicted := []*entry{}
+	for i := len(sessions) - 1; i >= 0; i-- {
+		session := sessions[i]
+		ip := host(session.RemoteAddr)
+
+		e := s.connections[session.ID]
+		if e.conn != nil && s.exceeds(kept, session.User, ip) != nil {
+			evicted = append(evicted, e)
+
+			continue
+		}
+
+		kept.add(session.User, ip)
+	}
+	s.Unlock()
+
+	evictedConnections.Add(float64(len(evicted)))
+
+	for _, e := range evicted {
+		e.log.Info("evicting connection over the limits")
+
+		if err := e.conn.Close(websocket.StatusPolicyViolation, "connection limit exceeded"); err != nil {
+			e.log.Warn("error closing evicted websocket client", "error", err)
+		}
+	}
+}
+
+// Wait blocks until all connections are removed or the context is done.
+func (s *service) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		s.Lock()
+		remaining := len(s.connections)
+		s.Unlock()
+
+		if remaining < 1 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
 }
 
-func (s *service) Add(conn Connection) {
-	s.connections = append(s.connections, conn)
+// Close closes the connections of the endpoints, or all connections when none are given, as the
+// server is going away.
+func (s *service) Close(endpoints ...string) {
+	s.Lock()
+	entries := make([]*entry, 0, len(s.connections))
+	for _, e := range s.connections {
+		if len(endpoints) > 0 && !contains(endpoints, e.session.Endpoint) {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+	s.Unlock()
+
+	for _, e := range entries {
+		if e.conn == nil {
+			continue
+		}
+
+		if err := e.conn.Close(websocket.StatusGoingAway, "stopping server"); err != nil {
+			e.log.Warn("error closing websocket client", "error", err)
+		}
+	}
 }
 
-func (s *service) Close() {
-	for _, c := range s.connections {
-		if err := c.Close(websocket.StatusNormalClosure, "stopping server"); err != nil {
-			log.Printf("error closing websocket client: %v\n", err)
+func (s *service) filter(keep func(Session) bool) []Session {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.sorted(keep)
+}
+
+func (s *service) sorted(keep func(Session) bool) []Session {
+	sessions := []Session{}
+	for _, e := range s.connections {
+		if keep(e.session) {
+			sessions = append(sessions, e.session)
 		}
 	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ID.Compare(sessions[j].ID) < 0
+	})
+
+	return sessions
+}
+
+func (s *service) allow(user, ip string) error {
+	u := newUsage()
+	for _, e := range s.connections {
+		u.add(e.session.User, host(e.session.RemoteAddr))
+	}
+
+	return s.exceeds(u, user, ip)
+}
+
+// usage counts sessions in total, by user and by IP address.
+type usage struct {
+	total int
+	users map[string]int
+	ips   map[string]int
+}
+
+func newUsage() *usage {
+	return &usage{
+		users: map[string]int{},
+		ips:   map[string]int{},
+	}
+}
+
+func (u *usage) add(user, ip string) {
+	u.total++
+	u.users[user]++
+	u.ips[ip]++
+}
+
+// exceeds checks whether another session of the user from the address fits next to the counted
+// sessions.
+func (s *service) exceeds(u *usage, user, ip string) error {
+	if s.limits.Total > 0 && u.total >= s.limits.Total {
+		return ErrServerLimit
+	}
+
+	if s.limits.PerUser > 0 && u.users[user] >= s.limits.PerUser {
+		return ErrUserLimit
+	}
+
+	if s.limits.PerIP > 0 && u.ips[ip] >= s.limits.PerIP {
+		return ErrIPLimit
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func limitName(err error) string {
+	switch err {
+	case ErrServerLimit:
+		return "server"
+	case ErrUserLimit:
+		return "user"
+	default:
+		return "ip"
+	}
+}
+
+func host(remoteAddr string) string {
+	h, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+
+	return h
 }
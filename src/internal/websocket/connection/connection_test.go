@@ -1,25 +1,32 @@
 package connection
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/oklog/ulid/v2"
 	"github.com/stretchr/testify/assert"
 	"nhooyr.io/websocket"
+
+	"gochat/internal/logger"
 )
 
 func TestNew(t *testing.T) {
 	t.Parallel()
 
-	assert.NotNil(t, New())
+	assert.NotNil(t, New(Limits{}))
 }
 
 type connection struct {
 	closed bool
+	code   websocket.StatusCode
 	err    bool
 }
 
 func (c *connection) Close(code websocket.StatusCode, reason string) error {
 	c.closed = true
+	c.code = code
 
 	if c.err {
 		return assert.AnError
@@ -28,22 +35,157 @@ func (c *connection) Close(code websocket.StatusCode, reason string) error {
 	return nil
 }
 
+func add(t *testing.T, s *service, c Connection, endpoint, user, remoteAddr string) ulid.ULID {
+	id, err := s.Add(context.Background(), endpoint, user, remoteAddr)
+	assert.NoError(t, err)
+
+	s.Attach(id, c)
+
+	return id
+}
+
 func TestAdd(t *testing.T) {
 	t.Parallel()
 
 	s := &service{
-		connections: []Connection{},
+		connections: map[ulid.ULID]*entry{},
 	}
 
-	s.Add(&connection{})
+	add(t, s, &connection{}, "subscribe", "user", "127.0.0.1:1234")
 
 	assert.Equal(t, 1, len(s.connections))
 
-	s.Add(&connection{})
+	add(t, s, &connection{}, "publish", "user", "127.0.0.1:1235")
 
 	assert.Equal(t, 2, len(s.connections))
 }
 
+func TestLimits(t *testing.T) {
+	t.Parallel()
+
+	s := &service{
+		connections: map[ulid.ULID]*entry{},
+		limits:      Limits{Total: 3, PerUser: 2, PerIP: 2},
+	}
+
+	add(t, s, &connection{}, "subscribe", "user", "127.0.0.1:1234")
+	add(t, s, &connection{}, "publish", "user", "127.0.0.2:1234")
+
+	_, err := s.Add(context.Background(), "subscribe", "user", "127.0.0.3:1234")
+	assert.Equal(t, ErrUserLimit, err)
+
+	add(t, s, &connection{}, "subscribe", "other", "127.0.0.1:1235")
+
+	_, err = s.Add(context.Background(), "subscribe", "another", "127.0.0.1:1236")
+	assert.Equal(t, ErrServerLimit, err)
+
+	s.limits.Total = 0
+
+	_, err = s.Add(context.Background(), "subscribe", "another", "127.0.0.1:1236")
+	assert.Equal(t, ErrIPLimit, err)
+
+	_, err = s.Add(context.Background(), "subscribe", "another", "127.0.0.3:1236")
+	assert.NoError(t, err)
+}
+
+func TestSetLimits(t *testing.T) {
+	t.Parallel()
+
+	oldest := &connection{}
+	older := &connection{}
+	newest := &connection{}
+	other := &connection{}
+
+	s := &service{
+		connections: map[ulid.ULID]*entry{},
+	}
+
+	add(t, s, oldest, "subscribe", "user", "127.0.0.1:1234")
+	add(t, s, other, "subscribe", "other", "10.0.0.1:1234")
+	add(t, s, older, "publish", "user", "127.0.0.1:1235")
+	add(t, s, newest, "subscribe", "user", "127.0.0.1:1236")
+
+	s.SetLimits(Limits{PerUser: 1})
+
+	assert.True(t, oldest.closed)
+	assert.Equal(t, websocket.StatusPolicyViolation, oldest.code)
+	assert.True(t, older.closed)
+	assert.False(t, newest.closed)
+	assert.False(t, other.closed)
+}
+
+func TestRemove(t *testing.T) {
+	t.Parallel()
+
+	s := &service{
+		connections: map[ulid.ULID]*entry{},
+	}
+
+	id := add(t, s, &connection{}, "subscribe", "user", "127.0.0.1:1234")
+
+	s.Remove(id)
+
+	assert.Empty(t, s.connections)
+
+	_, err := s.Get(id)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestSessions(t *testing.T) {
+	t.Parallel()
+
+	s := &service{
+		connections: map[ulid.ULID]*entry{},
+	}
+
+	first := add(t, s, &connection{}, "subscribe", "user", "127.0.0.1:1234")
+	second := add(t, s, &connection{}, "publish", "other", "127.0.0.2:1234")
+	third := add(t, s, &connection{}, "publish", "user", "127.0.0.1:1235")
+
+	s.Record(first, 10)
+	s.Record(first, 5)
+	s.Record(ulid.Make(), 5)
+
+	session, err := s.Get(first)
+	assert.NoError(t, err)
+	assert.Equal(t, "subscribe", session.Endpoint)
+	assert.Equal(t, "user", session.User)
+	assert.Equal(t, "127.0.0.1:1234", session.RemoteAddr)
+	assert.False(t, session.ConnectedAt.IsZero())
+	assert.Equal(t, int64(2), session.Messages)
+	assert.Equal(t, int64(15), session.Bytes)
+
+	ids := func(sessions []Session) []ulid.ULID {
+		ids := []ulid.ULID{}
+		for _, s := range sessions {
+			ids = append(ids, s.ID)
+		}
+
+		return ids
+	}
+
+	assert.Equal(t, []ulid.ULID{first, second, third}, ids(s.List()))
+	assert.Equal(t, []ulid.ULID{first, third}, ids(s.ByUser("user")))
+	assert.Empty(t, s.ByUser("missing"))
+}
+
+func TestDisconnect(t *testing.T) {
+	t.Parallel()
+
+	c := &connection{}
+	s := &service{
+		connections: map[ulid.ULID]*entry{},
+	}
+
+	id := add(t, s, c, "subscribe", "user", "127.0.0.1:1234")
+
+	assert.NoError(t, s.Disconnect(id, websocket.StatusPolicyViolation, "kicked"))
+	assert.True(t, c.closed)
+	assert.Equal(t, websocket.StatusPolicyViolation, c.code)
+
+	assert.Equal(t, ErrNotFound, s.Disconnect(ulid.Make(), websocket.StatusPolicyViolation, "kicked"))
+}
+
 func TestClose(t *testing.T) {
 	t.Parallel()
 
@@ -56,11 +198,53 @@ func TestClose(t *testing.T) {
 	}
 
 	s := &service{
-		connections: []Connection{c1, c2},
+		connections: map[ulid.ULID]*entry{
+			ulid.Make(): {conn: c1, log: logger.Default()},
+			ulid.Make(): {conn: c2, log: logger.Default()},
+		},
 	}
 
 	s.Close()
 
 	assert.True(t, c1.closed)
+	assert.Equal(t, websocket.StatusGoingAway, c1.code)
 	assert.True(t, c2.closed)
 }
+
+func TestCloseEndpoint(t *testing.T) {
+	t.Parallel()
+
+	s := New(Limits{}).(*service)
+
+	publisher := &connection{}
+	subscriber := &connection{}
+	add(t, s, publisher, "publish", "user", "127.0.0.1:1234")
+	add(t, s, subscriber, "subscribe", "user", "127.0.0.1:1234")
+
+	s.Close("publish")
+
+	assert.True(t, publisher.closed)
+	assert.Equal(t, websocket.StatusGoingAway, publisher.code)
+	assert.False(t, subscriber.closed)
+}
+
+func TestWait(t *testing.T) {
+	t.Parallel()
+
+	s := &service{
+		connections: map[ulid.ULID]*entry{},
+	}
+
+	assert.NoError(t, s.Wait(context.Background()))
+
+	id := add(t, s, &connection{}, "subscribe", "user", "127.0.0.1:1234")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, s.Wait(ctx))
+
+	go s.Remove(id)
+
+	assert.NoError(t, s.Wait(context.Background()))
+}
@@ -0,0 +1,84 @@
+package heartbeat
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultInterval    = 30 * time.Second
+	DefaultTimeout     = 10 * time.Second
+	DefaultIdleTimeout = 30 * time.Minute
+)
+
+// Config of the websocket keepalive. Zero Interval disables pings and zero IdleTimeout disables the idle timeout.
+type Config struct {
+	Interval    time.Duration
+	Timeout     time.Duration
+	IdleTimeout time.Duration
+}
+
+// Settings hold the current Config, which can be replaced while connections are running.
+type Settings struct {
+	cfg atomic.Pointer[Config]
+}
+
+func NewSettings(cfg Config) *Settings {
+	s := &Settings{}
+	s.Store(cfg)
+
+	return s
+}
+
+func (s *Settings) Load() Config {
+	return *s.cfg.Load()
+}
+
+func (s *Settings) Store(cfg Config) {
+	s.cfg.Store(&cfg)
+}
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Run pings the peer every interval until the context is done. It returns an error when the peer
+// does not respond within the timeout.
+func Run(ctx context.Context, p Pinger, cfg Config) error {
+	if cfg.Interval <= 0 {
+		<-ctx.Done()
+
+		return nil
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+			err := p.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+
+				return err
+			}
+		}
+	}
+}
+
+// ReadContext returns the context for a single read, limited by the idle timeout.
+func ReadContext(ctx context.Context, cfg Config) (context.Context, context.CancelFunc) {
+	if cfg.IdleTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, cfg.IdleTimeout)
+}
@@ -0,0 +1,88 @@
+package heartbeat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pinger struct {
+	pings    int
+	failAt   int
+	blocking bool
+}
+
+func (p *pinger) Ping(ctx context.Context) error {
+	p.pings++
+
+	if p.blocking {
+		<-ctx.Done()
+
+		return ctx.Err()
+	}
+
+	if p.pings == p.failAt {
+		return assert.AnError
+	}
+
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	p := &pinger{failAt: 3}
+
+	err := Run(context.Background(), p, Config{Interval: time.Millisecond, Timeout: time.Second})
+
+	assert.Equal(t, assert.AnError, err)
+	assert.Equal(t, 3, p.pings)
+}
+
+func TestRunTimeout(t *testing.T) {
+	t.Parallel()
+
+	p := &pinger{blocking: true}
+
+	err := Run(context.Background(), p, Config{Interval: time.Millisecond, Timeout: time.Millisecond})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRunCancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.NoError(t, Run(ctx, &pinger{}, Config{Interval: time.Millisecond, Timeout: time.Second}))
+	assert.NoError(t, Run(ctx, &pinger{}, Config{}))
+}
+
+func TestReadContext(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := ReadContext(context.Background(), Config{})
+	defer cancel()
+
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+
+	ctx, cancel = ReadContext(context.Background(), Config{IdleTimeout: time.Minute})
+	defer cancel()
+
+	_, ok = ctx.Deadline()
+	assert.True(t, ok)
+}
+
+func TestSettings(t *testing.T) {
+	t.Parallel()
+
+	s := NewSettings(Config{Interval: time.Second})
+	assert.Equal(t, Config{Interval: time.Second}, s.Load())
+
+	s.Store(Config{IdleTimeout: time.Minute})
+	assert.Equal(t, Config{IdleTimeout: time.Minute}, s.Load())
+}